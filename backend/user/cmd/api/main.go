@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -53,17 +54,53 @@ func main() {
 
 	// Initialize business services
 	userService := services.NewUserService(db, steamAuth, stripeService)
-	paymentService := services.NewPaymentService(db, stripeService, userService, cfg.External.FrontendURL)
-	creditService := services.NewCreditService(db, userService, paymentService)
-	shopService := services.NewShopService(db)
-	serverService := services.NewServerService(db)
-	transactionService := services.NewTransactionService(db, serverService, userService)
+	ledgerService := services.NewLedgerService(db)
+	paymentService := services.NewPaymentService(db, stripeService, userService, ledgerService, cfg.External.FrontendURL)
+	creditService := services.NewCreditService(db, userService, paymentService, ledgerService)
+	serverService := services.NewServerService(db, cfg.RCON)
+	jobService := services.NewJobService(db)
+	pricingService := services.NewPricingService(db)
+	couponService := services.NewCouponService(db, pricingService)
+	refundService := services.NewRefundService(db, ledgerService, couponService)
+	deliveryService := services.NewDeliveryService(db, serverService, jobService, refundService, pricingService, cfg.Delivery)
+	saleService := services.NewSaleService(db)
+	shopService := services.NewShopService(db, deliveryService, pricingService, couponService, ledgerService)
+	transactionService := services.NewTransactionService(db, serverService, ledgerService, deliveryService, refundService, pricingService, couponService)
+	cartService := services.NewCartService(db, pricingService, transactionService)
 
 	// Initialize Priority 2 services
 	loyaltyService := services.NewLoyaltyService(db, userService)
 	spinWheelService := services.NewSpinWheelService(db, loyaltyService, creditService)
 	dailyRewardsService := services.NewDailyRewardsService(db, loyaltyService, creditService)
-	// jobService := services.NewJobService(db) // TODO: Implement job service usage
+
+	roleService := services.NewRoleService(db)
+	roleService.BootstrapSuperadmins(context.Background(), cfg.Admin.SuperadminSteamIDs)
+	rconConsoleService := services.NewRCONConsoleService(db, serverService, roleService)
+	catalogService := services.NewCatalogService(db)
+
+	// Keep server online status and player counts up to date
+	serverMonitor := services.NewServerMonitor(db, cfg.Monitor,
+		services.NewA2SProbe(),
+		services.NewRCONProbe(serverService),
+	)
+	serverMonitor.Start()
+
+	// Downsample status samples into hourly and daily history
+	serverHistoryService := services.NewServerHistoryService(db, cfg.Monitor)
+	serverHistoryService.Start()
+
+	// Check balances against the ledgers and payments against deposits
+	reconciliationService := services.NewReconciliationService(db, cfg.Reconciliation)
+	reconciliationService.Start()
+
+	// Replay stored responses for retried money-moving requests
+	idempotencyService := services.NewIdempotencyService(db)
+	idempotencyService.Start()
+
+	// Pick up deliveries that were interrupted by a restart
+	if err := deliveryService.ResumePendingDeliveries(context.Background()); err != nil {
+		log.Printf("Failed to resume pending deliveries: %v", err)
+	}
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(userService, jwtService, steamAuth, cfg.External.FrontendURL)
@@ -71,8 +108,18 @@ func main() {
 	creditHandler := handlers.NewCreditHandler(creditService)
 	paymentMethodsHandler := handlers.NewPaymentMethodsHandler(paymentService)
 	shopHandler := handlers.NewShopHandler(shopService)
-	serverHandler := handlers.NewServerHandler(serverService)
+	serverHandler := handlers.NewServerHandler(serverService, serverHistoryService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService)
+	cartHandler := handlers.NewCartHandler(cartService)
+	couponHandler := handlers.NewCouponHandler(couponService)
+	adminRCONHandler := handlers.NewAdminRCONHandler(rconConsoleService)
+	adminRoleHandler := handlers.NewAdminRoleHandler(roleService)
+	adminCatalogHandler := handlers.NewAdminCatalogHandler(catalogService)
+	adminCouponHandler := handlers.NewAdminCouponHandler(couponService)
+	adminSaleHandler := handlers.NewAdminSaleHandler(saleService)
+	adminReconciliationHandler := handlers.NewAdminReconciliationHandler(reconciliationService)
+	adminPaymentHandler := handlers.NewAdminPaymentHandler(paymentService)
+	adminTransactionHandler := handlers.NewAdminTransactionHandler(transactionService)
 
 	// Initialize Priority 2 handlers
 	loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyService)
@@ -81,6 +128,8 @@ func main() {
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	adminMiddleware := middleware.NewAdminMiddleware(roleService)
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(idempotencyService)
 
 	// Setup routes
 	router := setupRoutes(
@@ -91,10 +140,22 @@ func main() {
 		shopHandler,
 		serverHandler,
 		transactionHandler,
+		cartHandler,
+		couponHandler,
 		loyaltyHandler,
 		spinWheelHandler,
 		dailyRewardsHandler,
+		adminRCONHandler,
+		adminRoleHandler,
+		adminCatalogHandler,
+		adminCouponHandler,
+		adminSaleHandler,
+		adminReconciliationHandler,
+		adminPaymentHandler,
+		adminTransactionHandler,
 		authMiddleware,
+		adminMiddleware,
+		idempotencyMiddleware,
 	)
 
 	// Start server
@@ -115,10 +176,22 @@ func setupRoutes(
 	shopHandler *handlers.ShopHandler,
 	serverHandler *handlers.ServerHandler,
 	transactionHandler *handlers.TransactionHandler,
+	cartHandler *handlers.CartHandler,
+	couponHandler *handlers.CouponHandler,
 	loyaltyHandler *handlers.LoyaltyHandler,
 	spinWheelHandler *handlers.SpinWheelHandler,
 	dailyRewardsHandler *handlers.DailyRewardsHandler,
+	adminRCONHandler *handlers.AdminRCONHandler,
+	adminRoleHandler *handlers.AdminRoleHandler,
+	adminCatalogHandler *handlers.AdminCatalogHandler,
+	adminCouponHandler *handlers.AdminCouponHandler,
+	adminSaleHandler *handlers.AdminSaleHandler,
+	adminReconciliationHandler *handlers.AdminReconciliationHandler,
+	adminPaymentHandler *handlers.AdminPaymentHandler,
+	adminTransactionHandler *handlers.AdminTransactionHandler,
 	authMiddleware *middleware.AuthMiddleware,
+	adminMiddleware *middleware.AdminMiddleware,
+	idempotencyMiddleware *middleware.IdempotencyMiddleware,
 ) *gin.Engine {
 	router := gin.New()
 
@@ -164,6 +237,9 @@ func setupRoutes(
 		servers.GET("/", serverHandler.GetServers)
 		servers.GET("/:server_id", serverHandler.GetServerByID)
 		servers.GET("/:server_id/info", serverHandler.GetServerDisplayInfo)
+		servers.GET("/:server_id/query", serverHandler.QueryServer)
+		servers.GET("/:server_id/history", serverHandler.GetServerHistory)
+		servers.GET("/:server_id/history/uptime", serverHandler.GetServerUptime)
 		servers.GET("/categories", serverHandler.GetDisplayCategories)
 	}
 
@@ -190,9 +266,9 @@ func setupRoutes(
 	{
 		credits.GET("/balance", creditHandler.GetBalance)
 		credits.GET("/summary", creditHandler.GetSummary)
-		credits.POST("/topup", middleware.PaymentRateLimiter(), creditHandler.TopUp)
+		credits.POST("/topup", middleware.PaymentRateLimiter(), idempotencyMiddleware.Idempotent(), creditHandler.TopUp)
 		credits.GET("/transactions", middleware.ValidatePagination(), creditHandler.GetTransactions)
-		credits.POST("/transfer", creditHandler.TransferCredits)
+		credits.POST("/transfer", idempotencyMiddleware.Idempotent(), creditHandler.TransferCredits)
 	}
 
 	// ==========================================
@@ -214,9 +290,24 @@ func setupRoutes(
 	transactions := v1.Group("/transactions")
 	transactions.Use(authMiddleware.RequireAuth())
 	{
-		transactions.POST("/purchase", transactionHandler.ProcessPurchase)
+		transactions.POST("/purchase", idempotencyMiddleware.Idempotent(), transactionHandler.ProcessPurchase)
 		transactions.GET("/", middleware.ValidatePagination(), transactionHandler.GetUserTransactions)
 		transactions.GET("/:transaction_uuid", middleware.ValidateUUID("transaction_uuid"), transactionHandler.GetTransactionByID)
+		transactions.POST("/:transaction_uuid/retry", middleware.ValidateUUID("transaction_uuid"), transactionHandler.RetryDelivery)
+	}
+
+	// ==========================================
+	// CART ROUTES
+	// ==========================================
+	cart := v1.Group("/cart")
+	cart.Use(authMiddleware.RequireAuth())
+	{
+		cart.GET("", cartHandler.GetCart)
+		cart.DELETE("", cartHandler.ClearCart)
+		cart.POST("/items", cartHandler.AddItem)
+		cart.PATCH("/items/:cart_id", cartHandler.UpdateItem)
+		cart.DELETE("/items/:cart_id", cartHandler.RemoveItem)
+		cart.POST("/checkout", idempotencyMiddleware.Idempotent(), cartHandler.Checkout)
 	}
 
 	// ==========================================
@@ -230,8 +321,9 @@ func setupRoutes(
 		shop.GET("/items/:item_id", shopHandler.GetItemByID)
 
 		// Protected routes (auth required)
-		shop.POST("/buy", authMiddleware.RequireAuth(), shopHandler.BuyItem)
-		shop.POST("/gift", authMiddleware.RequireAuth(), shopHandler.GiftItem)
+		shop.POST("/buy", authMiddleware.RequireAuth(), idempotencyMiddleware.Idempotent(), shopHandler.BuyItem)
+		shop.POST("/gift", authMiddleware.RequireAuth(), idempotencyMiddleware.Idempotent(), shopHandler.GiftItem)
+		shop.POST("/coupons/validate", authMiddleware.RequireAuth(), couponHandler.ValidateCoupon)
 	}
 
 	// ==========================================
@@ -274,6 +366,7 @@ func setupRoutes(
 	{
 		// Profile management
 		account.GET("/profile", authHandler.GetProfile)
+		account.PUT("/eos-id", authHandler.UpdateEOSID)
 
 		// Credit-related endpoints
 		account.GET("/credits", creditHandler.GetBalance)
@@ -301,17 +394,86 @@ func setupRoutes(
 	}
 
 	// ==========================================
-	// ADMIN ROUTES (Future expansion)
+	// ADMIN ROUTES
 	// ==========================================
 	admin := v1.Group("/admin")
-	admin.Use(authMiddleware.RequireAuth()) // Will need admin role check later
+	admin.Use(authMiddleware.RequireAuth(), adminMiddleware.RequirePermission(middleware.PermissionAdminAccess))
 	{
-		// Placeholder for admin-only endpoints
 		admin.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{
-				"message": "Admin routes available but not implemented yet",
+				"status": "ok",
 			})
 		})
+		admin.GET("/me", adminRoleHandler.GetMe)
+
+		// Servers and RCON
+		admin.GET("/rcon/pools", adminMiddleware.RequirePermission(middleware.PermissionServersMonitor), serverHandler.GetRCONPoolStats)
+		admin.POST("/rcon/execute", adminMiddleware.RequirePermission(middleware.PermissionRCONExecute), adminRCONHandler.ExecuteCommand)
+		admin.GET("/rcon/history", adminMiddleware.RequirePermission(middleware.PermissionRCONHistory), adminRCONHandler.GetCommandHistory)
+
+		// Roles
+		admin.GET("/roles", adminMiddleware.RequirePermission(middleware.PermissionRolesView), adminRoleHandler.GetRoles)
+		admin.GET("/roles/assignments", adminMiddleware.RequirePermission(middleware.PermissionRolesView), adminRoleHandler.GetRoleAssignments)
+		admin.GET("/roles/audit", adminMiddleware.RequirePermission(middleware.PermissionRolesView), adminRoleHandler.GetAuditLog)
+		admin.POST("/users/:user_id/roles", adminMiddleware.RequirePermission(middleware.PermissionRolesManage), adminRoleHandler.GrantRole)
+		admin.DELETE("/users/:user_id/roles/:role", adminMiddleware.RequirePermission(middleware.PermissionRolesManage), adminRoleHandler.RevokeRole)
+
+		// Shop catalog
+		shop := admin.Group("/shop", adminMiddleware.RequirePermission(middleware.PermissionShopManage))
+		{
+			shop.GET("/categories", adminCatalogHandler.GetCategories)
+			shop.POST("/categories", adminCatalogHandler.CreateCategory)
+			shop.PATCH("/categories/:category_id", adminCatalogHandler.UpdateCategory)
+			shop.DELETE("/categories/:category_id", adminCatalogHandler.DeactivateCategory)
+			shop.GET("/items", adminCatalogHandler.GetItems)
+			shop.GET("/items/:item_id", adminCatalogHandler.GetItem)
+			shop.POST("/items", adminCatalogHandler.CreateItem)
+			shop.PATCH("/items/:item_id", adminCatalogHandler.UpdateItem)
+			shop.DELETE("/items/:item_id", adminCatalogHandler.DeactivateItem)
+			shop.PUT("/items/:item_id/servers", adminCatalogHandler.SetItemAvailability)
+			shop.GET("/changes", adminCatalogHandler.GetChangeLog)
+			shop.GET("/export", adminCatalogHandler.ExportCatalog)
+			shop.POST("/import", adminCatalogHandler.ImportCatalog)
+			shop.GET("/sales", adminSaleHandler.GetSales)
+			shop.POST("/sales", adminSaleHandler.CreateSale)
+			shop.GET("/sales/:sale_id", adminSaleHandler.GetSale)
+			shop.PATCH("/sales/:sale_id", adminSaleHandler.UpdateSale)
+			shop.DELETE("/sales/:sale_id", adminSaleHandler.DeactivateSale)
+		}
+
+		// Discount coupons
+		coupons := admin.Group("/coupons", adminMiddleware.RequirePermission(middleware.PermissionCouponsManage))
+		{
+			coupons.GET("", adminCouponHandler.GetCoupons)
+			coupons.POST("", adminCouponHandler.CreateCoupon)
+			coupons.GET("/:coupon_id", adminCouponHandler.GetCoupon)
+			coupons.PATCH("/:coupon_id", adminCouponHandler.UpdateCoupon)
+			coupons.DELETE("/:coupon_id", adminCouponHandler.DeactivateCoupon)
+			coupons.GET("/:coupon_id/redemptions", adminCouponHandler.GetRedemptions)
+		}
+
+		// Ledger reconciliation reports
+		reconciliation := admin.Group("/reconciliation", adminMiddleware.RequirePermission(middleware.PermissionLedgerReconcile))
+		{
+			reconciliation.GET("/runs", adminReconciliationHandler.GetRuns)
+			reconciliation.POST("/runs", adminReconciliationHandler.StartRun)
+			reconciliation.GET("/runs/:run_id", adminReconciliationHandler.GetRun)
+			reconciliation.GET("/issues", adminReconciliationHandler.GetIssues)
+			reconciliation.PATCH("/issues/:issue_id", adminReconciliationHandler.UpdateIssue)
+		}
+
+		// Stripe refunds of credit top-ups
+		payments := admin.Group("/payments", adminMiddleware.RequirePermission(middleware.PermissionPaymentsRefund))
+		{
+			payments.GET("/refunds", adminPaymentHandler.GetRefunds)
+			payments.POST("/:payment_id/refunds", idempotencyMiddleware.Idempotent(), adminPaymentHandler.RefundPayment)
+		}
+
+		// Refunds of failed purchases
+		adminTransactions := admin.Group("/transactions", adminMiddleware.RequirePermission(middleware.PermissionTransactionsRefund))
+		{
+			adminTransactions.POST("/:transaction_uuid/refund", middleware.ValidateUUID("transaction_uuid"), adminTransactionHandler.RefundTransaction)
+		}
 	}
 
 	// ==========================================
@@ -342,6 +504,9 @@ func setupRoutes(
 					"GET /api/v1/servers",
 					"GET /api/v1/servers/:id",
 					"GET /api/v1/servers/:id/info",
+					"GET /api/v1/servers/:id/query",
+					"GET /api/v1/servers/:id/history",
+					"GET /api/v1/servers/:id/history/uptime",
 					"GET /api/v1/servers/categories",
 				},
 				"payments": []string{
@@ -368,11 +533,21 @@ func setupRoutes(
 					"GET /api/v1/shop/categories",
 					"GET /api/v1/shop/items",
 					"GET /api/v1/shop/items/:id",
+					"POST /api/v1/shop/coupons/validate",
 				},
 				"transactions": []string{
 					"POST /api/v1/transactions/purchase",
 					"GET /api/v1/transactions",
 					"GET /api/v1/transactions/:uuid",
+					"POST /api/v1/transactions/:uuid/retry",
+				},
+				"cart": []string{
+					"GET /api/v1/cart",
+					"DELETE /api/v1/cart",
+					"POST /api/v1/cart/items",
+					"PATCH /api/v1/cart/items/:cart_id",
+					"DELETE /api/v1/cart/items/:cart_id",
+					"POST /api/v1/cart/checkout",
 				},
 				"gamification": []string{
 					"GET /api/v1/loyalty/balance",
@@ -386,12 +561,57 @@ func setupRoutes(
 				},
 				"account": []string{
 					"GET /api/v1/account/profile",
+					"PUT /api/v1/account/eos-id",
 					"GET /api/v1/account/credits",
 					"GET /api/v1/account/payments",
 					"GET /api/v1/account/transactions",
 					"GET /api/v1/account/points",
 					"GET /api/v1/account/dashboard",
 				},
+				"admin": []string{
+					"GET /api/v1/admin/health",
+					"GET /api/v1/admin/me",
+					"GET /api/v1/admin/rcon/pools",
+					"POST /api/v1/admin/rcon/execute",
+					"GET /api/v1/admin/rcon/history",
+					"GET /api/v1/admin/roles",
+					"GET /api/v1/admin/roles/assignments",
+					"GET /api/v1/admin/roles/audit",
+					"POST /api/v1/admin/users/:user_id/roles",
+					"DELETE /api/v1/admin/users/:user_id/roles/:role",
+					"GET /api/v1/admin/shop/categories",
+					"POST /api/v1/admin/shop/categories",
+					"PATCH /api/v1/admin/shop/categories/:category_id",
+					"DELETE /api/v1/admin/shop/categories/:category_id",
+					"GET /api/v1/admin/shop/items",
+					"GET /api/v1/admin/shop/items/:item_id",
+					"POST /api/v1/admin/shop/items",
+					"PATCH /api/v1/admin/shop/items/:item_id",
+					"DELETE /api/v1/admin/shop/items/:item_id",
+					"PUT /api/v1/admin/shop/items/:item_id/servers",
+					"GET /api/v1/admin/shop/changes",
+					"GET /api/v1/admin/shop/export",
+					"POST /api/v1/admin/shop/import",
+					"GET /api/v1/admin/shop/sales",
+					"POST /api/v1/admin/shop/sales",
+					"GET /api/v1/admin/shop/sales/:sale_id",
+					"PATCH /api/v1/admin/shop/sales/:sale_id",
+					"DELETE /api/v1/admin/shop/sales/:sale_id",
+					"GET /api/v1/admin/coupons",
+					"POST /api/v1/admin/coupons",
+					"GET /api/v1/admin/coupons/:coupon_id",
+					"PATCH /api/v1/admin/coupons/:coupon_id",
+					"DELETE /api/v1/admin/coupons/:coupon_id",
+					"GET /api/v1/admin/coupons/:coupon_id/redemptions",
+					"GET /api/v1/admin/reconciliation/runs",
+					"POST /api/v1/admin/reconciliation/runs",
+					"GET /api/v1/admin/reconciliation/runs/:run_id",
+					"GET /api/v1/admin/reconciliation/issues",
+					"PATCH /api/v1/admin/reconciliation/issues/:issue_id",
+					"GET /api/v1/admin/payments/refunds",
+					"POST /api/v1/admin/payments/:payment_id/refunds",
+					"POST /api/v1/admin/transactions/:uuid/refund",
+				},
 			},
 			"rate_limits": gin.H{
 				"general":      "100 requests per minute",
@@ -402,6 +622,11 @@ func setupRoutes(
 				"type":   "Steam OAuth + JWT",
 				"header": "Authorization: Bearer {token}",
 			},
+			"idempotency": gin.H{
+				"header":    "Idempotency-Key: {unique key}",
+				"endpoints": "POST credits/topup, credits/transfer, transactions/purchase, cart/checkout, shop/buy, shop/gift, admin/payments/:payment_id/refunds",
+				"retention": "Responses are replayed for 24h; reusing a key for a different request returns 422",
+			},
 		})
 	})
 
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"nexark-user-backend/pkg/rcon"
+	"nexark-user-backend/pkg/rcon/rcontest"
+)
+
+// fakercon runs the rcontest server standalone, so the API and the delivery
+// pipeline can be pointed at it during local development instead of ARK.
+func main() {
+	addr := flag.String("addr", "127.0.0.1:27020", "address to listen on")
+	password := flag.String("password", "", "RCON password")
+	players := flag.String("players", "", "online players as name=id pairs separated by commas")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	noMirror := flag.Bool("ark", false, "don't mirror empty response packets, like ARK servers")
+	flag.Parse()
+
+	server, err := rcontest.Listen(*addr, *password)
+	if err != nil {
+		log.Fatal("Failed to start fake RCON server:", err)
+	}
+	defer server.Close()
+
+	server.SetLatency(*latency)
+	server.SetSentinelMirroring(!*noMirror)
+	server.SetPlayers(parsePlayers(*players)...)
+	server.HandleDefault(func(command string) rcontest.Response {
+		log.Printf("RCON command: %s", command)
+		return rcontest.Response{Body: "Server received, But no response!! "}
+	})
+
+	log.Printf("Fake RCON server listening on %s", server.Addr)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Printf("Shutting down after %d commands", len(server.Commands()))
+}
+
+func parsePlayers(value string) []rcon.Player {
+	var players []rcon.Player
+	for _, pair := range strings.Split(value, ",") {
+		name, id, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || id == "" {
+			continue
+		}
+		players = append(players, rcon.Player{Index: len(players), Name: name, ID: id})
+	}
+	return players
+}
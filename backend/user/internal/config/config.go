@@ -3,19 +3,26 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Steam    SteamConfig
-	Stripe   StripeConfig
-	ARK      ARKConfig
-	External ExternalConfig
+	Server         ServerConfig
+	Database       DatabaseConfig
+	Redis          RedisConfig
+	JWT            JWTConfig
+	Steam          SteamConfig
+	Stripe         StripeConfig
+	ARK            ARKConfig
+	RCON           RCONConfig
+	Monitor        MonitorConfig
+	Delivery       DeliveryConfig
+	Reconciliation ReconciliationConfig
+	Admin          AdminConfig
+	External       ExternalConfig
 }
 
 type ServerConfig struct {
@@ -62,6 +69,54 @@ type ARKConfig struct {
 	X100RCONPassword string
 }
 
+// RCONConfig sizes the per-server RCON connection pools
+type RCONConfig struct {
+	MaxConnsPerServer int
+	CommandTimeout    time.Duration
+	KeepAliveInterval time.Duration
+	IdleTimeout       time.Duration
+}
+
+// DefaultMonitorInterval is how often servers are polled unless configured
+const DefaultMonitorInterval = 5 * time.Minute
+
+// MonitorConfig controls the background server status poller
+type MonitorConfig struct {
+	Enabled      bool
+	Interval     time.Duration
+	Concurrency  int
+	ProbeTimeout time.Duration
+	// Probes lists the probes to try in order: "a2s", "rcon"
+	Probes []string
+	// Raw samples and hourly rollups are deleted after these periods
+	RawRetention    time.Duration
+	HourlyRetention time.Duration
+}
+
+// AdminConfig bootstraps admin access
+type AdminConfig struct {
+	// SuperadminSteamIDs are granted the superadmin role at startup, so a fresh
+	// install has someone who can grant the other roles
+	SuperadminSteamIDs []string
+}
+
+// DeliveryConfig controls how purchased items are delivered over RCON
+type DeliveryConfig struct {
+	MaxAttempts    int
+	BaseRetryDelay time.Duration
+	MaxRetryDelay  time.Duration
+	// RequirePlayerOnline holds deliveries until the player is on the target server
+	RequirePlayerOnline bool
+	PlayerCheckInterval time.Duration
+	AwaitPlayerTimeout  time.Duration
+}
+
+// ReconciliationConfig controls the scheduled ledger reconciliation job
+type ReconciliationConfig struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
 type ExternalConfig struct {
 	FrontendURL string
 }
@@ -109,6 +164,38 @@ func Load() (*Config, error) {
 			X100RCONPort:     getEnv("ARK_X100_RCON_PORT", "27021"),
 			X100RCONPassword: getEnv("ARK_X100_RCON_PASSWORD", ""),
 		},
+		RCON: RCONConfig{
+			MaxConnsPerServer: getEnvInt("RCON_MAX_CONNS_PER_SERVER", 4),
+			CommandTimeout:    getEnvDuration("RCON_COMMAND_TIMEOUT", 10*time.Second),
+			KeepAliveInterval: getEnvDuration("RCON_KEEPALIVE_INTERVAL", 30*time.Second),
+			IdleTimeout:       getEnvDuration("RCON_IDLE_TIMEOUT", 10*time.Minute),
+		},
+		Monitor: MonitorConfig{
+			Enabled:      getEnv("SERVER_MONITOR_ENABLED", "true") == "true",
+			Interval:     getEnvDuration("SERVER_MONITOR_INTERVAL", DefaultMonitorInterval),
+			Concurrency:  getEnvInt("SERVER_MONITOR_CONCURRENCY", 4),
+			ProbeTimeout: getEnvDuration("SERVER_MONITOR_PROBE_TIMEOUT", 10*time.Second),
+			Probes:       getEnvList("SERVER_MONITOR_PROBES", []string{"a2s", "rcon"}),
+
+			RawRetention:    getEnvDuration("SERVER_HISTORY_RAW_RETENTION", 7*24*time.Hour),
+			HourlyRetention: getEnvDuration("SERVER_HISTORY_HOURLY_RETENTION", 90*24*time.Hour),
+		},
+		Delivery: DeliveryConfig{
+			MaxAttempts:    getEnvInt("DELIVERY_MAX_ATTEMPTS", 8),
+			BaseRetryDelay: getEnvDuration("DELIVERY_BASE_RETRY_DELAY", 30*time.Second),
+			MaxRetryDelay:  getEnvDuration("DELIVERY_MAX_RETRY_DELAY", 30*time.Minute),
+
+			RequirePlayerOnline: getEnv("DELIVERY_REQUIRE_PLAYER_ONLINE", "true") == "true",
+			PlayerCheckInterval: getEnvDuration("DELIVERY_PLAYER_CHECK_INTERVAL", time.Minute),
+			AwaitPlayerTimeout:  getEnvDuration("DELIVERY_AWAIT_PLAYER_TIMEOUT", 24*time.Hour),
+		},
+		Reconciliation: ReconciliationConfig{
+			Enabled:  getEnv("RECONCILIATION_ENABLED", "true") == "true",
+			Interval: getEnvDuration("RECONCILIATION_INTERVAL", 24*time.Hour),
+		},
+		Admin: AdminConfig{
+			SuperadminSteamIDs: getEnvList("ADMIN_SUPERADMIN_STEAM_IDS", nil),
+		},
 		External: ExternalConfig{
 			FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5173"),
 		},
@@ -121,3 +208,36 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCatalogUploadSize caps catalog import files
+const maxCatalogUploadSize = 5 << 20
+
+type AdminCatalogHandler struct {
+	catalogService *services.CatalogService
+}
+
+func NewAdminCatalogHandler(catalogService *services.CatalogService) *AdminCatalogHandler {
+	return &AdminCatalogHandler{catalogService: catalogService}
+}
+
+// GetCategories lists categories; ?include_inactive=true adds hidden ones
+func (h *AdminCatalogHandler) GetCategories(c *gin.Context) {
+	categories, err := h.catalogService.GetCategories(c.Request.Context(), c.Query("include_inactive") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_CATEGORIES",
+				"message": "Failed to retrieve categories",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"categories": categories,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) CreateCategory(c *gin.Context) {
+	var input services.CategoryInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	category, err := h.catalogService.CreateCategory(c.Request.Context(), input, adminID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"category": category,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) UpdateCategory(c *gin.Context) {
+	categoryID, ok := parseCatalogID(c, "category_id")
+	if !ok {
+		return
+	}
+
+	var input services.CategoryInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	category, err := h.catalogService.UpdateCategory(c.Request.Context(), categoryID, input, adminID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"category": category,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) DeactivateCategory(c *gin.Context) {
+	categoryID, ok := parseCatalogID(c, "category_id")
+	if !ok {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	if err := h.catalogService.DeactivateCategory(c.Request.Context(), categoryID, adminID); err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Category deactivated",
+	})
+}
+
+// GetItems lists items with ?category_id=, ?q= and ?include_inactive=true
+func (h *AdminCatalogHandler) GetItems(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	filter := services.AdminItemFilter{
+		Query:           c.Query("q"),
+		IncludeInactive: c.Query("include_inactive") == "true",
+	}
+	if categoryID, err := strconv.ParseUint(c.Query("category_id"), 10, 32); err == nil {
+		filter.CategoryID = uint(categoryID)
+	}
+
+	items, total, err := h.catalogService.GetItems(c.Request.Context(), filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_ITEMS",
+				"message": "Failed to retrieve items",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"items": items,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) GetItem(c *gin.Context) {
+	itemID, ok := parseCatalogID(c, "item_id")
+	if !ok {
+		return
+	}
+
+	item, err := h.catalogService.GetItem(c.Request.Context(), itemID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"item": item,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) CreateItem(c *gin.Context) {
+	var input services.ItemInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	item, err := h.catalogService.CreateItem(c.Request.Context(), input, adminID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"item": item,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) UpdateItem(c *gin.Context) {
+	itemID, ok := parseCatalogID(c, "item_id")
+	if !ok {
+		return
+	}
+
+	var input services.ItemInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	item, err := h.catalogService.UpdateItem(c.Request.Context(), itemID, input, adminID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"item": item,
+		},
+	})
+}
+
+func (h *AdminCatalogHandler) DeactivateItem(c *gin.Context) {
+	itemID, ok := parseCatalogID(c, "item_id")
+	if !ok {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	if err := h.catalogService.DeactivateItem(c.Request.Context(), itemID, adminID); err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Item deactivated",
+	})
+}
+
+type setAvailabilityRequest struct {
+	Servers []services.ServerAvailabilityInput `json:"servers" binding:"dive"`
+}
+
+// SetItemAvailability replaces the servers an item is sold on, with optional
+// per-server price and RCON command overrides. An empty list sells it everywhere.
+func (h *AdminCatalogHandler) SetItemAvailability(c *gin.Context) {
+	itemID, ok := parseCatalogID(c, "item_id")
+	if !ok {
+		return
+	}
+
+	var req setAvailabilityRequest
+	if !bindCatalogInput(c, &req) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	item, err := h.catalogService.SetItemAvailability(c.Request.Context(), itemID, req.Servers, adminID)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"item": item,
+		},
+	})
+}
+
+// GetChangeLog lists catalog changes with ?entity_type=item|category and ?entity_id=
+func (h *AdminCatalogHandler) GetChangeLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	var entityID uint
+	if id, err := strconv.ParseUint(c.Query("entity_id"), 10, 32); err == nil {
+		entityID = uint(id)
+	}
+
+	entries, total, err := h.catalogService.GetChangeLog(c.Request.Context(), c.Query("entity_type"), entityID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_CHANGE_LOG",
+				"message": "Failed to retrieve change log",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"changes": entries,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+// ExportCatalog downloads the catalog with ?format=json (default) or
+// ?format=csv&entity=categories|items
+func (h *AdminCatalogHandler) ExportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", services.CatalogFormatJSON)
+	entity := c.Query("entity")
+	if !validCatalogFormat(c, format, entity) {
+		return
+	}
+
+	doc, err := h.catalogService.ExportCatalog(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_EXPORT_CATALOG",
+				"message": "Failed to export the catalog",
+			},
+		})
+		return
+	}
+
+	filename := "catalog-" + time.Now().Format("20060102-150405")
+	if format == services.CatalogFormatJSON {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, doc)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteCatalogCSV(&buf, entity, doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_EXPORT_CATALOG",
+				"message": "Failed to export the catalog",
+			},
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+"-"+entity+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// ImportCatalog upserts categories by category_key and items by item_code from
+// a JSON or CSV file, sent as the request body or a multipart "file" field.
+// It's a dry run that only returns the diff unless ?dry_run=false; the import
+// is applied all or nothing.
+func (h *AdminCatalogHandler) ImportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", services.CatalogFormatJSON)
+	entity := c.Query("entity")
+	if !validCatalogFormat(c, format, entity) {
+		return
+	}
+
+	data, err := readCatalogUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_FILE",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	var doc *services.CatalogDocument
+	if format == services.CatalogFormatJSON {
+		doc, err = services.ParseCatalogJSON(data)
+	} else {
+		doc, err = services.ParseCatalogCSV(entity, bytes.NewReader(data))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_FILE",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	dryRun := c.Query("dry_run") != "false"
+
+	result, err := h.catalogService.ImportCatalog(c.Request.Context(), doc, dryRun, adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_IMPORT_CATALOG",
+				"message": "Failed to import the catalog",
+			},
+		})
+		return
+	}
+
+	if result.Summary.Errors > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "IMPORT_VALIDATION_FAILED",
+				"message": "Some rows are invalid; nothing was imported",
+			},
+			"data": result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+func validCatalogFormat(c *gin.Context, format, entity string) bool {
+	switch {
+	case format == services.CatalogFormatJSON:
+		return true
+	case format == services.CatalogFormatCSV &&
+		(entity == services.CatalogEntityCategories || entity == services.CatalogEntityItems):
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error": map[string]interface{}{
+			"code":    "INVALID_FORMAT",
+			"message": "format must be json, or csv with entity=categories|items",
+		},
+	})
+	return false
+}
+
+// readCatalogUpload reads the multipart "file" field, or the raw body
+func readCatalogUpload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogUploadSize)
+
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("missing file field")
+		}
+		defer file.Close()
+		r = file
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	return data, nil
+}
+
+func parseCatalogID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_ID",
+				"message": "Invalid " + param,
+			},
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func bindCatalogInput(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return false
+	}
+	return true
+}
+
+func respondCatalogError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "NOT_FOUND",
+				"message": err.Error(),
+			},
+		})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "VALIDATION_FAILED",
+				"message": err.Error(),
+			},
+		})
+	case strings.Contains(err.Error(), "already exists"):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "DUPLICATE_KEY",
+				"message": err.Error(),
+			},
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "CATALOG_UPDATE_FAILED",
+				"message": "Failed to update the catalog",
+			},
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminCouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewAdminCouponHandler(couponService *services.CouponService) *AdminCouponHandler {
+	return &AdminCouponHandler{couponService: couponService}
+}
+
+// GetCoupons lists coupons; ?include_inactive=true adds deactivated ones
+func (h *AdminCouponHandler) GetCoupons(c *gin.Context) {
+	limit, page := parseAdminPage(c)
+
+	coupons, total, err := h.couponService.GetCoupons(c.Request.Context(), c.Query("include_inactive") == "true", limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_COUPONS",
+				"message": "Failed to retrieve coupons",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"coupons": coupons,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+func (h *AdminCouponHandler) GetCoupon(c *gin.Context) {
+	couponID, ok := parseCatalogID(c, "coupon_id")
+	if !ok {
+		return
+	}
+
+	coupon, err := h.couponService.GetCoupon(c.Request.Context(), couponID)
+	if err != nil {
+		respondCouponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"coupon": coupon,
+		},
+	})
+}
+
+func (h *AdminCouponHandler) CreateCoupon(c *gin.Context) {
+	var input services.CouponInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	coupon, err := h.couponService.CreateCoupon(c.Request.Context(), input, adminID)
+	if err != nil {
+		respondCouponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"coupon": coupon,
+		},
+	})
+}
+
+func (h *AdminCouponHandler) UpdateCoupon(c *gin.Context) {
+	couponID, ok := parseCatalogID(c, "coupon_id")
+	if !ok {
+		return
+	}
+
+	var input services.CouponInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	coupon, err := h.couponService.UpdateCoupon(c.Request.Context(), couponID, input)
+	if err != nil {
+		respondCouponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"coupon": coupon,
+		},
+	})
+}
+
+func (h *AdminCouponHandler) DeactivateCoupon(c *gin.Context) {
+	couponID, ok := parseCatalogID(c, "coupon_id")
+	if !ok {
+		return
+	}
+
+	if err := h.couponService.DeactivateCoupon(c.Request.Context(), couponID); err != nil {
+		respondCouponError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Coupon deactivated",
+	})
+}
+
+// GetRedemptions lists the purchases that used a coupon
+func (h *AdminCouponHandler) GetRedemptions(c *gin.Context) {
+	couponID, ok := parseCatalogID(c, "coupon_id")
+	if !ok {
+		return
+	}
+
+	limit, page := parseAdminPage(c)
+
+	redemptions, total, err := h.couponService.GetRedemptions(c.Request.Context(), couponID, limit, (page-1)*limit)
+	if err != nil {
+		respondCouponError(c, err)
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"redemptions": redemptions,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+// parseAdminPage reads ?limit= (1-200, default 50) and ?page=
+func parseAdminPage(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	return limit, page
+}
+
+func respondCouponError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "NOT_FOUND",
+				"message": err.Error(),
+			},
+		})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "VALIDATION_FAILED",
+				"message": err.Error(),
+			},
+		})
+	case strings.Contains(err.Error(), "already exists"):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "DUPLICATE_KEY",
+				"message": err.Error(),
+			},
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "COUPON_UPDATE_FAILED",
+				"message": "Failed to update coupons",
+			},
+		})
+	}
+}
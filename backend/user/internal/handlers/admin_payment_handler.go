@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminPaymentHandler struct {
+	paymentService *services.PaymentService
+}
+
+func NewAdminPaymentHandler(paymentService *services.PaymentService) *AdminPaymentHandler {
+	return &AdminPaymentHandler{paymentService: paymentService}
+}
+
+// RefundPayment refunds a credit top-up through Stripe and claws back its
+// credits. Without an amount the rest of the payment is refunded.
+func (h *AdminPaymentHandler) RefundPayment(c *gin.Context) {
+	paymentID, ok := parseCatalogID(c, "payment_id")
+	if !ok {
+		return
+	}
+
+	var req services.RefundPaymentRequest
+	if !bindCatalogInput(c, &req) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	refund, err := h.paymentService.RefundPayment(c.Request.Context(), paymentID, req, adminID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "NOT_FOUND",
+					"message": err.Error(),
+				},
+			})
+		case strings.HasPrefix(err.Error(), "invalid"):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "REFUND_NOT_ALLOWED",
+					"message": err.Error(),
+				},
+			})
+		case strings.HasPrefix(err.Error(), "failed to refund payment"):
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "STRIPE_REFUND_FAILED",
+					"message": "Stripe rejected the refund",
+				},
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "REFUND_FAILED",
+					"message": "Failed to refund payment",
+				},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"refund": refund,
+		},
+	})
+}
+
+// GetRefunds lists refunds; filter with ?payment_id=, ?user_id= and
+// ?shortfall=true for refunds the user's balance could not cover
+func (h *AdminPaymentHandler) GetRefunds(c *gin.Context) {
+	limit, page := parseAdminPage(c)
+
+	filter := services.PaymentRefundFilter{
+		WithShortfall: c.Query("shortfall") == "true",
+	}
+	if paymentID, err := strconv.ParseUint(c.Query("payment_id"), 10, 32); err == nil {
+		filter.PaymentID = uint(paymentID)
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		filter.UserID = uint(userID)
+	}
+
+	refunds, total, err := h.paymentService.GetRefunds(c.Request.Context(), filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_REFUNDS",
+				"message": "Failed to retrieve refunds",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"refunds": refunds,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRCONHandler struct {
+	consoleService *services.RCONConsoleService
+}
+
+func NewAdminRCONHandler(consoleService *services.RCONConsoleService) *AdminRCONHandler {
+	return &AdminRCONHandler{consoleService: consoleService}
+}
+
+type executeRCONRequest struct {
+	ServerIDs []uint `json:"server_ids" binding:"required,min=1"`
+	Command   string `json:"command" binding:"required"`
+}
+
+// ExecuteCommand runs an RCON command on one or several servers
+func (h *AdminRCONHandler) ExecuteCommand(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "UNAUTHORIZED",
+				"message": "User not authenticated",
+			},
+		})
+		return
+	}
+
+	var req executeRCONRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	results, err := h.consoleService.Execute(c.Request.Context(), userID, req.ServerIDs, req.Command)
+	if err != nil {
+		if strings.Contains(err.Error(), "not allowed") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "COMMAND_NOT_ALLOWED",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+
+		if strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "at most") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "INVALID_REQUEST",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_EXECUTE_COMMAND",
+				"message": "Failed to execute RCON command",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"command": strings.TrimSpace(req.Command),
+			"results": results,
+		},
+	})
+}
+
+// GetCommandHistory searches the RCON command history
+func (h *AdminRCONHandler) GetCommandHistory(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	filter := services.RCONHistoryFilter{
+		Status:           c.Query("status"),
+		ExecutionContext: c.Query("context"),
+		Query:            c.Query("q"),
+		Limit:            limit,
+		Offset:           (page - 1) * limit,
+	}
+
+	if serverID, err := strconv.ParseUint(c.Query("server_id"), 10, 32); err == nil {
+		filter.ServerID = uint(serverID)
+	}
+	if executedBy, err := strconv.ParseUint(c.Query("executed_by"), 10, 32); err == nil {
+		filter.ExecutedBy = uint(executedBy)
+	}
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "INVALID_REQUEST",
+					"message": param + " must be an RFC 3339 timestamp",
+				},
+			})
+			return
+		}
+		*target = &t
+	}
+
+	history, total, err := h.consoleService.SearchHistory(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_HISTORY",
+				"message": "Failed to retrieve command history",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"history": history,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
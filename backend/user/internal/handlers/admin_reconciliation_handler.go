@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminReconciliationHandler struct {
+	reconciliationService *services.ReconciliationService
+}
+
+func NewAdminReconciliationHandler(reconciliationService *services.ReconciliationService) *AdminReconciliationHandler {
+	return &AdminReconciliationHandler{reconciliationService: reconciliationService}
+}
+
+func (h *AdminReconciliationHandler) GetRuns(c *gin.Context) {
+	limit, page := parseAdminPage(c)
+
+	runs, total, err := h.reconciliationService.GetRuns(c.Request.Context(), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_RUNS",
+				"message": "Failed to retrieve reconciliation runs",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"runs": runs,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+// StartRun reconciles the ledgers now and returns the finished run
+func (h *AdminReconciliationHandler) StartRun(c *gin.Context) {
+	adminID, _ := middleware.GetUserID(c)
+
+	run, err := h.reconciliationService.Run(c.Request.Context(), &adminID)
+	if err != nil {
+		if strings.Contains(err.Error(), "already running") {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "RECONCILIATION_RUNNING",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "RECONCILIATION_FAILED",
+				"message": "Ledger reconciliation failed",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"run": run,
+		},
+	})
+}
+
+// GetRun returns a run with its issue counts by type and status
+func (h *AdminReconciliationHandler) GetRun(c *gin.Context) {
+	runID, ok := parseCatalogID(c, "run_id")
+	if !ok {
+		return
+	}
+
+	report, err := h.reconciliationService.GetReport(c.Request.Context(), runID)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"run": report,
+		},
+	})
+}
+
+// GetIssues lists issues; filter with ?run_id=, ?type=, ?status= and ?user_id=
+func (h *AdminReconciliationHandler) GetIssues(c *gin.Context) {
+	limit, page := parseAdminPage(c)
+
+	filter := services.ReconciliationIssueFilter{
+		IssueType: c.Query("type"),
+		Status:    c.Query("status"),
+	}
+	if runID, err := strconv.ParseUint(c.Query("run_id"), 10, 32); err == nil {
+		filter.RunID = uint(runID)
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		filter.UserID = uint(userID)
+	}
+
+	issues, total, err := h.reconciliationService.GetIssues(c.Request.Context(), filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_ISSUES",
+				"message": "Failed to retrieve reconciliation issues",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"issues": issues,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+// UpdateIssue marks an issue resolved or ignored with a note, or reopens it
+func (h *AdminReconciliationHandler) UpdateIssue(c *gin.Context) {
+	issueID, ok := parseCatalogID(c, "issue_id")
+	if !ok {
+		return
+	}
+
+	var req services.UpdateIssueRequest
+	if !bindCatalogInput(c, &req) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	issue, err := h.reconciliationService.UpdateIssue(c.Request.Context(), issueID, req, adminID)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"issue": issue,
+		},
+	})
+}
+
+func respondReconciliationError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "not found") {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "NOT_FOUND",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error": map[string]interface{}{
+			"code":    "RECONCILIATION_ERROR",
+			"message": "Failed to process reconciliation request",
+		},
+	})
+}
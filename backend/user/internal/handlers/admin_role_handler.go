@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRoleHandler struct {
+	roleService *services.RoleService
+}
+
+func NewAdminRoleHandler(roleService *services.RoleService) *AdminRoleHandler {
+	return &AdminRoleHandler{roleService: roleService}
+}
+
+type changeRoleRequest struct {
+	Role   string `json:"role" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// GetMe returns the roles and permissions of the signed-in admin
+func (h *AdminRoleHandler) GetMe(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	roles, err := h.roleService.GetUserRoles(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_ROLES",
+				"message": "Failed to retrieve roles",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user_id":     userID,
+			"roles":       roles,
+			"permissions": middleware.GetPermissions(c),
+		},
+	})
+}
+
+// GetRoles lists roles with their permissions
+func (h *AdminRoleHandler) GetRoles(c *gin.Context) {
+	roles, err := h.roleService.GetRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_ROLES",
+				"message": "Failed to retrieve roles",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"roles": roles,
+		},
+	})
+}
+
+// GetRoleAssignments lists the users holding roles, filtered by ?role=
+func (h *AdminRoleHandler) GetRoleAssignments(c *gin.Context) {
+	assignments, err := h.roleService.GetRoleAssignments(c.Request.Context(), c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_ROLES",
+				"message": "Failed to retrieve role assignments",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"assignments": assignments,
+		},
+	})
+}
+
+// GrantRole gives a role to a user
+func (h *AdminRoleHandler) GrantRole(c *gin.Context) {
+	var req changeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	h.changeRole(c, true, req)
+}
+
+// RevokeRole takes the role in the path away from a user; ?reason= is recorded
+func (h *AdminRoleHandler) RevokeRole(c *gin.Context) {
+	h.changeRole(c, false, changeRoleRequest{
+		Role:   c.Param("role"),
+		Reason: c.Query("reason"),
+	})
+}
+
+func (h *AdminRoleHandler) changeRole(c *gin.Context, grant bool, req changeRoleRequest) {
+	adminID, _ := middleware.GetUserID(c)
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_USER_ID",
+				"message": "Invalid user ID",
+			},
+		})
+		return
+	}
+
+	if grant {
+		err = h.roleService.GrantRole(c.Request.Context(), uint(userID), req.Role, &adminID, req.Reason)
+	} else {
+		err = h.roleService.RevokeRole(c.Request.Context(), uint(userID), req.Role, &adminID, req.Reason)
+	}
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "NOT_FOUND",
+					"message": err.Error(),
+				},
+			})
+		case strings.Contains(err.Error(), "already has role"),
+			strings.Contains(err.Error(), "does not have role"),
+			strings.Contains(err.Error(), "last superadmin"):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "ROLE_CHANGE_CONFLICT",
+					"message": err.Error(),
+				},
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "FAILED_TO_CHANGE_ROLE",
+					"message": "Failed to change role",
+				},
+			})
+		}
+		return
+	}
+
+	roles, _ := h.roleService.GetUserRoles(c.Request.Context(), uint(userID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user_id": uint(userID),
+			"roles":   roles,
+		},
+	})
+}
+
+// GetAuditLog returns role changes, optionally for one user
+func (h *AdminRoleHandler) GetAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	var userID uint
+	if id, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		userID = uint(id)
+	}
+
+	entries, total, err := h.roleService.GetAuditLog(c.Request.Context(), userID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_AUDIT_LOG",
+				"message": "Failed to retrieve role audit log",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"entries": entries,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
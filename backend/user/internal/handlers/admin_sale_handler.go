@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminSaleHandler struct {
+	saleService *services.SaleService
+}
+
+func NewAdminSaleHandler(saleService *services.SaleService) *AdminSaleHandler {
+	return &AdminSaleHandler{saleService: saleService}
+}
+
+// GetSales lists flash sales; ?status= is running, scheduled or ended
+func (h *AdminSaleHandler) GetSales(c *gin.Context) {
+	limit, page := parseAdminPage(c)
+
+	sales, total, err := h.saleService.GetSales(c.Request.Context(), c.Query("status"), limit, (page-1)*limit)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid") {
+			respondSaleError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_SALES",
+				"message": "Failed to retrieve sales",
+			},
+		})
+		return
+	}
+
+	totalPages := (int(total) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sales": sales,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": totalPages,
+			},
+		},
+	})
+}
+
+func (h *AdminSaleHandler) GetSale(c *gin.Context) {
+	saleID, ok := parseCatalogID(c, "sale_id")
+	if !ok {
+		return
+	}
+
+	sale, err := h.saleService.GetSale(c.Request.Context(), saleID)
+	if err != nil {
+		respondSaleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sale": sale,
+		},
+	})
+}
+
+func (h *AdminSaleHandler) CreateSale(c *gin.Context) {
+	var input services.SaleInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	sale, err := h.saleService.CreateSale(c.Request.Context(), input, adminID)
+	if err != nil {
+		respondSaleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sale": sale,
+		},
+	})
+}
+
+func (h *AdminSaleHandler) UpdateSale(c *gin.Context) {
+	saleID, ok := parseCatalogID(c, "sale_id")
+	if !ok {
+		return
+	}
+
+	var input services.SaleInput
+	if !bindCatalogInput(c, &input) {
+		return
+	}
+
+	sale, err := h.saleService.UpdateSale(c.Request.Context(), saleID, input)
+	if err != nil {
+		respondSaleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sale": sale,
+		},
+	})
+}
+
+func (h *AdminSaleHandler) DeactivateSale(c *gin.Context) {
+	saleID, ok := parseCatalogID(c, "sale_id")
+	if !ok {
+		return
+	}
+
+	if err := h.saleService.DeactivateSale(c.Request.Context(), saleID); err != nil {
+		respondSaleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Sale deactivated",
+	})
+}
+
+func respondSaleError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "NOT_FOUND",
+				"message": err.Error(),
+			},
+		})
+	case strings.HasPrefix(err.Error(), "invalid"):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "VALIDATION_FAILED",
+				"message": err.Error(),
+			},
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "SALE_UPDATE_FAILED",
+				"message": "Failed to update sales",
+			},
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminTransactionHandler struct {
+	transactionService *services.TransactionService
+}
+
+func NewAdminTransactionHandler(transactionService *services.TransactionService) *AdminTransactionHandler {
+	return &AdminTransactionHandler{transactionService: transactionService}
+}
+
+// RefundTransaction returns the credits of a failed purchase to its buyer
+func (h *AdminTransactionHandler) RefundTransaction(c *gin.Context) {
+	transactionUUID := c.Param("transaction_uuid")
+
+	adminID, _ := middleware.GetUserID(c)
+	refund, err := h.transactionService.RefundTransaction(c.Request.Context(), transactionUUID, adminID)
+	if err != nil {
+		switch {
+		case err.Error() == "transaction not found":
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "TRANSACTION_NOT_FOUND",
+					"message": "Transaction not found",
+				},
+			})
+		case strings.Contains(err.Error(), "only failed transactions"),
+			strings.Contains(err.Error(), "partially delivered"),
+			strings.Contains(err.Error(), "already refunded"),
+			strings.Contains(err.Error(), "not refundable"):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "TRANSACTION_NOT_REFUNDABLE",
+					"message": err.Error(),
+				},
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "REFUND_FAILED",
+					"message": "Failed to refund transaction",
+				},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Transaction refunded",
+		"data": gin.H{
+			"transaction_id": transactionUUID,
+			"refund":         refund,
+		},
+	})
+}
@@ -146,6 +146,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 				"avatar_url":     user.AvatarURL,
 				"credit_balance": user.CreditBalance,
 				"loyalty_points": user.LoyaltyPoints,
+				"eos_id":         user.EOSID,
 				"created_at":     user.CreatedAt,
 				"last_login":     user.LastLogin,
 			},
@@ -153,6 +154,66 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	})
 }
 
+type updateEOSIDRequest struct {
+	EOSID string `json:"eos_id"`
+}
+
+// UpdateEOSID links or, with an empty eos_id, unlinks the player's EOS ID
+func (h *AuthHandler) UpdateEOSID(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "UNAUTHORIZED",
+				"message": "User not authenticated",
+			},
+		})
+		return
+	}
+
+	var req updateEOSIDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	user, err := h.userService.SetEOSID(c.Request.Context(), userID, strings.TrimSpace(req.EOSID))
+	if err != nil {
+		status, code := http.StatusInternalServerError, "EOS_ID_UPDATE_FAILED"
+		switch {
+		case strings.HasPrefix(err.Error(), "invalid eos id"):
+			status, code = http.StatusBadRequest, "INVALID_EOS_ID"
+		case strings.Contains(err.Error(), "already linked"):
+			status, code = http.StatusConflict, "EOS_ID_TAKEN"
+		case err.Error() == "user not found":
+			status, code = http.StatusNotFound, "USER_NOT_FOUND"
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    code,
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"eos_id": user.EOSID,
+		},
+	})
+}
+
 func (h *AuthHandler) Logout(c *gin.Context) {
 	// In a stateless JWT system, logout is handled client-side by removing the token
 	// Here we could add the token to a blacklist if needed
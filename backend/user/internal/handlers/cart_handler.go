@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CartHandler struct {
+	cartService *services.CartService
+}
+
+func NewCartHandler(cartService *services.CartService) *CartHandler {
+	return &CartHandler{cartService: cartService}
+}
+
+// GetCart returns the cart with current prices, availability and stock
+func (h *CartHandler) GetCart(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	h.respondCart(c, userID, http.StatusOK)
+}
+
+func (h *CartHandler) AddItem(c *gin.Context) {
+	var req services.AddCartItemRequest
+	if !bindCartRequest(c, &req) {
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	if err := h.cartService.AddItem(c.Request.Context(), userID, req); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.respondCart(c, userID, http.StatusCreated)
+}
+
+// UpdateItem changes the quantity or server of a cart line
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	cartID, ok := parseCartID(c)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateCartItemRequest
+	if !bindCartRequest(c, &req) {
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	if err := h.cartService.UpdateItem(c.Request.Context(), userID, cartID, req); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.respondCart(c, userID, http.StatusOK)
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	cartID, ok := parseCartID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	if err := h.cartService.RemoveItem(c.Request.Context(), userID, cartID); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.respondCart(c, userID, http.StatusOK)
+}
+
+func (h *CartHandler) ClearCart(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	if err := h.cartService.ClearCart(c.Request.Context(), userID); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.respondCart(c, userID, http.StatusOK)
+}
+
+// Checkout buys the whole cart. When prices changed since items were added it
+// responds 409 PRICE_CHANGED with the changes; repeat with
+// accept_price_changes to buy at the current prices.
+func (h *CartHandler) Checkout(c *gin.Context) {
+	var req services.CheckoutRequest
+	if c.Request.ContentLength != 0 && !bindCartRequest(c, &req) {
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	result, err := h.cartService.Checkout(c.Request.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrCartPriceChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "PRICE_CHANGED",
+					"message": "Prices have changed since items were added to the cart",
+				},
+				"data": result,
+			})
+			return
+		}
+
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+func (h *CartHandler) respondCart(c *gin.Context, userID uint, status int) {
+	cart, err := h.cartService.GetCart(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_CART",
+				"message": "Failed to retrieve cart",
+			},
+		})
+		return
+	}
+
+	lang := getLangShop(c)
+	for i := range cart.Lines {
+		localizeItem(&cart.Lines[i].Item, lang)
+	}
+
+	c.JSON(status, gin.H{
+		"success": true,
+		"data": gin.H{
+			"cart": cart,
+		},
+	})
+}
+
+func parseCartID(c *gin.Context) (uint, bool) {
+	cartID, err := strconv.ParseUint(c.Param("cart_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_CART_ID",
+				"message": "Invalid cart item ID",
+			},
+		})
+		return 0, false
+	}
+	return uint(cartID), true
+}
+
+func bindCartRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return false
+	}
+	return true
+}
+
+func respondCartError(c *gin.Context, err error) {
+	statusCode := http.StatusInternalServerError
+	errorCode := "CART_UPDATE_FAILED"
+	message := err.Error()
+
+	switch {
+	case strings.HasPrefix(message, "coupon "):
+		statusCode = http.StatusBadRequest
+		errorCode = "INVALID_COUPON"
+	case strings.Contains(message, "cart item not found"):
+		statusCode = http.StatusNotFound
+		errorCode = "CART_ITEM_NOT_FOUND"
+	case strings.Contains(message, "item not found"),
+		strings.Contains(message, "not found or inactive"):
+		statusCode = http.StatusNotFound
+		errorCode = "ITEM_NOT_FOUND"
+	case strings.Contains(message, "server not found"):
+		statusCode = http.StatusNotFound
+		errorCode = "SERVER_NOT_FOUND"
+	case strings.Contains(message, "not available on"):
+		statusCode = http.StatusBadRequest
+		errorCode = "ITEM_NOT_AVAILABLE"
+	case strings.Contains(message, "insufficient stock"):
+		statusCode = http.StatusBadRequest
+		errorCode = "OUT_OF_STOCK"
+	case strings.Contains(message, "insufficient credit"):
+		statusCode = http.StatusBadRequest
+		errorCode = "INSUFFICIENT_CREDITS"
+	case strings.HasPrefix(message, "invalid"),
+		strings.Contains(message, "cart is full"),
+		strings.Contains(message, "cart is empty"):
+		statusCode = http.StatusBadRequest
+		errorCode = "INVALID_CART"
+	case strings.Contains(message, "already in the cart"),
+		strings.Contains(message, "cart changed"):
+		statusCode = http.StatusConflict
+		errorCode = "CART_CONFLICT"
+	default:
+		message = "Failed to update cart"
+	}
+
+	c.JSON(statusCode, gin.H{
+		"success": false,
+		"error": map[string]interface{}{
+			"code":    errorCode,
+			"message": message,
+		},
+	})
+}
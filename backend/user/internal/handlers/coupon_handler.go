@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"nexark-user-backend/internal/middleware"
+	"nexark-user-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+}
+
+func NewCouponHandler(couponService *services.CouponService) *CouponHandler {
+	return &CouponHandler{couponService: couponService}
+}
+
+type validateCouponRequest struct {
+	Code  string                  `json:"code" binding:"required"`
+	Items []services.PurchaseItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// ValidateCoupon previews the discount a coupon gives on a basket without
+// using it
+func (h *CouponHandler) ValidateCoupon(c *gin.Context) {
+	var req validateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request data",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	preview, err := h.couponService.PreviewCoupon(c.Request.Context(), userID, req.Code, req.Items)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		errorCode := "FAILED_TO_VALIDATE_COUPON"
+		message := err.Error()
+
+		switch {
+		case strings.HasPrefix(message, "coupon "):
+			statusCode = http.StatusBadRequest
+			errorCode = "INVALID_COUPON"
+		case strings.Contains(message, "not found or inactive"):
+			statusCode = http.StatusNotFound
+			errorCode = "ITEM_NOT_FOUND"
+		case strings.Contains(message, "not available on"):
+			statusCode = http.StatusBadRequest
+			errorCode = "ITEM_NOT_AVAILABLE"
+		default:
+			message = "Failed to validate coupon"
+		}
+
+		c.JSON(statusCode, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    errorCode,
+				"message": message,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    preview,
+	})
+}
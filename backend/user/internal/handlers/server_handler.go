@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"nexark-user-backend/internal/models"
 	"nexark-user-backend/internal/services"
@@ -11,11 +13,15 @@ import (
 )
 
 type ServerHandler struct {
-	serverService *services.ServerService
+	serverService  *services.ServerService
+	historyService *services.ServerHistoryService
 }
 
-func NewServerHandler(serverService *services.ServerService) *ServerHandler {
-	return &ServerHandler{serverService: serverService}
+func NewServerHandler(serverService *services.ServerService, historyService *services.ServerHistoryService) *ServerHandler {
+	return &ServerHandler{
+		serverService:  serverService,
+		historyService: historyService,
+	}
 }
 
 func (h *ServerHandler) GetServers(c *gin.Context) {
@@ -176,3 +182,196 @@ func localizeServerDetails(server *models.Server, lang string) {
 		}
 	}
 }
+
+// GetRCONPoolStats reports RCON connection pool usage per server
+func (h *ServerHandler) GetRCONPoolStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"pools": h.serverService.RCONPoolStats(),
+		},
+	})
+}
+
+// QueryServer returns live map, version, player list and ping over Steam A2S
+func (h *ServerHandler) QueryServer(c *gin.Context) {
+	serverIDStr := c.Param("server_id")
+	server, err := h.serverService.GetServerByIdentifier(c.Request.Context(), serverIDStr)
+	if err != nil {
+		if err.Error() == "server not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "SERVER_NOT_FOUND",
+					"message": "Server not found",
+				},
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_SERVER",
+				"message": "Failed to retrieve server",
+			},
+		})
+		return
+	}
+
+	result, err := h.serverService.QueryServer(c.Request.Context(), server, c.Query("rules") == "true")
+	if err != nil {
+		if strings.Contains(err.Error(), "no query port") {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "QUERY_NOT_SUPPORTED",
+					"message": "Server does not support status queries",
+				},
+			})
+			return
+		}
+
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "SERVER_UNREACHABLE",
+				"message": "Server did not answer the status query",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"server_id": server.ServerID,
+			"query":     result,
+		},
+	})
+}
+
+// historyRanges are the presets accepted by the range query parameter
+var historyRanges = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+	"1y":  365 * 24 * time.Hour,
+}
+
+// parseHistoryRange reads either range=24h|7d|30d|90d|1y or from/to as RFC 3339
+// timestamps. Without either the last 24 hours are used.
+func parseHistoryRange(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from")
+		}
+		if toStr := c.Query("to"); toStr != "" {
+			to, err = time.Parse(time.RFC3339, toStr)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("invalid to")
+			}
+		}
+		if !from.Before(to) {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+		}
+		return from, to, nil
+	}
+
+	span, ok := historyRanges[c.DefaultQuery("range", "24h")]
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid range")
+	}
+	return to.Add(-span), to, nil
+}
+
+// getHistory resolves the server and range and loads its history, writing the
+// error response itself when it returns nil.
+func (h *ServerHandler) getHistory(c *gin.Context) *services.ServerHistory {
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_RANGE",
+				"message": "Range must be one of 24h, 7d, 30d, 90d, 1y or RFC 3339 from/to: " + err.Error(),
+			},
+		})
+		return nil
+	}
+
+	server, err := h.serverService.GetServerByIdentifier(c.Request.Context(), c.Param("server_id"))
+	if err != nil {
+		if err.Error() == "server not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "SERVER_NOT_FOUND",
+					"message": "Server not found",
+				},
+			})
+			return nil
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_SERVER",
+				"message": "Failed to retrieve server",
+			},
+		})
+		return nil
+	}
+
+	history, err := h.historyService.GetHistory(c.Request.Context(), server.ServerID, from, to, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "FAILED_TO_GET_HISTORY",
+				"message": "Failed to retrieve server history",
+			},
+		})
+		return nil
+	}
+
+	return history
+}
+
+// GetServerHistory returns player population and uptime over time
+func (h *ServerHandler) GetServerHistory(c *gin.Context) {
+	history := h.getHistory(c)
+	if history == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    history,
+	})
+}
+
+// GetServerUptime returns only the summary of the range
+func (h *ServerHandler) GetServerUptime(c *gin.Context) {
+	history := h.getHistory(c)
+	if history == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"server_id":      history.ServerID,
+			"from":           history.From,
+			"to":             history.To,
+			"uptime_percent": history.Summary.UptimePercent,
+			"avg_players":    history.Summary.AvgPlayers,
+			"peak_players":   history.Summary.PeakPlayers,
+			"samples":        history.Summary.Samples,
+		},
+	})
+}
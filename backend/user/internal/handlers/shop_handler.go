@@ -68,6 +68,11 @@ func (h *ShopHandler) GetItems(c *gin.Context) {
 	offset := (page - 1) * limit
 	featured := featuredStr == "true"
 
+	serverID, ok := parseServerFilter(c)
+	if !ok {
+		return
+	}
+
 	var items []models.Item
 	var total int64
 
@@ -84,9 +89,9 @@ func (h *ShopHandler) GetItems(c *gin.Context) {
 			return
 		}
 
-		items, total, err = h.shopService.GetItemsByCategory(c.Request.Context(), uint(categoryID), limit, offset)
+		items, total, err = h.shopService.GetItemsByCategory(c.Request.Context(), uint(categoryID), serverID, limit, offset)
 	} else {
-		items, total, err = h.shopService.GetAllItems(c.Request.Context(), limit, offset, featured)
+		items, total, err = h.shopService.GetAllItems(c.Request.Context(), serverID, limit, offset, featured)
 	}
 
 	if err != nil {
@@ -136,9 +141,14 @@ func (h *ShopHandler) GetItemByID(c *gin.Context) {
 		return
 	}
 
-	item, err := h.shopService.GetItemByID(c.Request.Context(), uint(itemID))
+	serverID, ok := parseServerFilter(c)
+	if !ok {
+		return
+	}
+
+	item, err := h.shopService.GetItemByID(c.Request.Context(), uint(itemID), serverID)
 	if err != nil {
-		if err.Error() == "item not found" {
+		if err.Error() == "item not found" || strings.Contains(err.Error(), "not available") {
 			c.JSON(http.StatusNotFound, gin.H{
 				"success": false,
 				"error": map[string]interface{}{
@@ -171,21 +181,47 @@ func (h *ShopHandler) GetItemByID(c *gin.Context) {
 	})
 }
 
+// parseServerFilter reads the optional ?server_id= of shop listings; 0 means
+// every server
+func parseServerFilter(c *gin.Context) (uint, bool) {
+	serverIDStr := c.Query("server_id")
+	if serverIDStr == "" {
+		return 0, true
+	}
+
+	serverID, err := strconv.ParseUint(serverIDStr, 10, 32)
+	if err != nil || serverID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "INVALID_SERVER_ID",
+				"message": "Invalid server ID",
+			},
+		})
+		return 0, false
+	}
+
+	return uint(serverID), true
+}
+
 // BuyItemRequest represents the request payload for buying an item
 type BuyItemRequest struct {
-	ItemID   uint  `json:"item_id" binding:"required"`
-	ServerID *uint `json:"server_id"`
+	ItemID     uint   `json:"item_id" binding:"required"`
+	ServerID   *uint  `json:"server_id"`
+	CouponCode string `json:"coupon_code"`
 }
 
 // UnmarshalJSON supports both snake_case and camelCase fields for BuyItemRequest
 func (r *BuyItemRequest) UnmarshalJSON(data []byte) error {
 	type Alias struct {
-		ItemID   *uint `json:"item_id"`
-		ServerID *uint `json:"server_id"`
+		ItemID     *uint  `json:"item_id"`
+		ServerID   *uint  `json:"server_id"`
+		CouponCode string `json:"coupon_code"`
 
 		// camelCase fallbacks
-		ItemId   *uint `json:"itemId"`
-		ServerId *uint `json:"serverId"`
+		ItemId        *uint  `json:"itemId"`
+		ServerId      *uint  `json:"serverId"`
+		CouponCodeAlt string `json:"couponCode"`
 	}
 	var a Alias
 	if err := json.Unmarshal(data, &a); err != nil {
@@ -210,6 +246,12 @@ func (r *BuyItemRequest) UnmarshalJSON(data []byte) error {
 	} else {
 		r.ServerID = a.ServerId
 	}
+
+	// Resolve optional coupon code
+	r.CouponCode = a.CouponCode
+	if r.CouponCode == "" {
+		r.CouponCode = a.CouponCodeAlt
+	}
 	return nil
 }
 
@@ -218,6 +260,7 @@ type GiftItemRequest struct {
 	ItemID           uint   `json:"item_id" binding:"required"`
 	RecipientSteamID string `json:"recipient_steam_id" binding:"required"`
 	ServerID         *uint  `json:"server_id"`
+	CouponCode       string `json:"coupon_code"`
 }
 
 // UnmarshalJSON supports both snake_case and camelCase fields for GiftItemRequest
@@ -226,11 +269,13 @@ func (r *GiftItemRequest) UnmarshalJSON(data []byte) error {
 		ItemID           *uint  `json:"item_id"`
 		RecipientSteamID string `json:"recipient_steam_id"`
 		ServerID         *uint  `json:"server_id"`
+		CouponCode       string `json:"coupon_code"`
 
 		// camelCase fallbacks
 		ItemId           *uint  `json:"itemId"`
 		RecipientSteamId string `json:"recipientSteamId"`
 		ServerId         *uint  `json:"serverId"`
+		CouponCodeAlt    string `json:"couponCode"`
 	}
 	var a Alias
 	if err := json.Unmarshal(data, &a); err != nil {
@@ -266,6 +311,11 @@ func (r *GiftItemRequest) UnmarshalJSON(data []byte) error {
 		r.ServerID = a.ServerId
 	}
 
+	// Resolve optional coupon code
+	r.CouponCode = a.CouponCode
+	if r.CouponCode == "" {
+		r.CouponCode = a.CouponCodeAlt
+	}
 	return nil
 }
 
@@ -296,16 +346,25 @@ func (h *ShopHandler) BuyItem(c *gin.Context) {
 		return
 	}
 
-	err := h.shopService.BuyItem(c.Request.Context(), userID.(uint), req.ItemID, req.ServerID)
+	transaction, err := h.shopService.BuyItem(c.Request.Context(), userID.(uint), req.ItemID, req.ServerID, req.CouponCode)
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		errorCode := "PURCHASE_FAILED"
 
 		msg := err.Error()
 		switch {
+		case strings.HasPrefix(msg, "coupon "):
+			statusCode = http.StatusBadRequest
+			errorCode = "INVALID_COUPON"
 		case strings.Contains(msg, "item not found"):
 			statusCode = http.StatusNotFound
 			errorCode = "ITEM_NOT_FOUND"
+		case strings.Contains(msg, "server not found"):
+			statusCode = http.StatusNotFound
+			errorCode = "SERVER_NOT_FOUND"
+		case strings.Contains(msg, "not available on this server"):
+			statusCode = http.StatusBadRequest
+			errorCode = "ITEM_NOT_AVAILABLE"
 		case strings.Contains(msg, "out of stock"):
 			statusCode = http.StatusBadRequest
 			errorCode = "OUT_OF_STOCK"
@@ -326,7 +385,11 @@ func (h *ShopHandler) BuyItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Item purchased successfully",
+		"message": "Item purchased successfully. It is being delivered.",
+		"data": gin.H{
+			"transaction_id": transaction.TransactionUUID,
+			"status":         transaction.Status,
+		},
 	})
 }
 
@@ -357,16 +420,25 @@ func (h *ShopHandler) GiftItem(c *gin.Context) {
 		return
 	}
 
-	err := h.shopService.GiftItem(c.Request.Context(), userID.(uint), req.ItemID, req.RecipientSteamID, req.ServerID)
+	transaction, err := h.shopService.GiftItem(c.Request.Context(), userID.(uint), req.ItemID, req.RecipientSteamID, req.ServerID, req.CouponCode)
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		errorCode := "GIFT_FAILED"
 
 		msg := err.Error()
 		switch {
+		case strings.HasPrefix(msg, "coupon "):
+			statusCode = http.StatusBadRequest
+			errorCode = "INVALID_COUPON"
 		case strings.Contains(msg, "item not found"):
 			statusCode = http.StatusNotFound
 			errorCode = "ITEM_NOT_FOUND"
+		case strings.Contains(msg, "server not found"):
+			statusCode = http.StatusNotFound
+			errorCode = "SERVER_NOT_FOUND"
+		case strings.Contains(msg, "not available on this server"):
+			statusCode = http.StatusBadRequest
+			errorCode = "ITEM_NOT_AVAILABLE"
 		case strings.Contains(msg, "out of stock"):
 			statusCode = http.StatusBadRequest
 			errorCode = "OUT_OF_STOCK"
@@ -390,7 +462,12 @@ func (h *ShopHandler) GiftItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Item gifted successfully",
+		"message": "Item gifted successfully. It is being delivered.",
+		"data": gin.H{
+			"transaction_id":     transaction.TransactionUUID,
+			"status":             transaction.Status,
+			"recipient_steam_id": transaction.RecipientSteamID,
+		},
 	})
 }
 
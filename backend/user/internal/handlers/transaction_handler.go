@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"nexark-user-backend/internal/middleware"
 	"nexark-user-backend/internal/services"
@@ -174,3 +175,59 @@ func (h *TransactionHandler) GetTransactionByID(c *gin.Context) {
 		},
 	})
 }
+
+func (h *TransactionHandler) RetryDelivery(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "UNAUTHORIZED",
+				"message": "User not authenticated",
+			},
+		})
+		return
+	}
+
+	transactionUUID := c.Param("transaction_uuid")
+
+	transaction, err := h.transactionService.RetryDelivery(c.Request.Context(), userID, transactionUUID)
+	if err != nil {
+		switch {
+		case err.Error() == "transaction not found":
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "TRANSACTION_NOT_FOUND",
+					"message": "Transaction not found",
+				},
+			})
+		case strings.Contains(err.Error(), "only failed deliveries"):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "DELIVERY_NOT_RETRYABLE",
+					"message": "Only failed deliveries can be retried",
+				},
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "RETRY_FAILED",
+					"message": "Failed to retry delivery",
+				},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Delivery has been queued again",
+		"data": gin.H{
+			"transaction_id": transaction.TransactionUUID,
+			"status":         transaction.Status,
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions checked by the admin routes
+const (
+	PermissionAdminAccess        = "admin.access"
+	PermissionServersMonitor     = "servers.monitor"
+	PermissionRCONExecute        = "rcon.execute"
+	PermissionRCONHistory        = "rcon.history"
+	PermissionRolesView          = "roles.view"
+	PermissionRolesManage        = "roles.manage"
+	PermissionShopManage         = "shop.manage"
+	PermissionCouponsManage      = "coupons.manage"
+	PermissionLedgerReconcile    = "ledger.reconcile"
+	PermissionPaymentsRefund     = "payments.refund"
+	PermissionTransactionsRefund = "transactions.refund"
+)
+
+// PermissionResolver looks up the permissions a user holds through their roles
+type PermissionResolver interface {
+	GetUserPermissions(ctx context.Context, userID uint) ([]string, error)
+}
+
+type AdminMiddleware struct {
+	permissions PermissionResolver
+}
+
+func NewAdminMiddleware(permissions PermissionResolver) *AdminMiddleware {
+	return &AdminMiddleware{permissions: permissions}
+}
+
+// RequirePermission must run after RequireAuth. Permissions are resolved once
+// per request and kept in the context for later checks.
+func (a *AdminMiddleware) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := GetUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "UNAUTHORIZED",
+					"message": "User not authenticated",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		permissions, loaded := getPermissions(c)
+		if !loaded {
+			var err error
+			permissions, err = a.permissions.GetUserPermissions(c.Request.Context(), userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"error": map[string]interface{}{
+						"code":    "FAILED_TO_GET_PERMISSIONS",
+						"message": "Failed to check permissions",
+					},
+				})
+				c.Abort()
+				return
+			}
+			c.Set("permissions", permissions)
+		}
+
+		if !hasPermission(permissions, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "FORBIDDEN",
+					"message": "Missing permission " + permission,
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetPermissions returns the permissions resolved by RequirePermission
+func GetPermissions(c *gin.Context) []string {
+	permissions, _ := getPermissions(c)
+	return permissions
+}
+
+func getPermissions(c *gin.Context) ([]string, bool) {
+	permissions, exists := c.Get("permissions")
+	if !exists {
+		return nil, false
+	}
+	return permissions.([]string), true
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
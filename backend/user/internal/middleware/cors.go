@@ -24,6 +24,10 @@ func CORS() gin.HandlerFunc {
 		"Accept",
 		"Cache-Control",
 		"X-Request-ID",
+		IdempotencyKeyHeader,
+	}
+	config.ExposeHeaders = []string{
+		"Idempotent-Replayed",
 	}
 	config.AllowMethods = []string{
 		"GET",
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the request header naming an idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyStore keeps the first response to each user's idempotency key
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, userID uint, key, requestHash string) (status int, body []byte, replay bool, err error)
+	Complete(ctx context.Context, userID uint, key string, status int, body []byte) error
+	Release(ctx context.Context, userID uint, key string) error
+}
+
+type IdempotencyMiddleware struct {
+	store IdempotencyStore
+}
+
+func NewIdempotencyMiddleware(store IdempotencyStore) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{store: store}
+}
+
+// Idempotent must run after RequireAuth. Requests with an Idempotency-Key
+// header run once per user and key: retries get the stored response, and
+// reusing the key for a different request is rejected. Server errors are not
+// stored, so the request can be retried with the same key.
+func (m *IdempotencyMiddleware) Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		userID, exists := GetUserID(c)
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "UNAUTHORIZED",
+					"message": "User not authenticated",
+				},
+			})
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "INVALID_IDEMPOTENCY_KEY",
+					"message": "Idempotency-Key must be at most 255 characters",
+				},
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": map[string]interface{}{
+					"code":    "INVALID_REQUEST",
+					"message": "Failed to read request body",
+				},
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		status, stored, replay, err := m.store.Reserve(c.Request.Context(), userID, key, requestHash(c.Request, body))
+		if err != nil {
+			respondIdempotencyError(c, err)
+			return
+		}
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(status, "application/json; charset=utf-8", stored)
+			c.Abort()
+			return
+		}
+
+		// The request may be cancelled by the client while it runs; the key must
+		// still be completed or released
+		finished := false
+		defer func() {
+			if !finished {
+				if err := m.store.Release(context.Background(), userID, key); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+		if err := m.store.Complete(context.Background(), userID, key, writer.Status(), writer.body.Bytes()); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+			return
+		}
+		finished = true
+	}
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func respondIdempotencyError(c *gin.Context, err error) {
+	switch {
+	case strings.Contains(err.Error(), "different request"):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "IDEMPOTENCY_KEY_REUSED",
+				"message": "Idempotency-Key was already used for a different request",
+			},
+		})
+	case strings.Contains(err.Error(), "in progress"):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "IDEMPOTENCY_KEY_IN_USE",
+				"message": "A request with this Idempotency-Key is still being processed",
+			},
+		})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    "IDEMPOTENCY_CHECK_FAILED",
+				"message": "Failed to check Idempotency-Key",
+			},
+		})
+	}
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -6,20 +6,24 @@ import (
 	"strconv"
 
 	errors "nexark-user-backend/internal/error"
+	"nexark-user-backend/pkg/money"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Validate amount parameters
-func ValidateAmount(min, max float64) gin.HandlerFunc {
+// Validate amount parameters. The amount must have at most two decimals.
+func ValidateAmount(min, max money.Amount) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		amountStr := c.PostForm("amount")
 		if amountStr == "" {
 			// Try JSON body
 			var body map[string]interface{}
 			if err := c.ShouldBindJSON(&body); err == nil {
-				if amount, ok := body["amount"]; ok {
-					amountStr = fmt.Sprintf("%v", amount)
+				switch amount := body["amount"].(type) {
+				case float64:
+					amountStr = strconv.FormatFloat(amount, 'f', -1, 64)
+				case string:
+					amountStr = amount
 				}
 			}
 		}
@@ -30,7 +34,7 @@ func ValidateAmount(min, max float64) gin.HandlerFunc {
 			return
 		}
 
-		amount, err := strconv.ParseFloat(amountStr, 64)
+		amount, err := money.Parse(amountStr)
 		if err != nil {
 			c.AbortWithError(http.StatusBadRequest,
 				errors.NewValidationError("INVALID_AMOUNT", "Amount must be a valid number", nil))
@@ -40,16 +44,16 @@ func ValidateAmount(min, max float64) gin.HandlerFunc {
 		if amount < min {
 			c.AbortWithError(http.StatusBadRequest,
 				errors.NewValidationError("AMOUNT_TOO_LOW",
-					fmt.Sprintf("Amount must be at least %.2f", min),
-					map[string]float64{"minimum": min, "provided": amount}))
+					fmt.Sprintf("Amount must be at least %s", min),
+					map[string]money.Amount{"minimum": min, "provided": amount}))
 			return
 		}
 
 		if amount > max {
 			c.AbortWithError(http.StatusBadRequest,
 				errors.NewValidationError("AMOUNT_TOO_HIGH",
-					fmt.Sprintf("Amount must not exceed %.2f", max),
-					map[string]float64{"maximum": max, "provided": amount}))
+					fmt.Sprintf("Amount must not exceed %s", max),
+					map[string]money.Amount{"maximum": max, "provided": amount}))
 			return
 		}
 
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"nexark-user-backend/pkg/money"
+)
+
+// Coupon discount types
+const (
+	CouponTypePercentage = "percentage"
+	CouponTypeFixed      = "fixed"
+)
+
+// Coupon is a discount code. ItemID, CategoryID and ServerID limit the lines
+// it applies to; MinOrderAmount is checked against the total of those lines.
+// MaxDiscount caps percentage discounts. For percentage coupons DiscountValue
+// is the percentage, with two decimals like an amount.
+type Coupon struct {
+	CouponID       uint          `gorm:"primaryKey;column:coupon_id" json:"coupon_id"`
+	Code           string        `gorm:"column:code" json:"code"`
+	Description    *string       `gorm:"column:description" json:"description"`
+	DiscountType   string        `gorm:"column:discount_type" json:"discount_type"`
+	DiscountValue  money.Amount  `gorm:"column:discount_value" json:"discount_value"`
+	MaxDiscount    *money.Amount `gorm:"column:max_discount" json:"max_discount"`
+	ItemID         *uint         `gorm:"column:item_id" json:"item_id"`
+	CategoryID     *uint         `gorm:"column:category_id" json:"category_id"`
+	ServerID       *uint         `gorm:"column:server_id" json:"server_id"`
+	MinOrderAmount *money.Amount `gorm:"column:min_order_amount" json:"min_order_amount"`
+	MaxUses        *int          `gorm:"column:max_uses" json:"max_uses"`
+	MaxUsesPerUser *int          `gorm:"column:max_uses_per_user" json:"max_uses_per_user"`
+	UsesCount      int           `gorm:"column:uses_count;default:0" json:"uses_count"`
+	StartsAt       *time.Time    `gorm:"column:starts_at" json:"starts_at"`
+	EndsAt         *time.Time    `gorm:"column:ends_at" json:"ends_at"`
+	IsActive       bool          `gorm:"column:is_active;default:true" json:"is_active"`
+	CreatedBy      *uint         `gorm:"column:created_by" json:"created_by"`
+	CreatedAt      time.Time     `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time     `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Coupon) TableName() string {
+	return "coupons"
+}
+
+// CouponRedemption is one purchase that used a coupon. TransactionID is the
+// first transaction of the purchase.
+type CouponRedemption struct {
+	RedemptionID   uint         `gorm:"primaryKey;column:redemption_id" json:"redemption_id"`
+	CouponID       uint         `gorm:"column:coupon_id" json:"coupon_id"`
+	UserID         uint         `gorm:"column:user_id" json:"user_id"`
+	TransactionID  uint         `gorm:"column:transaction_id" json:"transaction_id"`
+	DiscountAmount money.Amount `gorm:"column:discount_amount" json:"discount_amount"`
+	CreatedAt      time.Time    `gorm:"column:created_at" json:"created_at"`
+}
+
+func (CouponRedemption) TableName() string {
+	return "coupon_redemptions"
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Idempotency key statuses
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyKey is a request made with an Idempotency-Key header. Once the
+// request finishes its response is kept until ExpiresAt and replayed for
+// retries with the same key.
+type IdempotencyKey struct {
+	IdempotencyID  uint64     `gorm:"primaryKey;column:idempotency_id" json:"idempotency_id"`
+	UserID         uint       `gorm:"column:user_id" json:"user_id"`
+	Key            string     `gorm:"column:idempotency_key" json:"idempotency_key"`
+	RequestHash    string     `gorm:"column:request_hash" json:"request_hash"`
+	Status         string     `gorm:"column:status;default:processing" json:"status"`
+	ResponseStatus *int       `gorm:"column:response_status" json:"response_status"`
+	ResponseBody   []byte     `gorm:"column:response_body" json:"-"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+	CompletedAt    *time.Time `gorm:"column:completed_at" json:"completed_at"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at" json:"expires_at"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
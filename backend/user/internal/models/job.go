@@ -13,6 +13,7 @@ const (
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
 	JobStatusCancelled  JobStatus = "cancelled"
+	JobStatusDeadLetter JobStatus = "dead_letter"
 )
 
 // JobType represents different types of background jobs
@@ -25,6 +26,7 @@ const (
 	JobTypeLoyaltyPointsAward JobType = "loyalty_points_award"
 	JobTypeServerStatusCheck  JobType = "server_status_check"
 	JobTypePaymentReminder    JobType = "payment_reminder"
+	JobTypeItemDelivery       JobType = "item_delivery"
 )
 
 // Job represents a background job
@@ -41,6 +43,7 @@ type Job struct {
 	CreatedAt    time.Time  `gorm:"column:created_at" json:"created_at"`
 	ProcessAt    time.Time  `gorm:"column:process_at" json:"process_at"`
 	StartedAt    *time.Time `gorm:"column:started_at" json:"started_at"`
+	LockedUntil  *time.Time `gorm:"column:locked_until" json:"locked_until"`
 	CompletedAt  *time.Time `gorm:"column:completed_at" json:"completed_at"`
 	CreatedBy    *uint      `gorm:"column:created_by" json:"created_by"`
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"nexark-user-backend/pkg/money"
 )
 
 // JSON type for MySQL
@@ -31,23 +33,24 @@ func (j *JSON) Scan(value interface{}) error {
 }
 
 type Payment struct {
-	PaymentID             uint       `gorm:"primaryKey;column:payment_id" json:"payment_id"`
-	PaymentUUID           string     `gorm:"uniqueIndex;column:payment_uuid" json:"payment_uuid"`
-	UserID                uint       `gorm:"column:user_id" json:"user_id"`
-	StripePaymentIntentID *string    `gorm:"uniqueIndex;column:stripe_payment_intent_id" json:"stripe_payment_intent_id"`
-	StripePaymentMethodID *string    `gorm:"column:stripe_payment_method_id" json:"stripe_payment_method_id"`
-	Amount                float64    `gorm:"column:amount" json:"amount"`
-	Currency              string     `gorm:"column:currency;default:THB" json:"currency"`
-	PaymentMethod         string     `gorm:"column:payment_method" json:"payment_method"`
-	PaymentStatus         string     `gorm:"column:payment_status;default:pending" json:"payment_status"`
-	StripeClientSecret    *string    `gorm:"column:stripe_client_secret" json:"stripe_client_secret"`
-	StripeCharges         JSON       `gorm:"column:stripe_charges" json:"stripe_charges"`
-	Metadata              JSON       `gorm:"column:metadata" json:"metadata"`
-	FailureReason         *string    `gorm:"column:failure_reason" json:"failure_reason"`
-	StripeWebhookData     JSON       `gorm:"column:stripe_webhook_data" json:"stripe_webhook_data"`
-	CreatedAt             time.Time  `gorm:"column:created_at" json:"created_at"`
-	ConfirmedAt           *time.Time `gorm:"column:confirmed_at" json:"confirmed_at"`
-	ExpiresAt             *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	PaymentID             uint         `gorm:"primaryKey;column:payment_id" json:"payment_id"`
+	PaymentUUID           string       `gorm:"uniqueIndex;column:payment_uuid" json:"payment_uuid"`
+	UserID                uint         `gorm:"column:user_id" json:"user_id"`
+	StripePaymentIntentID *string      `gorm:"uniqueIndex;column:stripe_payment_intent_id" json:"stripe_payment_intent_id"`
+	StripePaymentMethodID *string      `gorm:"column:stripe_payment_method_id" json:"stripe_payment_method_id"`
+	Amount                money.Amount `gorm:"column:amount" json:"amount"`
+	RefundedAmount        money.Amount `gorm:"column:refunded_amount" json:"refunded_amount"`
+	Currency              string       `gorm:"column:currency;default:THB" json:"currency"`
+	PaymentMethod         string       `gorm:"column:payment_method" json:"payment_method"`
+	PaymentStatus         string       `gorm:"column:payment_status;default:pending" json:"payment_status"`
+	StripeClientSecret    *string      `gorm:"column:stripe_client_secret" json:"stripe_client_secret"`
+	StripeCharges         JSON         `gorm:"column:stripe_charges" json:"stripe_charges"`
+	Metadata              JSON         `gorm:"column:metadata" json:"metadata"`
+	FailureReason         *string      `gorm:"column:failure_reason" json:"failure_reason"`
+	StripeWebhookData     JSON         `gorm:"column:stripe_webhook_data" json:"stripe_webhook_data"`
+	CreatedAt             time.Time    `gorm:"column:created_at" json:"created_at"`
+	ConfirmedAt           *time.Time   `gorm:"column:confirmed_at" json:"confirmed_at"`
+	ExpiresAt             *time.Time   `gorm:"column:expires_at" json:"expires_at"`
 
 	// Relations
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -57,6 +60,41 @@ func (Payment) TableName() string {
 	return "payments"
 }
 
+// Payment refund statuses and sources
+const (
+	RefundProcessing = "processing"
+	RefundCompleted  = "completed"
+	RefundFailed     = "failed"
+
+	RefundSourceAdmin  = "admin"
+	RefundSourceStripe = "stripe"
+)
+
+// PaymentRefund is a Stripe refund of a top-up, made by an admin or from the
+// Stripe dashboard. CreditsClawedBack is what was taken back from the user's
+// balance; Shortfall is the rest, which their balance could not cover.
+type PaymentRefund struct {
+	RefundID            uint         `gorm:"primaryKey;column:refund_id" json:"refund_id"`
+	PaymentID           uint         `gorm:"column:payment_id" json:"payment_id"`
+	UserID              uint         `gorm:"column:user_id" json:"user_id"`
+	StripeRefundID      *string      `gorm:"column:stripe_refund_id" json:"stripe_refund_id"`
+	Amount              money.Amount `gorm:"column:amount" json:"amount"`
+	CreditsClawedBack   money.Amount `gorm:"column:credits_clawed_back" json:"credits_clawed_back"`
+	Shortfall           money.Amount `gorm:"column:shortfall" json:"shortfall"`
+	Status              string       `gorm:"column:status;default:processing" json:"status"`
+	Source              string       `gorm:"column:source;default:admin" json:"source"`
+	Reason              *string      `gorm:"column:reason" json:"reason"`
+	Note                *string      `gorm:"column:note" json:"note"`
+	FailureReason       *string      `gorm:"column:failure_reason" json:"failure_reason,omitempty"`
+	CreditTransactionID *uint        `gorm:"column:credit_transaction_id" json:"credit_transaction_id"`
+	CreatedBy           *uint        `gorm:"column:created_by" json:"created_by"`
+	CreatedAt           time.Time    `gorm:"column:created_at" json:"created_at"`
+}
+
+func (PaymentRefund) TableName() string {
+	return "payment_refunds"
+}
+
 type UserPaymentMethod struct {
 	PaymentMethodID       uint      `gorm:"primaryKey;column:payment_method_id" json:"payment_method_id"`
 	UserID                uint      `gorm:"column:user_id" json:"user_id"`
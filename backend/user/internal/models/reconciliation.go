@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Reconciliation run statuses
+const (
+	ReconciliationRunning   = "running"
+	ReconciliationCompleted = "completed"
+	ReconciliationFailed    = "failed"
+)
+
+// Reconciliation issue types
+const (
+	IssueCreditBalanceDrift    = "credit_balance_drift"
+	IssueLoyaltyPointsDrift    = "loyalty_points_drift"
+	IssueCreditChainBreak      = "credit_chain_break"
+	IssueLoyaltyChainBreak     = "loyalty_chain_break"
+	IssuePaymentMissingDeposit = "payment_missing_deposit"
+	IssueDepositAmountMismatch = "deposit_amount_mismatch"
+	IssueDuplicateDeposit      = "duplicate_deposit"
+	IssueOrphanDeposit         = "orphan_deposit"
+)
+
+// Reconciliation issue statuses
+const (
+	IssueStatusOpen     = "open"
+	IssueStatusResolved = "resolved"
+	IssueStatusIgnored  = "ignored"
+)
+
+// ReconciliationRun is one pass of the ledger reconciliation job.
+// TriggeredBy is nil for scheduled runs.
+type ReconciliationRun struct {
+	RunID           uint       `gorm:"primaryKey;column:run_id" json:"run_id"`
+	Status          string     `gorm:"column:status;default:running" json:"status"`
+	UsersChecked    int        `gorm:"column:users_checked" json:"users_checked"`
+	EntriesChecked  int        `gorm:"column:entries_checked" json:"entries_checked"`
+	PaymentsChecked int        `gorm:"column:payments_checked" json:"payments_checked"`
+	IssueCount      int        `gorm:"column:issue_count" json:"issue_count"`
+	ErrorMessage    *string    `gorm:"column:error_message" json:"error_message,omitempty"`
+	TriggeredBy     *uint      `gorm:"column:triggered_by" json:"triggered_by"`
+	StartedAt       time.Time  `gorm:"column:started_at;autoCreateTime" json:"started_at"`
+	FinishedAt      *time.Time `gorm:"column:finished_at" json:"finished_at"`
+}
+
+func (ReconciliationRun) TableName() string {
+	return "reconciliation_runs"
+}
+
+// ReconciliationIssue is a discrepancy found by a run. Expected and Actual are
+// formatted values: amounts for credit issues and points for loyalty issues.
+type ReconciliationIssue struct {
+	IssueID             uint       `gorm:"primaryKey;column:issue_id" json:"issue_id"`
+	RunID               uint       `gorm:"column:run_id" json:"run_id"`
+	IssueType           string     `gorm:"column:issue_type" json:"issue_type"`
+	UserID              *uint      `gorm:"column:user_id" json:"user_id"`
+	CreditTransactionID *uint      `gorm:"column:credit_transaction_id" json:"credit_transaction_id,omitempty"`
+	PointTransactionID  *uint      `gorm:"column:point_transaction_id" json:"point_transaction_id,omitempty"`
+	PaymentID           *uint      `gorm:"column:payment_id" json:"payment_id,omitempty"`
+	Expected            *string    `gorm:"column:expected" json:"expected"`
+	Actual              *string    `gorm:"column:actual" json:"actual"`
+	Details             string     `gorm:"column:details" json:"details"`
+	Status              string     `gorm:"column:status;default:open" json:"status"`
+	ResolutionNote      *string    `gorm:"column:resolution_note" json:"resolution_note"`
+	ResolvedBy          *uint      `gorm:"column:resolved_by" json:"resolved_by"`
+	ResolvedAt          *time.Time `gorm:"column:resolved_at" json:"resolved_at"`
+	CreatedAt           time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (ReconciliationIssue) TableName() string {
+	return "reconciliation_issues"
+}
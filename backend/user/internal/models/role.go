@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// RoleSuperadmin holds every permission without role_permissions rows
+const RoleSuperadmin = "superadmin"
+
+// Role audit actions
+const (
+	RoleActionGrant  = "grant"
+	RoleActionRevoke = "revoke"
+)
+
+type Role struct {
+	RoleKey     string    `gorm:"primaryKey;column:role_key" json:"role_key"`
+	Name        string    `gorm:"column:name" json:"name"`
+	Description *string   `gorm:"column:description" json:"description"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+
+	// Permissions is filled in by RoleService
+	Permissions []string `gorm:"-" json:"permissions"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+type Permission struct {
+	PermissionKey string    `gorm:"primaryKey;column:permission_key" json:"permission_key"`
+	Description   *string   `gorm:"column:description" json:"description"`
+	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+type RolePermission struct {
+	RoleKey       string `gorm:"primaryKey;column:role_key" json:"role_key"`
+	PermissionKey string `gorm:"primaryKey;column:permission_key" json:"permission_key"`
+}
+
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// UserRole grants an admin role to a user
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey;column:user_id" json:"user_id"`
+	Role      string    `gorm:"primaryKey;column:role" json:"role"`
+	GrantedBy *uint     `gorm:"column:granted_by" json:"granted_by"`
+	GrantedAt time.Time `gorm:"column:granted_at;autoCreateTime" json:"granted_at"`
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// RoleAuditLog records a role being granted to or revoked from a user
+type RoleAuditLog struct {
+	AuditID     uint64    `gorm:"primaryKey;column:audit_id" json:"audit_id"`
+	UserID      uint      `gorm:"column:user_id" json:"user_id"`
+	RoleKey     string    `gorm:"column:role_key" json:"role_key"`
+	Action      string    `gorm:"column:action" json:"action"`
+	PerformedBy *uint     `gorm:"column:performed_by" json:"performed_by"`
+	Reason      *string   `gorm:"column:reason" json:"reason"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (RoleAuditLog) TableName() string {
+	return "role_audit_log"
+}
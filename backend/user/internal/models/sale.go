@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"nexark-user-backend/pkg/money"
+)
+
+// Flash sale target types
+const (
+	SaleTargetItem     = "item"
+	SaleTargetCategory = "category"
+)
+
+// FlashSale takes a percentage or fixed amount off the price of its targets
+// between StartsAt and EndsAt. DiscountType uses the coupon discount types,
+// and DiscountValue is read the same way as a coupon's.
+type FlashSale struct {
+	SaleID        uint         `gorm:"primaryKey;column:sale_id" json:"sale_id"`
+	Name          string       `gorm:"column:name" json:"name"`
+	DiscountType  string       `gorm:"column:discount_type" json:"discount_type"`
+	DiscountValue money.Amount `gorm:"column:discount_value" json:"discount_value"`
+	StartsAt      time.Time    `gorm:"column:starts_at" json:"starts_at"`
+	EndsAt        time.Time    `gorm:"column:ends_at" json:"ends_at"`
+	IsActive      bool         `gorm:"column:is_active;default:true" json:"is_active"`
+	CreatedBy     *uint        `gorm:"column:created_by" json:"created_by"`
+	CreatedAt     time.Time    `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time    `gorm:"column:updated_at" json:"updated_at"`
+
+	// Relations
+	Targets []FlashSaleTarget `gorm:"foreignKey:SaleID" json:"targets"`
+}
+
+func (FlashSale) TableName() string {
+	return "flash_sales"
+}
+
+// Covers reports whether the sale targets an item in a category
+func (f *FlashSale) Covers(itemID, categoryID uint) bool {
+	for _, target := range f.Targets {
+		if target.TargetType == SaleTargetItem && target.TargetID == itemID ||
+			target.TargetType == SaleTargetCategory && target.TargetID == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+type FlashSaleTarget struct {
+	SaleID     uint   `gorm:"primaryKey;column:sale_id" json:"-"`
+	TargetType string `gorm:"primaryKey;column:target_type" json:"target_type"`
+	TargetID   uint   `gorm:"primaryKey;column:target_id" json:"target_id"`
+}
+
+func (FlashSaleTarget) TableName() string {
+	return "flash_sale_targets"
+}
@@ -58,6 +58,7 @@ type Server struct {
 	IPAddress      string     `gorm:"column:ip_address" json:"ip_address"`
 	Port           int        `gorm:"column:port" json:"port"`
 	RCONPort       int        `gorm:"column:rcon_port" json:"rcon_port"`
+	QueryPort      *int       `gorm:"column:query_port" json:"query_port"`
 	RCONPassword   string     `gorm:"column:rcon_password" json:"-"`
 	IsOnline       bool       `gorm:"column:is_online;default:false" json:"is_online"`
 	CurrentPlayers int        `gorm:"column:current_players;default:0" json:"current_players"`
@@ -118,6 +119,72 @@ func (RCONCommandHistory) TableName() string {
 	return "rcon_command_history"
 }
 
+// RCON command policy effects
+const (
+	RCONPolicyAllow = "allow"
+	RCONPolicyDeny  = "deny"
+)
+
+// RCONCommandPolicy allows or denies console commands matching Pattern to an
+// admin role. Patterns match the command name case-insensitively and may use
+// * wildcards.
+type RCONCommandPolicy struct {
+	PolicyID  uint      `gorm:"primaryKey;column:policy_id" json:"policy_id"`
+	Role      string    `gorm:"column:role" json:"role"`
+	Pattern   string    `gorm:"column:pattern" json:"pattern"`
+	Effect    string    `gorm:"column:effect" json:"effect"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (RCONCommandPolicy) TableName() string {
+	return "rcon_command_policies"
+}
+
+// ServerStatusSample is the result of one monitor poll of a server
+type ServerStatusSample struct {
+	SampleID     uint64    `gorm:"primaryKey;column:sample_id" json:"sample_id"`
+	ServerID     uint      `gorm:"column:server_id" json:"server_id"`
+	IsOnline     bool      `gorm:"column:is_online" json:"is_online"`
+	PlayerCount  int       `gorm:"column:player_count;default:0" json:"player_count"`
+	MaxPlayers   *int      `gorm:"column:max_players" json:"max_players"`
+	LatencyMs    *int      `gorm:"column:latency_ms" json:"latency_ms"`
+	Probe        *string   `gorm:"column:probe" json:"probe"`
+	ErrorMessage *string   `gorm:"column:error_message" json:"error_message,omitempty"`
+	SampledAt    time.Time `gorm:"column:sampled_at" json:"sampled_at"`
+}
+
+func (ServerStatusSample) TableName() string {
+	return "server_status_samples"
+}
+
+// ServerStatusHourly rolls up the samples of one server for one hour
+type ServerStatusHourly struct {
+	ServerID    uint      `gorm:"primaryKey;column:server_id" json:"server_id"`
+	BucketStart time.Time `gorm:"primaryKey;column:bucket_start" json:"bucket_start"`
+	SampleCount int       `gorm:"column:sample_count" json:"sample_count"`
+	OnlineCount int       `gorm:"column:online_count" json:"online_count"`
+	PlayerSum   int64     `gorm:"column:player_sum" json:"player_sum"`
+	PeakPlayers int       `gorm:"column:peak_players" json:"peak_players"`
+}
+
+func (ServerStatusHourly) TableName() string {
+	return "server_status_hourly"
+}
+
+// ServerStatusDaily rolls up the hourly rows of one server for one day
+type ServerStatusDaily struct {
+	ServerID    uint      `gorm:"primaryKey;column:server_id" json:"server_id"`
+	BucketStart time.Time `gorm:"primaryKey;column:bucket_start" json:"bucket_start"`
+	SampleCount int       `gorm:"column:sample_count" json:"sample_count"`
+	OnlineCount int       `gorm:"column:online_count" json:"online_count"`
+	PlayerSum   int64     `gorm:"column:player_sum" json:"player_sum"`
+	PeakPlayers int       `gorm:"column:peak_players" json:"peak_players"`
+}
+
+func (ServerStatusDaily) TableName() string {
+	return "server_status_daily"
+}
+
 func (ServerDisplayInfo) TableName() string {
 	return "server_display_info"
 }
@@ -1,9 +1,19 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"nexark-user-backend/pkg/money"
+	"nexark-user-backend/pkg/rcon"
+
+	"gorm.io/gorm"
+)
 
 type ItemCategory struct {
 	CategoryID     uint    `gorm:"primaryKey;column:category_id" json:"category_id"`
+	CategoryKey    *string `gorm:"column:category_key" json:"category_key"`
 	CategoryName   string  `gorm:"column:category_name" json:"category_name"`
 	CategoryNameEN string  `gorm:"column:category_name_en" json:"category_name_en,omitempty"`
 	CategoryNameTH string  `gorm:"column:category_name_th" json:"category_name_th,omitempty"`
@@ -20,44 +30,142 @@ func (ItemCategory) TableName() string {
 }
 
 type Item struct {
-	ItemID        uint      `gorm:"primaryKey;column:item_id" json:"item_id"`
-	CategoryID    uint      `gorm:"column:category_id" json:"category_id"`
-	ItemName      string    `gorm:"column:item_name" json:"item_name"`
-	ItemNameEN    string    `gorm:"column:item_name_en" json:"item_name_en,omitempty"`
-	ItemNameTH    string    `gorm:"column:item_name_th" json:"item_name_th,omitempty"`
-	ItemCode      string    `gorm:"column:item_code" json:"item_code"`
-	Description   *string   `gorm:"column:description" json:"description"`
-	DescriptionEN *string   `gorm:"column:description_en" json:"description_en,omitempty"`
-	DescriptionTH *string   `gorm:"column:description_th" json:"description_th,omitempty"`
-	Price         float64   `gorm:"column:price" json:"price"`
-	RCONCommand   string    `gorm:"column:rcon_command" json:"rcon_command"`
-	ImageURL      *string   `gorm:"column:image_url" json:"image_url"`
-	StockQuantity int       `gorm:"column:stock_quantity;default:-1" json:"stock_quantity"`
-	IsFeatured    bool      `gorm:"column:is_featured;default:false" json:"is_featured"`
-	IsActive      bool      `gorm:"column:is_active;default:true" json:"is_active"`
-	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at"`
-	CreatedBy     *uint     `gorm:"column:created_by" json:"created_by"`
+	ItemID        uint         `gorm:"primaryKey;column:item_id" json:"item_id"`
+	CategoryID    uint         `gorm:"column:category_id" json:"category_id"`
+	ItemName      string       `gorm:"column:item_name" json:"item_name"`
+	ItemNameEN    string       `gorm:"column:item_name_en" json:"item_name_en,omitempty"`
+	ItemNameTH    string       `gorm:"column:item_name_th" json:"item_name_th,omitempty"`
+	ItemCode      string       `gorm:"column:item_code" json:"item_code"`
+	Description   *string      `gorm:"column:description" json:"description"`
+	DescriptionEN *string      `gorm:"column:description_en" json:"description_en,omitempty"`
+	DescriptionTH *string      `gorm:"column:description_th" json:"description_th,omitempty"`
+	Price         money.Amount `gorm:"column:price" json:"price"`
+	RCONCommand   string       `gorm:"column:rcon_command" json:"rcon_command"`
+	ImageURL      *string      `gorm:"column:image_url" json:"image_url"`
+	StockQuantity int          `gorm:"column:stock_quantity;default:-1" json:"stock_quantity"`
+	DisplayOrder  int          `gorm:"column:display_order;default:0" json:"display_order"`
+	IsFeatured    bool         `gorm:"column:is_featured;default:false" json:"is_featured"`
+	IsActive      bool         `gorm:"column:is_active;default:true" json:"is_active"`
+	CreatedAt     time.Time    `gorm:"column:created_at" json:"created_at"`
+	CreatedBy     *uint        `gorm:"column:created_by" json:"created_by"`
+
+	// Set by the shop when a flash sale is running; Price stays the
+	// original price
+	SalePrice  *money.Amount `gorm:"-" json:"sale_price,omitempty"`
+	SaleEndsAt *time.Time    `gorm:"-" json:"sale_ends_at,omitempty"`
 
 	// Relations
-	Category ItemCategory `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Category           ItemCategory             `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	DeliverySteps      []ItemDeliveryStep       `gorm:"foreignKey:ItemID" json:"delivery_steps,omitempty"`
+	ServerAvailability []ItemServerAvailability `gorm:"foreignKey:ItemID" json:"server_availability,omitempty"`
 }
 
 func (Item) TableName() string {
 	return "items"
 }
 
+// BeforeCreate rejects items whose RCON command is not a valid template
+func (i *Item) BeforeCreate(tx *gorm.DB) error {
+	if err := rcon.ValidateCommandTemplate(i.RCONCommand); err != nil {
+		return fmt.Errorf("invalid rcon command: %w", err)
+	}
+	return nil
+}
+
+// ItemServerAvailability controls where an item is sold. Items without rows are
+// sold on every server; otherwise only on servers whose row is available.
+// The overrides replace the item's price and, for items without delivery
+// steps, its RCON command on that server.
+type ItemServerAvailability struct {
+	ItemID              uint          `gorm:"primaryKey;column:item_id" json:"item_id"`
+	ServerID            uint          `gorm:"primaryKey;column:server_id" json:"server_id"`
+	IsAvailable         bool          `gorm:"column:is_available" json:"is_available"`
+	PriceOverride       *money.Amount `gorm:"column:price_override" json:"price_override"`
+	RCONCommandOverride *string       `gorm:"column:rcon_command_override" json:"rcon_command_override"`
+	UpdatedAt           time.Time     `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (ItemServerAvailability) TableName() string {
+	return "item_server_availability"
+}
+
+// MaxDeliveryStepDelaySeconds bounds step delays, which hold a job worker while they run
+const MaxDeliveryStepDelaySeconds = 300
+
+// ItemDeliveryStep is one command of a bundle item. Steps run in StepOrder,
+// optionally waiting DelaySeconds first, and fail unless the RCON response
+// matches SuccessPattern when one is set.
+type ItemDeliveryStep struct {
+	StepID         uint      `gorm:"primaryKey;column:step_id" json:"step_id"`
+	ItemID         uint      `gorm:"column:item_id" json:"item_id"`
+	StepOrder      int       `gorm:"column:step_order" json:"step_order"`
+	RCONCommand    string    `gorm:"column:rcon_command" json:"rcon_command"`
+	DelaySeconds   int       `gorm:"column:delay_seconds;default:0" json:"delay_seconds"`
+	SuccessPattern *string   `gorm:"column:success_pattern" json:"success_pattern"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (ItemDeliveryStep) TableName() string {
+	return "item_delivery_steps"
+}
+
+// BeforeCreate rejects steps with an invalid command template or success pattern
+func (st *ItemDeliveryStep) BeforeCreate(tx *gorm.DB) error {
+	if err := rcon.ValidateCommandTemplate(st.RCONCommand); err != nil {
+		return fmt.Errorf("invalid rcon command: %w", err)
+	}
+	if st.SuccessPattern != nil {
+		if _, err := regexp.Compile(*st.SuccessPattern); err != nil {
+			return fmt.Errorf("invalid success pattern: %w", err)
+		}
+	}
+	if st.DelaySeconds < 0 || st.DelaySeconds > MaxDeliveryStepDelaySeconds {
+		return fmt.Errorf("delay must be between 0 and %d seconds", MaxDeliveryStepDelaySeconds)
+	}
+	return nil
+}
+
+// Catalog change log entity types and actions
+const (
+	ChangeEntityItem     = "item"
+	ChangeEntityCategory = "category"
+
+	ChangeActionCreate     = "create"
+	ChangeActionUpdate     = "update"
+	ChangeActionDeactivate = "deactivate"
+)
+
+// ItemChangeLog records an admin change to an item or category
+type ItemChangeLog struct {
+	ChangeID   uint64    `gorm:"primaryKey;column:change_id" json:"change_id"`
+	EntityType string    `gorm:"column:entity_type" json:"entity_type"`
+	EntityID   uint      `gorm:"column:entity_id" json:"entity_id"`
+	Action     string    `gorm:"column:action" json:"action"`
+	Changes    JSONMap   `gorm:"column:changes;type:json" json:"changes"`
+	ChangedBy  *uint     `gorm:"column:changed_by" json:"changed_by"`
+	ChangedAt  time.Time `gorm:"column:changed_at;autoCreateTime" json:"changed_at"`
+}
+
+func (ItemChangeLog) TableName() string {
+	return "item_change_log"
+}
+
+// ShoppingCart is one line of a user's cart. PriceAtAdd is the item's price on
+// the server when it was first added.
 type ShoppingCart struct {
-	CartID    uint      `gorm:"primaryKey;column:cart_id" json:"cart_id"`
-	UserID    uint      `gorm:"column:user_id" json:"user_id"`
-	ItemID    uint      `gorm:"column:item_id" json:"item_id"`
-	Quantity  int       `gorm:"column:quantity;default:1" json:"quantity"`
-	ServerID  uint      `gorm:"column:server_id" json:"server_id"`
-	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	CartID     uint         `gorm:"primaryKey;column:cart_id" json:"cart_id"`
+	UserID     uint         `gorm:"column:user_id" json:"user_id"`
+	ItemID     uint         `gorm:"column:item_id" json:"item_id"`
+	Quantity   int          `gorm:"column:quantity;default:1" json:"quantity"`
+	ServerID   uint         `gorm:"column:server_id" json:"server_id"`
+	PriceAtAdd money.Amount `gorm:"column:price_at_add" json:"price_at_add"`
+	CreatedAt  time.Time    `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  time.Time    `gorm:"column:updated_at" json:"updated_at"`
 
 	// Relations
-	User   User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Item   Item   `gorm:"foreignKey:ItemID" json:"item,omitempty"`
-	Server Server `gorm:"foreignKey:ServerID" json:"server,omitempty"`
+	User   User   `gorm:"foreignKey:UserID;references:UserID" json:"-"`
+	Item   Item   `gorm:"foreignKey:ItemID;references:ItemID" json:"item,omitempty"`
+	Server Server `gorm:"foreignKey:ServerID;references:ServerID" json:"server,omitempty"`
 }
 
 func (ShoppingCart) TableName() string {
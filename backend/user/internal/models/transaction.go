@@ -1,45 +1,78 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"nexark-user-backend/pkg/money"
+)
 
 type Transaction struct {
-	TransactionID   uint       `gorm:"primaryKey;column:transaction_id" json:"transaction_id"`
-	TransactionUUID string     `gorm:"uniqueIndex;column:transaction_uuid" json:"transaction_uuid"`
-	UserID          uint       `gorm:"column:user_id" json:"user_id"`
-	ItemID          uint       `gorm:"column:item_id" json:"item_id"`
-	ServerID        uint       `gorm:"column:server_id" json:"server_id"`
-	Amount          float64    `gorm:"column:amount" json:"amount"`
-	Quantity        int        `gorm:"column:quantity;default:1" json:"quantity"`
-	Status          string     `gorm:"column:status;default:pending" json:"status"`
-	RCONCommandSent *string    `gorm:"column:rcon_command_sent" json:"rcon_command_sent"`
-	RCONResponse    *string    `gorm:"column:rcon_response" json:"rcon_response"`
-	CreatedAt       time.Time  `gorm:"column:created_at" json:"created_at"`
-	CompletedAt     *time.Time `gorm:"column:completed_at" json:"completed_at"`
-	FailureReason   *string    `gorm:"column:failure_reason" json:"failure_reason"`
+	TransactionID       uint         `gorm:"primaryKey;column:transaction_id" json:"transaction_id"`
+	TransactionUUID     string       `gorm:"uniqueIndex;column:transaction_uuid" json:"transaction_uuid"`
+	UserID              uint         `gorm:"column:user_id" json:"user_id"`
+	ItemID              uint         `gorm:"column:item_id" json:"item_id"`
+	ServerID            uint         `gorm:"column:server_id" json:"server_id"`
+	RecipientSteamID    *string      `gorm:"column:recipient_steam_id" json:"recipient_steam_id,omitempty"`
+	Amount              money.Amount `gorm:"column:amount" json:"amount"`
+	DiscountAmount      money.Amount `gorm:"column:discount_amount" json:"discount_amount"`
+	CouponID            *uint        `gorm:"column:coupon_id" json:"coupon_id,omitempty"`
+	CouponRedemptionID  *uint        `gorm:"column:coupon_redemption_id" json:"coupon_redemption_id,omitempty"`
+	Quantity            int          `gorm:"column:quantity;default:1" json:"quantity"`
+	Status              string       `gorm:"column:status;default:pending" json:"status"`
+	RCONCommandSent     *string      `gorm:"column:rcon_command_sent" json:"rcon_command_sent"`
+	RCONResponse        *string      `gorm:"column:rcon_response" json:"rcon_response"`
+	CreatedAt           time.Time    `gorm:"column:created_at" json:"created_at"`
+	CompletedAt         *time.Time   `gorm:"column:completed_at" json:"completed_at"`
+	AwaitingPlayerSince *time.Time   `gorm:"column:awaiting_player_since" json:"awaiting_player_since,omitempty"`
+	FailureReason       *string      `gorm:"column:failure_reason" json:"failure_reason"`
+	DeliveryJobID       *uint        `gorm:"column:delivery_job_id" json:"delivery_job_id"`
 
 	// Relations
-	User   User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Item   Item   `gorm:"foreignKey:ItemID" json:"item,omitempty"`
-	Server Server `gorm:"foreignKey:ServerID" json:"server,omitempty"`
+	User          User                      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Item          Item                      `gorm:"foreignKey:ItemID" json:"item,omitempty"`
+	Server        Server                    `gorm:"foreignKey:ServerID" json:"server,omitempty"`
+	DeliverySteps []TransactionDeliveryStep `gorm:"foreignKey:TransactionID" json:"delivery_steps,omitempty"`
 }
 
 func (Transaction) TableName() string {
 	return "transactions"
 }
 
+// TransactionDeliveryStep records the outcome of one delivery command. Steps
+// that don't use {quantity} are run once per unit, identified by UnitIndex.
+type TransactionDeliveryStep struct {
+	TransactionStepID uint       `gorm:"primaryKey;column:transaction_step_id" json:"transaction_step_id"`
+	TransactionID     uint       `gorm:"column:transaction_id" json:"transaction_id"`
+	StepOrder         int        `gorm:"column:step_order" json:"step_order"`
+	UnitIndex         int        `gorm:"column:unit_index;default:0" json:"unit_index"`
+	Status            string     `gorm:"column:status;default:pending" json:"status"`
+	RCONCommandSent   *string    `gorm:"column:rcon_command_sent" json:"rcon_command_sent"`
+	RCONResponse      *string    `gorm:"column:rcon_response" json:"rcon_response"`
+	ErrorMessage      *string    `gorm:"column:error_message" json:"error_message"`
+	AttemptCount      int        `gorm:"column:attempt_count;default:0" json:"attempt_count"`
+	CreatedAt         time.Time  `gorm:"column:created_at" json:"created_at"`
+	CompletedAt       *time.Time `gorm:"column:completed_at" json:"completed_at"`
+}
+
+func (TransactionDeliveryStep) TableName() string {
+	return "transaction_delivery_steps"
+}
+
 type CreditTransaction struct {
-	CreditTransactionID  uint      `gorm:"primaryKey;column:credit_transaction_id" json:"credit_transaction_id"`
-	UserID               uint      `gorm:"column:user_id" json:"user_id"`
-	RelatedPaymentID     *uint     `gorm:"column:related_payment_id" json:"related_payment_id"`
-	RelatedTransactionID *uint     `gorm:"column:related_transaction_id" json:"related_transaction_id"`
-	StripeRefundID       *string   `gorm:"column:stripe_refund_id" json:"stripe_refund_id"`
-	Amount               float64   `gorm:"column:amount" json:"amount"`
-	TransactionType      string    `gorm:"column:transaction_type" json:"transaction_type"`
-	Description          *string   `gorm:"column:description" json:"description"`
-	BalanceBefore        float64   `gorm:"column:balance_before" json:"balance_before"`
-	BalanceAfter         float64   `gorm:"column:balance_after" json:"balance_after"`
-	CreatedAt            time.Time `gorm:"column:created_at" json:"created_at"`
-	CreatedBy            *uint     `gorm:"column:created_by" json:"created_by"`
+	CreditTransactionID  uint         `gorm:"primaryKey;column:credit_transaction_id" json:"credit_transaction_id"`
+	UserID               uint         `gorm:"column:user_id" json:"user_id"`
+	RelatedPaymentID     *uint        `gorm:"column:related_payment_id" json:"related_payment_id"`
+	RelatedTransactionID *uint        `gorm:"column:related_transaction_id" json:"related_transaction_id"`
+	StripeRefundID       *string      `gorm:"column:stripe_refund_id" json:"stripe_refund_id"`
+	Amount               money.Amount `gorm:"column:amount" json:"amount"`
+	DiscountAmount       money.Amount `gorm:"column:discount_amount" json:"discount_amount"`
+	CouponID             *uint        `gorm:"column:coupon_id" json:"coupon_id,omitempty"`
+	TransactionType      string       `gorm:"column:transaction_type" json:"transaction_type"`
+	Description          *string      `gorm:"column:description" json:"description"`
+	BalanceBefore        money.Amount `gorm:"column:balance_before" json:"balance_before"`
+	BalanceAfter         money.Amount `gorm:"column:balance_after" json:"balance_after"`
+	CreatedAt            time.Time    `gorm:"column:created_at" json:"created_at"`
+	CreatedBy            *uint        `gorm:"column:created_by" json:"created_by"`
 
 	// Relations
 	User               User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
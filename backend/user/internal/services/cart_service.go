@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cart limits
+const (
+	MaxCartLines        = 50
+	MaxCartLineQuantity = 100
+)
+
+// CartService keeps a user's shopping cart on the server and checks it out as
+// one TransactionService purchase.
+type CartService struct {
+	db                 *gorm.DB
+	pricingService     *PricingService
+	transactionService *TransactionService
+}
+
+func NewCartService(db *gorm.DB, pricingService *PricingService, transactionService *TransactionService) *CartService {
+	return &CartService{
+		db:                 db,
+		pricingService:     pricingService,
+		transactionService: transactionService,
+	}
+}
+
+type AddCartItemRequest struct {
+	ItemID   uint `json:"item_id" binding:"required"`
+	ServerID uint `json:"server_id" binding:"required"`
+	Quantity int  `json:"quantity" binding:"omitempty,min=1"`
+}
+
+// UpdateCartItemRequest changes the quantity or server of a line; nil fields
+// are left unchanged
+type UpdateCartItemRequest struct {
+	Quantity *int  `json:"quantity" binding:"omitempty,min=1"`
+	ServerID *uint `json:"server_id"`
+}
+
+type CheckoutRequest struct {
+	// AcceptPriceChanges confirms buying at the current prices when they
+	// differ from the prices at which items were added
+	AcceptPriceChanges bool   `json:"accept_price_changes"`
+	CouponCode         string `json:"coupon_code"`
+}
+
+// CartLine is a cart line checked against the current catalog
+type CartLine struct {
+	models.ShoppingCart
+	CurrentPrice money.Amount `json:"current_price"`
+	PriceChanged bool         `json:"price_changed"`
+	Available    bool         `json:"available"`
+	InStock      bool         `json:"in_stock"`
+	LineTotal    money.Amount `json:"line_total"`
+}
+
+type Cart struct {
+	Lines []CartLine   `json:"lines"`
+	Total money.Amount `json:"total"`
+	// Purchasable is false when any line is unavailable or out of stock
+	Purchasable bool `json:"purchasable"`
+}
+
+// CartPriceChange is a line whose price differs from when it was added
+type CartPriceChange struct {
+	CartID       uint         `json:"cart_id"`
+	ItemID       uint         `json:"item_id"`
+	ItemName     string       `json:"item_name"`
+	ServerID     uint         `json:"server_id"`
+	PriceAtAdd   money.Amount `json:"price_at_add"`
+	CurrentPrice money.Amount `json:"current_price"`
+}
+
+type CheckoutResult struct {
+	Purchase     *PurchaseResponse `json:"purchase,omitempty"`
+	PriceChanges []CartPriceChange `json:"price_changes"`
+}
+
+// ErrCartPriceChanged is returned by Checkout when prices changed since items
+// were added and the change wasn't accepted
+var ErrCartPriceChanged = errors.New("cart prices have changed")
+
+// GetCart returns the user's cart with current prices and availability
+func (s *CartService) GetCart(ctx context.Context, userID uint) (*Cart, error) {
+	var lines []models.ShoppingCart
+	err := s.db.Where("user_id = ?", userID).
+		Preload("Item").
+		Preload("Item.Category").
+		Preload("Server").
+		Order("created_at ASC, cart_id ASC").
+		Find(&lines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	// An item can be in the cart for several servers; its stock has to cover
+	// all of them
+	quantities := make(map[uint]int)
+	for _, line := range lines {
+		quantities[line.ItemID] += line.Quantity
+	}
+
+	cart := &Cart{Lines: make([]CartLine, 0, len(lines)), Purchasable: len(lines) > 0}
+	for _, line := range lines {
+		cartLine, err := s.checkLine(s.db, line, quantities[line.ItemID])
+		if err != nil {
+			return nil, err
+		}
+		if !cartLine.Available || !cartLine.InStock {
+			cart.Purchasable = false
+		}
+		cart.Total += cartLine.LineTotal
+		cart.Lines = append(cart.Lines, cartLine)
+	}
+
+	return cart, nil
+}
+
+// AddItem adds an item for a server to the cart. Adding an item that's already
+// in the cart for that server increases its quantity.
+func (s *CartService) AddItem(ctx context.Context, userID uint, req AddCartItemRequest) error {
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		offer, err := s.resolveOffer(tx, req.ItemID, req.ServerID)
+		if err != nil {
+			return err
+		}
+
+		var existing models.ShoppingCart
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND item_id = ? AND server_id = ?", userID, req.ItemID, req.ServerID).
+			First(&existing).Error
+		if err == nil {
+			quantity := existing.Quantity + req.Quantity
+			if quantity > MaxCartLineQuantity {
+				return fmt.Errorf("invalid quantity: at most %d per line", MaxCartLineQuantity)
+			}
+			if err := tx.Model(&existing).Update("quantity", quantity).Error; err != nil {
+				return fmt.Errorf("failed to update cart: %w", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to get cart: %w", err)
+		}
+
+		if req.Quantity > MaxCartLineQuantity {
+			return fmt.Errorf("invalid quantity: at most %d per line", MaxCartLineQuantity)
+		}
+
+		var count int64
+		if err := tx.Model(&models.ShoppingCart{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count cart lines: %w", err)
+		}
+		if count >= MaxCartLines {
+			return fmt.Errorf("cart is full: at most %d lines", MaxCartLines)
+		}
+
+		line := models.ShoppingCart{
+			UserID:     userID,
+			ItemID:     req.ItemID,
+			ServerID:   req.ServerID,
+			Quantity:   req.Quantity,
+			PriceAtAdd: offer.Price,
+		}
+		if err := tx.Omit(clause.Associations).Create(&line).Error; err != nil {
+			return fmt.Errorf("failed to add to cart: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateItem changes the quantity or server of a cart line. Moving a line to
+// another server takes that server's price as its price at add.
+func (s *CartService) UpdateItem(ctx context.Context, userID, cartID uint, req UpdateCartItemRequest) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var line models.ShoppingCart
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("cart_id = ? AND user_id = ?", cartID, userID).
+			First(&line).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("cart item not found")
+			}
+			return fmt.Errorf("failed to get cart: %w", err)
+		}
+
+		updates := map[string]interface{}{}
+		if req.Quantity != nil {
+			if *req.Quantity > MaxCartLineQuantity {
+				return fmt.Errorf("invalid quantity: at most %d per line", MaxCartLineQuantity)
+			}
+			updates["quantity"] = *req.Quantity
+		}
+
+		if req.ServerID != nil && *req.ServerID != line.ServerID {
+			offer, err := s.resolveOffer(tx, line.ItemID, *req.ServerID)
+			if err != nil {
+				return err
+			}
+
+			var count int64
+			if err := tx.Model(&models.ShoppingCart{}).
+				Where("user_id = ? AND item_id = ? AND server_id = ?", userID, line.ItemID, *req.ServerID).
+				Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to get cart: %w", err)
+			}
+			if count > 0 {
+				return fmt.Errorf("item is already in the cart for that server")
+			}
+
+			updates["server_id"] = *req.ServerID
+			updates["price_at_add"] = offer.Price
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&line).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update cart: %w", err)
+		}
+		return nil
+	})
+}
+
+// RemoveItem deletes a line from the user's cart
+func (s *CartService) RemoveItem(ctx context.Context, userID, cartID uint) error {
+	result := s.db.Where("cart_id = ? AND user_id = ?", cartID, userID).Delete(&models.ShoppingCart{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove from cart: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("cart item not found")
+	}
+	return nil
+}
+
+// ClearCart empties the user's cart
+func (s *CartService) ClearCart(ctx context.Context, userID uint) error {
+	if err := s.db.Where("user_id = ?", userID).Delete(&models.ShoppingCart{}).Error; err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+	return nil
+}
+
+// Checkout buys the whole cart as one purchase and empties it in the same
+// database transaction. Prices, availability and stock are checked again;
+// if any price changed since its item was added, nothing is bought unless
+// req.AcceptPriceChanges is set, and ErrCartPriceChanged is returned with the
+// changes.
+func (s *CartService) Checkout(ctx context.Context, userID uint, req CheckoutRequest) (*CheckoutResult, error) {
+	cart, err := s.GetCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Lines) == 0 {
+		return nil, fmt.Errorf("cart is empty")
+	}
+
+	result := &CheckoutResult{PriceChanges: []CartPriceChange{}}
+	purchase := PurchaseRequest{
+		Items:      make([]PurchaseItem, 0, len(cart.Lines)),
+		CouponCode: req.CouponCode,
+	}
+	expected := make([]money.Amount, 0, len(cart.Lines))
+	cartIDs := make([]uint, 0, len(cart.Lines))
+
+	for _, line := range cart.Lines {
+		if !line.Available {
+			return nil, fmt.Errorf("item %s is not available on server %d", line.Item.ItemName, line.ServerID)
+		}
+		if !line.InStock {
+			return nil, fmt.Errorf("insufficient stock for item %s", line.Item.ItemName)
+		}
+		if line.PriceChanged {
+			result.PriceChanges = append(result.PriceChanges, CartPriceChange{
+				CartID:       line.CartID,
+				ItemID:       line.ItemID,
+				ItemName:     line.Item.ItemName,
+				ServerID:     line.ServerID,
+				PriceAtAdd:   line.PriceAtAdd,
+				CurrentPrice: line.CurrentPrice,
+			})
+		}
+
+		purchase.Items = append(purchase.Items, PurchaseItem{
+			ItemID:   line.ItemID,
+			Quantity: line.Quantity,
+			ServerID: line.ServerID,
+		})
+		expected = append(expected, line.LineTotal)
+		cartIDs = append(cartIDs, line.CartID)
+	}
+
+	if len(result.PriceChanges) > 0 && !req.AcceptPriceChanges {
+		return result, ErrCartPriceChanged
+	}
+
+	// The purchase prices are resolved again inside its transaction; make sure
+	// they are still the ones the user saw, and take the lines out of the cart
+	// only if the purchase commits
+	response, err := s.transactionService.processPurchaseTransaction(ctx, userID, purchase,
+		func(tx *gorm.DB, transactions []*models.Transaction) error {
+			for i, transaction := range transactions {
+				if transaction.Amount+transaction.DiscountAmount != expected[i] {
+					return ErrCartPriceChanged
+				}
+			}
+
+			deleted := tx.Where("user_id = ? AND cart_id IN ?", userID, cartIDs).Delete(&models.ShoppingCart{})
+			if deleted.Error != nil {
+				return fmt.Errorf("failed to clear cart: %w", deleted.Error)
+			}
+			if deleted.RowsAffected != int64(len(cartIDs)) {
+				return fmt.Errorf("cart changed during checkout")
+			}
+			return nil
+		})
+	if errors.Is(err, ErrCartPriceChanged) {
+		return result, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Purchase = response
+	return result, nil
+}
+
+// checkLine resolves the current price, availability and stock of a line.
+// itemQuantity is how many of the item the whole cart holds.
+func (s *CartService) checkLine(tx *gorm.DB, line models.ShoppingCart, itemQuantity int) (CartLine, error) {
+	cartLine := CartLine{ShoppingCart: line}
+	if !line.Item.IsActive {
+		return cartLine, nil
+	}
+
+	offer, err := s.pricingService.ResolveOffer(tx, &line.Item, line.ServerID)
+	if err != nil {
+		return cartLine, err
+	}
+
+	cartLine.Available = offer.Available
+	cartLine.CurrentPrice = offer.Price
+	cartLine.PriceChanged = offer.Price != line.PriceAtAdd
+	cartLine.InStock = line.Item.StockQuantity == -1 || line.Item.StockQuantity >= itemQuantity
+	cartLine.LineTotal = offer.Price.Mul(line.Quantity)
+
+	return cartLine, nil
+}
+
+// resolveOffer returns the offer for an active item on an existing server
+func (s *CartService) resolveOffer(tx *gorm.DB, itemID, serverID uint) (*ItemOffer, error) {
+	var item models.Item
+	if err := tx.Where("item_id = ? AND is_active = ?", itemID, true).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	var count int64
+	if err := tx.Model(&models.Server{}).Where("server_id = ?", serverID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to get server: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("server not found")
+	}
+
+	offer, err := s.pricingService.ResolveOffer(tx, &item, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if !offer.Available {
+		return nil, fmt.Errorf("item is not available on this server")
+	}
+
+	return offer, nil
+}
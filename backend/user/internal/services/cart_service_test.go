@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"nexark-user-backend/pkg/money"
+)
+
+func TestCartChecksStockAcrossServers(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	other := shop.createServer(t, "Other Island")
+	item := shop.createItem(t, "tek_rifle", money.FromBaht(1), "GiveItemNum {steam_id} 1")
+	shop.limitStock(t, item, 5)
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000031", money.FromBaht(10))
+
+	// Each line alone is in stock, together they are one too many
+	for _, serverID := range []uint{shop.server.ServerID, other.ServerID} {
+		if err := shop.cart.AddItem(context.Background(), buyer.UserID, AddCartItemRequest{
+			ItemID:   item.ItemID,
+			ServerID: serverID,
+			Quantity: 3,
+		}); err != nil {
+			t.Fatalf("failed to add to cart: %v", err)
+		}
+	}
+
+	cart, err := shop.cart.GetCart(context.Background(), buyer.UserID)
+	if err != nil {
+		t.Fatalf("GetCart: %v", err)
+	}
+	if cart.Purchasable {
+		t.Error("cart with 6 of an item that has 5 in stock is purchasable")
+	}
+	for _, line := range cart.Lines {
+		if line.InStock {
+			t.Errorf("line for server %d is in stock although the cart holds 6 of 5", line.ServerID)
+		}
+	}
+
+	_, err = shop.cart.Checkout(context.Background(), buyer.UserID, CheckoutRequest{})
+	if err == nil || !strings.Contains(err.Error(), "insufficient stock") {
+		t.Fatalf("got %v checking out 6 of 5 in stock, want an insufficient stock error", err)
+	}
+	if stock := shop.stockOf(t, item); stock != 5 {
+		t.Errorf("stock is %d after the failed checkout, want 5", stock)
+	}
+}
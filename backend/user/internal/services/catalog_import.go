@@ -0,0 +1,554 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// Catalog import/export formats and entities
+const (
+	CatalogFormatCSV  = "csv"
+	CatalogFormatJSON = "json"
+
+	CatalogEntityCategories = "categories"
+	CatalogEntityItems      = "items"
+)
+
+// Import row actions
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+	ImportActionError     = "error"
+)
+
+// CSV columns in export order; imports may use any subset in any order
+var (
+	categoryCSVColumns = []string{
+		"category_key", "category_name", "category_name_en", "category_name_th",
+		"description", "description_en", "description_th",
+		"icon_url", "display_order", "is_active",
+	}
+	itemCSVColumns = []string{
+		"item_code", "category_key", "item_name", "item_name_en", "item_name_th",
+		"description", "description_en", "description_th",
+		"price", "rcon_command", "image_url", "stock_quantity",
+		"display_order", "is_featured", "is_active", "delivery_steps",
+	}
+	csvAmountColumns = map[string]bool{"price": true}
+	csvIntColumns    = map[string]bool{"display_order": true, "stock_quantity": true}
+	csvBoolColumns   = map[string]bool{"is_active": true, "is_featured": true}
+	// JSON columns hold a JSON value in the cell, e.g. delivery_steps as
+	// [{"rcon_command":"...","delay_seconds":5}]
+	csvJSONColumns = map[string]bool{"delivery_steps": true}
+)
+
+// errImportRollback rolls back a dry run or an import with row errors
+var errImportRollback = errors.New("import rolled back")
+
+// CategoryImportRow is a category matched by its key
+type CategoryImportRow struct {
+	CategoryInput
+
+	row         int
+	parseErrors []string
+}
+
+// ItemImportRow is an item matched by its item code, whose category is given
+// by key
+type ItemImportRow struct {
+	ItemInput
+	CategoryKey *string `json:"category_key,omitempty"`
+
+	row         int
+	parseErrors []string
+}
+
+// CatalogDocument is the JSON import/export format
+type CatalogDocument struct {
+	Categories []CategoryImportRow `json:"categories"`
+	Items      []ItemImportRow     `json:"items"`
+}
+
+// ImportRowResult is what an import did, or would do, with one row. Row is the
+// CSV line number or the 1-based index in the JSON array.
+type ImportRowResult struct {
+	Entity  string         `json:"entity"`
+	Row     int            `json:"row"`
+	Key     string         `json:"key"`
+	Action  string         `json:"action"`
+	Changes models.JSONMap `json:"changes,omitempty"`
+	Errors  []string       `json:"errors,omitempty"`
+}
+
+type ImportSummary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Errors    int `json:"errors"`
+}
+
+// ImportResult is the diff of an import. Applied is only true when the import
+// was not a dry run and every row was valid.
+type ImportResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Applied bool              `json:"applied"`
+	Summary ImportSummary     `json:"summary"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ParseCatalogJSON reads a CatalogDocument, rejecting unknown fields so typos
+// don't silently do nothing
+func ParseCatalogJSON(data []byte) (*CatalogDocument, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var doc CatalogDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	for i := range doc.Categories {
+		doc.Categories[i].row = i + 1
+	}
+	for i := range doc.Items {
+		doc.Items[i].row = i + 1
+	}
+
+	return &doc, nil
+}
+
+// ParseCatalogCSV reads categories or items from CSV with a header row.
+// Columns missing from the header are left unchanged on existing rows; values
+// that can't be parsed are reported against their row.
+func ParseCatalogCSV(entity string, r io.Reader) (*CatalogDocument, error) {
+	allowed := map[string]bool{}
+	switch entity {
+	case CatalogEntityCategories:
+		for _, column := range categoryCSVColumns {
+			allowed[column] = true
+		}
+	case CatalogEntityItems:
+		for _, column := range itemCSVColumns {
+			allowed[column] = true
+		}
+	default:
+		return nil, fmt.Errorf("invalid entity %q", entity)
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: failed to read header: %w", err)
+	}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !allowed[column] {
+			return nil, fmt.Errorf("invalid CSV: unknown column %q", column)
+		}
+		header[i] = column
+	}
+
+	doc := &CatalogDocument{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		values, parseErrors := csvRecordValues(header, record)
+		data, _ := json.Marshal(values)
+
+		if entity == CatalogEntityCategories {
+			row := CategoryImportRow{row: line, parseErrors: parseErrors}
+			if err := json.Unmarshal(data, &row); err != nil {
+				row.parseErrors = append(row.parseErrors, fmt.Sprintf("invalid row: %v", err))
+			}
+			doc.Categories = append(doc.Categories, row)
+		} else {
+			row := ItemImportRow{row: line, parseErrors: parseErrors}
+			if err := json.Unmarshal(data, &row); err != nil {
+				row.parseErrors = append(row.parseErrors, fmt.Sprintf("delivery_steps: %v", err))
+			}
+			doc.Items = append(doc.Items, row)
+		}
+	}
+
+	return doc, nil
+}
+
+// csvRecordValues converts a CSV record to JSON values by column type. Empty
+// number, boolean and JSON cells are left out.
+func csvRecordValues(header, record []string) (map[string]interface{}, []string) {
+	values := make(map[string]interface{}, len(header))
+	var parseErrors []string
+
+	for i, column := range header {
+		if i >= len(record) {
+			break
+		}
+		cell := strings.TrimSpace(record[i])
+
+		switch {
+		case csvAmountColumns[column]:
+			if cell == "" {
+				continue
+			}
+			value, err := money.Parse(cell)
+			if err != nil {
+				parseErrors = append(parseErrors, fmt.Sprintf("%s: %q is not an amount with at most two decimals", column, cell))
+				continue
+			}
+			values[column] = value
+		case csvIntColumns[column]:
+			if cell == "" {
+				continue
+			}
+			value, err := strconv.Atoi(cell)
+			if err != nil {
+				parseErrors = append(parseErrors, fmt.Sprintf("%s: %q is not a whole number", column, cell))
+				continue
+			}
+			values[column] = value
+		case csvJSONColumns[column]:
+			if cell == "" {
+				continue
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(cell), &value); err != nil {
+				parseErrors = append(parseErrors, fmt.Sprintf("%s: not valid JSON", column))
+				continue
+			}
+			values[column] = value
+		case csvBoolColumns[column]:
+			if cell == "" {
+				continue
+			}
+			value, err := strconv.ParseBool(cell)
+			if err != nil {
+				parseErrors = append(parseErrors, fmt.Sprintf("%s: %q is not true or false", column, cell))
+				continue
+			}
+			values[column] = value
+		default:
+			values[column] = cell
+		}
+	}
+
+	return values, parseErrors
+}
+
+// ImportCatalog upserts categories by key and then items by item code in one
+// transaction. Every row is checked; if any row fails, or dryRun is set,
+// nothing is kept and the result shows what would have changed.
+func (s *CatalogService) ImportCatalog(ctx context.Context, doc *CatalogDocument, dryRun bool, adminID uint) (*ImportResult, error) {
+	result := &ImportResult{DryRun: dryRun, Rows: []ImportRowResult{}}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		seen := map[string]bool{}
+		for _, row := range doc.Categories {
+			rowResult, err := s.importCategory(tx, row, seen, adminID)
+			if err != nil {
+				return err
+			}
+			result.add(rowResult)
+		}
+
+		seen = map[string]bool{}
+		for _, row := range doc.Items {
+			rowResult, err := s.importItem(tx, row, seen, adminID)
+			if err != nil {
+				return err
+			}
+			result.add(rowResult)
+		}
+
+		if dryRun || result.Summary.Errors > 0 {
+			return errImportRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportRollback) {
+		return nil, err
+	}
+
+	result.Applied = err == nil
+	return result, nil
+}
+
+func (r *ImportResult) add(row ImportRowResult) {
+	switch row.Action {
+	case ImportActionCreate:
+		r.Summary.Created++
+	case ImportActionUpdate:
+		r.Summary.Updated++
+	case ImportActionUnchanged:
+		r.Summary.Unchanged++
+	case ImportActionError:
+		r.Summary.Errors++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+// importCategory applies one row. Validation problems become row errors;
+// database failures are returned and abort the import.
+func (s *CatalogService) importCategory(tx *gorm.DB, row CategoryImportRow, seen map[string]bool, adminID uint) (ImportRowResult, error) {
+	result := ImportRowResult{Entity: CatalogEntityCategories, Row: row.row, Errors: row.parseErrors}
+
+	if row.CategoryKey == nil || strings.TrimSpace(*row.CategoryKey) == "" {
+		result.Errors = append(result.Errors, "category_key is required")
+	} else {
+		result.Key = strings.TrimSpace(*row.CategoryKey)
+		if seen[result.Key] {
+			result.Errors = append(result.Errors, "category_key appears more than once in the import")
+		}
+		seen[result.Key] = true
+	}
+	if len(result.Errors) > 0 {
+		result.Action = ImportActionError
+		return result, nil
+	}
+
+	var existing models.ItemCategory
+	err := tx.Where("category_key = ?", result.Key).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, result.Changes, err = s.createCategory(tx, row.CategoryInput, adminID)
+		result.Action = ImportActionCreate
+	} else {
+		_, result.Changes, err = s.updateCategory(tx, existing.CategoryID, row.CategoryInput, adminID)
+		result.Action = ImportActionUpdate
+	}
+
+	return finishImportRow(result, err)
+}
+
+func (s *CatalogService) importItem(tx *gorm.DB, row ItemImportRow, seen map[string]bool, adminID uint) (ImportRowResult, error) {
+	result := ImportRowResult{Entity: CatalogEntityItems, Row: row.row, Errors: row.parseErrors}
+
+	if row.ItemCode == nil || strings.TrimSpace(*row.ItemCode) == "" {
+		result.Errors = append(result.Errors, "item_code is required")
+	} else {
+		result.Key = strings.TrimSpace(*row.ItemCode)
+		if seen[result.Key] {
+			result.Errors = append(result.Errors, "item_code appears more than once in the import")
+		}
+		seen[result.Key] = true
+	}
+
+	input := row.ItemInput
+	if row.CategoryKey != nil {
+		var category models.ItemCategory
+		err := tx.Where("category_key = ?", strings.TrimSpace(*row.CategoryKey)).First(&category).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			result.Errors = append(result.Errors, fmt.Sprintf("category_key %q does not exist", *row.CategoryKey))
+		case err != nil:
+			return result, fmt.Errorf("failed to get category: %w", err)
+		default:
+			input.CategoryID = &category.CategoryID
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		result.Action = ImportActionError
+		return result, nil
+	}
+
+	var existing models.Item
+	err := tx.Where("item_code = ?", result.Key).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, result.Changes, err = s.createItem(tx, input, adminID)
+		result.Action = ImportActionCreate
+	} else {
+		_, result.Changes, err = s.updateItem(tx, existing.ItemID, input, adminID)
+		result.Action = ImportActionUpdate
+	}
+
+	return finishImportRow(result, err)
+}
+
+// finishImportRow turns validation errors into row errors and passes any
+// other failure up to abort the import
+func finishImportRow(result ImportRowResult, err error) (ImportRowResult, error) {
+	if err != nil {
+		var invalid *catalogValidationError
+		if !errors.As(err, &invalid) {
+			return result, err
+		}
+		result.Action = ImportActionError
+		result.Changes = nil
+		result.Errors = append(result.Errors, err.Error())
+		return result, nil
+	}
+
+	if result.Action == ImportActionUpdate && len(result.Changes) == 0 {
+		result.Action = ImportActionUnchanged
+	}
+	return result, nil
+}
+
+// ExportCatalog returns every category and item, active or not, in the import
+// format. Optional text that is unset is exported as an empty string, and
+// items without delivery steps as an empty list, so a round trip clears them
+// again.
+func (s *CatalogService) ExportCatalog(ctx context.Context) (*CatalogDocument, error) {
+	var categories []models.ItemCategory
+	if err := s.db.Order("display_order ASC, category_id ASC").Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+
+	var items []models.Item
+	err := s.db.Preload("Category").
+		Preload("DeliverySteps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("step_order ASC")
+		}).
+		Order("category_id ASC, display_order ASC, item_id ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items: %w", err)
+	}
+
+	doc := &CatalogDocument{
+		Categories: make([]CategoryImportRow, 0, len(categories)),
+		Items:      make([]ItemImportRow, 0, len(items)),
+	}
+
+	for i := range categories {
+		category := categories[i]
+		doc.Categories = append(doc.Categories, CategoryImportRow{
+			CategoryInput: CategoryInput{
+				CategoryKey:    exportString(category.CategoryKey),
+				CategoryName:   &category.CategoryName,
+				CategoryNameEN: &category.CategoryNameEN,
+				CategoryNameTH: &category.CategoryNameTH,
+				Description:    exportString(category.Description),
+				DescriptionEN:  exportString(category.DescriptionEN),
+				DescriptionTH:  exportString(category.DescriptionTH),
+				IconURL:        exportString(category.IconURL),
+				DisplayOrder:   &category.DisplayOrder,
+				IsActive:       &category.IsActive,
+			},
+		})
+	}
+
+	for i := range items {
+		item := items[i]
+		steps := make([]DeliveryStepInput, len(item.DeliverySteps))
+		for j, step := range item.DeliverySteps {
+			steps[j] = DeliveryStepInput{
+				RCONCommand:    step.RCONCommand,
+				DelaySeconds:   step.DelaySeconds,
+				SuccessPattern: step.SuccessPattern,
+			}
+		}
+		doc.Items = append(doc.Items, ItemImportRow{
+			ItemInput: ItemInput{
+				ItemName:      &item.ItemName,
+				ItemNameEN:    &item.ItemNameEN,
+				ItemNameTH:    &item.ItemNameTH,
+				ItemCode:      &item.ItemCode,
+				Description:   exportString(item.Description),
+				DescriptionEN: exportString(item.DescriptionEN),
+				DescriptionTH: exportString(item.DescriptionTH),
+				Price:         &item.Price,
+				RCONCommand:   &item.RCONCommand,
+				ImageURL:      exportString(item.ImageURL),
+				StockQuantity: &item.StockQuantity,
+				DisplayOrder:  &item.DisplayOrder,
+				IsFeatured:    &item.IsFeatured,
+				IsActive:      &item.IsActive,
+				DeliverySteps: &steps,
+			},
+			CategoryKey: exportString(item.Category.CategoryKey),
+		})
+	}
+
+	return doc, nil
+}
+
+// WriteCatalogCSV writes the categories or items of doc as CSV
+func WriteCatalogCSV(w io.Writer, entity string, doc *CatalogDocument) error {
+	var columns []string
+	var rows []interface{}
+
+	switch entity {
+	case CatalogEntityCategories:
+		columns = categoryCSVColumns
+		for _, row := range doc.Categories {
+			rows = append(rows, row)
+		}
+	case CatalogEntityItems:
+		columns = itemCSVColumns
+		for _, row := range doc.Items {
+			rows = append(rows, row)
+		}
+	default:
+		return fmt.Errorf("invalid entity %q", entity)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		values := toJSONMap(row)
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			switch value := values[column].(type) {
+			case nil:
+			case float64:
+				record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+			case []interface{}, map[string]interface{}:
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				record[i] = string(data)
+			default:
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportString(value *string) *string {
+	if value == nil {
+		empty := ""
+		return &empty
+	}
+	return value
+}
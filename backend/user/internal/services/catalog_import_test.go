@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFinishImportRowSeparatesValidationFromDatabaseErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		aborts  bool
+		message string
+	}{
+		{
+			name:    "validation error",
+			err:     validationErrorf("invalid item: price must not be negative"),
+			message: "invalid item: price must not be negative",
+		},
+		{
+			name:    "wrapped validation error",
+			err:     fmt.Errorf("row 3: %w", validationErrorf("item code %s already exists", "metal")),
+			message: "row 3: item code metal already exists",
+		},
+		{
+			name:    "validation error worded like a database failure",
+			err:     validationErrorf("failed to match category %q", "tools"),
+			message: `failed to match category "tools"`,
+		},
+		{
+			name:   "database error",
+			err:    fmt.Errorf("failed to create item: %w", errors.New("connection refused")),
+			aborts: true,
+		},
+		{
+			name:   "database error worded differently",
+			err:    errors.New("Error 1213: Deadlock found when trying to get lock"),
+			aborts: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := finishImportRow(ImportRowResult{Action: ImportActionCreate}, c.err)
+			if c.aborts {
+				if err == nil {
+					t.Fatalf("got row result %+v, want the import aborted", result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("import aborted with %v, want a row error", err)
+			}
+			if result.Action != ImportActionError || len(result.Errors) != 1 || result.Errors[0] != c.message {
+				t.Errorf("got %s with errors %q, want error %q", result.Action, result.Errors, c.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,870 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+	"nexark-user-backend/pkg/rcon"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CatalogService is the admin side of the shop: it creates and edits
+// categories and items and records every change in the item change log.
+type CatalogService struct {
+	db *gorm.DB
+}
+
+func NewCatalogService(db *gorm.DB) *CatalogService {
+	return &CatalogService{db: db}
+}
+
+// catalogValidationError marks input the catalog rejects, as opposed to a
+// failure to read or write it. Imports report it against the row.
+type catalogValidationError struct {
+	err error
+}
+
+func (e *catalogValidationError) Error() string { return e.err.Error() }
+func (e *catalogValidationError) Unwrap() error { return e.err }
+
+// validationErrorf formats a catalogValidationError like fmt.Errorf
+func validationErrorf(format string, args ...interface{}) error {
+	return &catalogValidationError{err: fmt.Errorf(format, args...)}
+}
+
+// CategoryInput creates or partially updates a category; nil fields are left
+// unchanged. An empty string clears an optional text field.
+type CategoryInput struct {
+	CategoryKey    *string `json:"category_key,omitempty"`
+	CategoryName   *string `json:"category_name,omitempty"`
+	CategoryNameEN *string `json:"category_name_en,omitempty"`
+	CategoryNameTH *string `json:"category_name_th,omitempty"`
+	Description    *string `json:"description,omitempty"`
+	DescriptionEN  *string `json:"description_en,omitempty"`
+	DescriptionTH  *string `json:"description_th,omitempty"`
+	IconURL        *string `json:"icon_url,omitempty"`
+	DisplayOrder   *int    `json:"display_order,omitempty"`
+	IsActive       *bool   `json:"is_active,omitempty"`
+}
+
+// ItemInput creates or partially updates an item; nil fields are left
+// unchanged. An empty string clears an optional text field.
+type ItemInput struct {
+	CategoryID    *uint         `json:"category_id,omitempty"`
+	ItemName      *string       `json:"item_name,omitempty"`
+	ItemNameEN    *string       `json:"item_name_en,omitempty"`
+	ItemNameTH    *string       `json:"item_name_th,omitempty"`
+	ItemCode      *string       `json:"item_code,omitempty"`
+	Description   *string       `json:"description,omitempty"`
+	DescriptionEN *string       `json:"description_en,omitempty"`
+	DescriptionTH *string       `json:"description_th,omitempty"`
+	Price         *money.Amount `json:"price,omitempty"`
+	RCONCommand   *string       `json:"rcon_command,omitempty"`
+	ImageURL      *string       `json:"image_url,omitempty"`
+	StockQuantity *int          `json:"stock_quantity,omitempty"`
+	DisplayOrder  *int          `json:"display_order,omitempty"`
+	IsFeatured    *bool         `json:"is_featured,omitempty"`
+	IsActive      *bool         `json:"is_active,omitempty"`
+	// DeliverySteps replaces the item's steps, run in list order. An empty
+	// list removes them so the item is delivered with RCONCommand again.
+	DeliverySteps *[]DeliveryStepInput `json:"delivery_steps,omitempty"`
+}
+
+// DeliveryStepInput is one RCON command of a multi-step delivery
+type DeliveryStepInput struct {
+	RCONCommand    string  `json:"rcon_command"`
+	DelaySeconds   int     `json:"delay_seconds"`
+	SuccessPattern *string `json:"success_pattern,omitempty"`
+}
+
+// ServerAvailabilityInput is an item's availability on one server. Nil
+// overrides fall back to the item's own price and command.
+type ServerAvailabilityInput struct {
+	ServerID    uint          `json:"server_id" binding:"required"`
+	IsAvailable *bool         `json:"is_available"`
+	Price       *money.Amount `json:"price"`
+	RCONCommand *string       `json:"rcon_command"`
+}
+
+// AdminItemFilter narrows the admin item list; zero values match all
+type AdminItemFilter struct {
+	CategoryID uint
+	// Query matches part of the item name or code
+	Query           string
+	IncludeInactive bool
+}
+
+// Fields compared for the change log, by JSON name
+var (
+	categoryLogFields = []string{
+		"category_key", "category_name", "category_name_en", "category_name_th",
+		"description", "description_en", "description_th",
+		"icon_url", "display_order", "is_active",
+	}
+	itemLogFields = []string{
+		"category_id", "item_name", "item_name_en", "item_name_th", "item_code",
+		"description", "description_en", "description_th",
+		"price", "rcon_command", "image_url", "stock_quantity",
+		"display_order", "is_featured", "is_active",
+	}
+)
+
+// GetCategories returns categories in display order, including inactive ones
+// when includeInactive is set
+func (s *CatalogService) GetCategories(ctx context.Context, includeInactive bool) ([]models.ItemCategory, error) {
+	query := s.db.Order("display_order ASC, category_id ASC")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var categories []models.ItemCategory
+	if err := query.Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+func (s *CatalogService) CreateCategory(ctx context.Context, input CategoryInput, adminID uint) (*models.ItemCategory, error) {
+	var category *models.ItemCategory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		category, _, err = s.createCategory(tx, input, adminID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+func (s *CatalogService) UpdateCategory(ctx context.Context, categoryID uint, input CategoryInput, adminID uint) (*models.ItemCategory, error) {
+	var category *models.ItemCategory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		category, _, err = s.updateCategory(tx, categoryID, input, adminID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// createCategory creates a category in tx and returns the logged changes.
+// Categories created without a key are keyed category_<id>.
+func (s *CatalogService) createCategory(tx *gorm.DB, input CategoryInput, adminID uint) (*models.ItemCategory, models.JSONMap, error) {
+	category := models.ItemCategory{IsActive: true}
+	applyCategoryInput(&category, input)
+	if category.CategoryNameEN == "" {
+		category.CategoryNameEN = category.CategoryName
+	}
+	if category.CategoryNameTH == "" {
+		category.CategoryNameTH = category.CategoryName
+	}
+
+	if err := validateCategory(tx, &category); err != nil {
+		return nil, nil, err
+	}
+
+	desired := category
+	if err := tx.Create(&category).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create category: %w", err)
+	}
+	if desired.CategoryKey == nil {
+		key := fmt.Sprintf("category_%d", category.CategoryID)
+		desired.CategoryKey = &key
+	}
+	// Create replaces zero values with column defaults
+	if err := tx.Model(&category).Updates(map[string]interface{}{
+		"category_key":  desired.CategoryKey,
+		"is_active":     desired.IsActive,
+		"display_order": desired.DisplayOrder,
+	}).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create category: %w", err)
+	}
+	category.CategoryKey = desired.CategoryKey
+	category.IsActive = desired.IsActive
+	category.DisplayOrder = desired.DisplayOrder
+
+	changes := diffFields(models.ItemCategory{}, category, categoryLogFields)
+	if err := s.logChange(tx, models.ChangeEntityCategory, category.CategoryID, models.ChangeActionCreate, changes, adminID); err != nil {
+		return nil, nil, err
+	}
+
+	return &category, changes, nil
+}
+
+// updateCategory applies input to a category in tx and returns the logged
+// changes, which are empty when nothing changed
+func (s *CatalogService) updateCategory(tx *gorm.DB, categoryID uint, input CategoryInput, adminID uint) (*models.ItemCategory, models.JSONMap, error) {
+	var category models.ItemCategory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, categoryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("category not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	before := category
+	applyCategoryInput(&category, input)
+	if err := validateCategory(tx, &category); err != nil {
+		return nil, nil, err
+	}
+
+	changes := diffFields(before, category, categoryLogFields)
+	if len(changes) == 0 {
+		return &category, changes, nil
+	}
+
+	if err := tx.Save(&category).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update category: %w", err)
+	}
+
+	if err := s.logChange(tx, models.ChangeEntityCategory, category.CategoryID, models.ChangeActionUpdate, changes, adminID); err != nil {
+		return nil, nil, err
+	}
+
+	return &category, changes, nil
+}
+
+// DeactivateCategory hides a category. Categories are never deleted because
+// items and past transactions refer to them.
+func (s *CatalogService) DeactivateCategory(ctx context.Context, categoryID uint, adminID uint) error {
+	return s.deactivate(models.ChangeEntityCategory, &models.ItemCategory{}, "category_id", categoryID, adminID)
+}
+
+// GetItems returns items for the admin catalog, with inactive ones when asked
+func (s *CatalogService) GetItems(ctx context.Context, filter AdminItemFilter, limit, offset int) ([]models.Item, int64, error) {
+	query := s.db.Model(&models.Item{})
+	if filter.CategoryID != 0 {
+		query = query.Where("category_id = ?", filter.CategoryID)
+	}
+	if !filter.IncludeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("item_name LIKE ? OR item_code LIKE ?", like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count items: %w", err)
+	}
+
+	var items []models.Item
+	err := query.Order("category_id ASC, display_order ASC, item_id ASC").
+		Limit(limit).
+		Offset(offset).
+		Preload("Category").
+		Find(&items).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get items: %w", err)
+	}
+
+	return items, total, nil
+}
+
+// GetItem returns an item with its delivery steps and server availability,
+// active or not
+func (s *CatalogService) GetItem(ctx context.Context, itemID uint) (*models.Item, error) {
+	var item models.Item
+	err := s.db.Preload("Category").
+		Preload("DeliverySteps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("step_order ASC")
+		}).
+		Preload("ServerAvailability", func(db *gorm.DB) *gorm.DB {
+			return db.Order("server_id ASC")
+		}).
+		First(&item, itemID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	return &item, nil
+}
+
+func (s *CatalogService) CreateItem(ctx context.Context, input ItemInput, adminID uint) (*models.Item, error) {
+	var item *models.Item
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		item, _, err = s.createItem(tx, input, adminID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetItem(ctx, item.ItemID)
+}
+
+func (s *CatalogService) UpdateItem(ctx context.Context, itemID uint, input ItemInput, adminID uint) (*models.Item, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		_, _, err := s.updateItem(tx, itemID, input, adminID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetItem(ctx, itemID)
+}
+
+// createItem creates an item in tx and returns the logged changes
+func (s *CatalogService) createItem(tx *gorm.DB, input ItemInput, adminID uint) (*models.Item, models.JSONMap, error) {
+	item := models.Item{
+		StockQuantity: -1,
+		IsActive:      true,
+	}
+	applyItemInput(&item, input)
+	if item.ItemNameEN == "" {
+		item.ItemNameEN = item.ItemName
+	}
+	if item.ItemNameTH == "" {
+		item.ItemNameTH = item.ItemName
+	}
+	item.CreatedBy = &adminID
+
+	if err := validateItem(tx, &item); err != nil {
+		return nil, nil, err
+	}
+	steps, err := deliveryStepRows(input.DeliverySteps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desired := item
+	if err := tx.Omit(clause.Associations).Create(&item).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create item: %w", err)
+	}
+	// Create replaces zero values with column defaults, e.g. a stock of 0
+	// with -1 (unlimited)
+	if err := tx.Model(&item).Updates(map[string]interface{}{
+		"stock_quantity": desired.StockQuantity,
+		"is_active":      desired.IsActive,
+		"is_featured":    desired.IsFeatured,
+		"display_order":  desired.DisplayOrder,
+	}).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create item: %w", err)
+	}
+	item.StockQuantity = desired.StockQuantity
+	item.IsActive = desired.IsActive
+	item.IsFeatured = desired.IsFeatured
+	item.DisplayOrder = desired.DisplayOrder
+
+	changes := diffFields(models.Item{}, item, itemLogFields)
+	if steps != nil {
+		stepChanges, err := replaceDeliverySteps(tx, &item, steps)
+		if err != nil {
+			return nil, nil, err
+		}
+		for field, change := range stepChanges {
+			changes[field] = change
+		}
+	}
+	if err := s.logChange(tx, models.ChangeEntityItem, item.ItemID, models.ChangeActionCreate, changes, adminID); err != nil {
+		return nil, nil, err
+	}
+
+	return &item, changes, nil
+}
+
+// updateItem applies input to an item in tx and returns the logged changes,
+// which are empty when nothing changed
+func (s *CatalogService) updateItem(tx *gorm.DB, itemID uint, input ItemInput, adminID uint) (*models.Item, models.JSONMap, error) {
+	var item models.Item
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, itemID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("item not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	before := item
+	applyItemInput(&item, input)
+	if err := validateItem(tx, &item); err != nil {
+		return nil, nil, err
+	}
+	steps, err := deliveryStepRows(input.DeliverySteps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := diffFields(before, item, itemLogFields)
+	if len(changes) > 0 {
+		if err := tx.Omit(clause.Associations).Save(&item).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to update item: %w", err)
+		}
+	}
+	if steps != nil {
+		stepChanges, err := replaceDeliverySteps(tx, &item, steps)
+		if err != nil {
+			return nil, nil, err
+		}
+		for field, change := range stepChanges {
+			changes[field] = change
+		}
+	}
+	if len(changes) == 0 {
+		return &item, changes, nil
+	}
+
+	if err := s.logChange(tx, models.ChangeEntityItem, item.ItemID, models.ChangeActionUpdate, changes, adminID); err != nil {
+		return nil, nil, err
+	}
+
+	return &item, changes, nil
+}
+
+// DeactivateItem takes an item off sale. Items are never deleted because
+// transactions refer to them.
+func (s *CatalogService) DeactivateItem(ctx context.Context, itemID uint, adminID uint) error {
+	return s.deactivate(models.ChangeEntityItem, &models.Item{}, "item_id", itemID, adminID)
+}
+
+// SetItemAvailability replaces the servers an item is sold on. An empty list
+// sells the item on every server at its base price again.
+func (s *CatalogService) SetItemAvailability(ctx context.Context, itemID uint, inputs []ServerAvailabilityInput, adminID uint) (*models.Item, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, itemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("item not found")
+			}
+			return fmt.Errorf("failed to get item: %w", err)
+		}
+
+		rows, err := availabilityRows(tx, &item, inputs)
+		if err != nil {
+			return err
+		}
+
+		var before []models.ItemServerAvailability
+		if err := tx.Where("item_id = ?", itemID).Order("server_id ASC").Find(&before).Error; err != nil {
+			return fmt.Errorf("failed to get item availability: %w", err)
+		}
+
+		changes := diffFields(
+			map[string]interface{}{"server_availability": availabilityLogValue(before)},
+			map[string]interface{}{"server_availability": availabilityLogValue(rows)},
+			[]string{"server_availability"},
+		)
+		if len(changes) == 0 {
+			return nil
+		}
+
+		if err := tx.Where("item_id = ?", itemID).Delete(&models.ItemServerAvailability{}).Error; err != nil {
+			return fmt.Errorf("failed to update item availability: %w", err)
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return fmt.Errorf("failed to update item availability: %w", err)
+			}
+		}
+
+		return s.logChange(tx, models.ChangeEntityItem, itemID, models.ChangeActionUpdate, changes, adminID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetItem(ctx, itemID)
+}
+
+// availabilityRows validates inputs for item and converts them to rows in
+// server order
+func availabilityRows(tx *gorm.DB, item *models.Item, inputs []ServerAvailabilityInput) ([]models.ItemServerAvailability, error) {
+	var stepCount int64
+	if err := tx.Model(&models.ItemDeliveryStep{}).Where("item_id = ?", item.ItemID).Count(&stepCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delivery steps: %w", err)
+	}
+
+	rows := make([]models.ItemServerAvailability, 0, len(inputs))
+	seen := map[uint]bool{}
+	for _, input := range inputs {
+		if seen[input.ServerID] {
+			return nil, validationErrorf("invalid availability: server %d is listed more than once", input.ServerID)
+		}
+		seen[input.ServerID] = true
+
+		var count int64
+		if err := tx.Model(&models.Server{}).Where("server_id = ?", input.ServerID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to get server: %w", err)
+		}
+		if count == 0 {
+			return nil, validationErrorf("invalid availability: server %d does not exist", input.ServerID)
+		}
+
+		row := models.ItemServerAvailability{
+			ItemID:        item.ItemID,
+			ServerID:      input.ServerID,
+			IsAvailable:   input.IsAvailable == nil || *input.IsAvailable,
+			PriceOverride: input.Price,
+		}
+		if input.Price != nil && *input.Price < 0 {
+			return nil, validationErrorf("invalid availability: price for server %d must not be negative", input.ServerID)
+		}
+		if input.RCONCommand != nil && *input.RCONCommand != "" {
+			if stepCount > 0 {
+				return nil, validationErrorf("invalid availability: items with delivery steps can't override the RCON command")
+			}
+			if err := rcon.ValidateCommandTemplate(*input.RCONCommand); err != nil {
+				return nil, validationErrorf("invalid availability: rcon_command for server %d: %w", input.ServerID, err)
+			}
+			row.RCONCommandOverride = input.RCONCommand
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ServerID < rows[j].ServerID })
+	return rows, nil
+}
+
+// availabilityLogValue is the change log form of an item's availability rows
+func availabilityLogValue(rows []models.ItemServerAvailability) []map[string]interface{} {
+	values := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = map[string]interface{}{
+			"server_id":             row.ServerID,
+			"is_available":          row.IsAvailable,
+			"price_override":        row.PriceOverride,
+			"rcon_command_override": row.RCONCommandOverride,
+		}
+	}
+	return values
+}
+
+// deliveryStepRows validates step inputs and converts them to rows numbered in
+// list order. It returns nil when inputs is nil, i.e. the steps are unchanged.
+func deliveryStepRows(inputs *[]DeliveryStepInput) ([]models.ItemDeliveryStep, error) {
+	if inputs == nil {
+		return nil, nil
+	}
+
+	rows := make([]models.ItemDeliveryStep, 0, len(*inputs))
+	for i, input := range *inputs {
+		command := strings.TrimSpace(input.RCONCommand)
+		if err := rcon.ValidateCommandTemplate(command); err != nil {
+			return nil, validationErrorf("invalid item: delivery step %d: rcon_command: %w", i+1, err)
+		}
+		if input.DelaySeconds < 0 || input.DelaySeconds > models.MaxDeliveryStepDelaySeconds {
+			return nil, validationErrorf("invalid item: delivery step %d: delay_seconds must be between 0 and %d",
+				i+1, models.MaxDeliveryStepDelaySeconds)
+		}
+
+		row := models.ItemDeliveryStep{
+			StepOrder:    i + 1,
+			RCONCommand:  command,
+			DelaySeconds: input.DelaySeconds,
+		}
+		setOptionalString(&row.SuccessPattern, input.SuccessPattern)
+		if row.SuccessPattern != nil {
+			if _, err := regexp.Compile(*row.SuccessPattern); err != nil {
+				return nil, validationErrorf("invalid item: delivery step %d: success_pattern: %v", i+1, err)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// replaceDeliverySteps swaps an item's delivery steps for rows and returns the
+// logged change, which is empty when the steps are the same
+func replaceDeliverySteps(tx *gorm.DB, item *models.Item, rows []models.ItemDeliveryStep) (models.JSONMap, error) {
+	var before []models.ItemDeliveryStep
+	if err := tx.Where("item_id = ?", item.ItemID).Order("step_order ASC").Find(&before).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delivery steps: %w", err)
+	}
+
+	changes := diffFields(
+		map[string]interface{}{"delivery_steps": deliveryStepLogValue(before)},
+		map[string]interface{}{"delivery_steps": deliveryStepLogValue(rows)},
+		[]string{"delivery_steps"},
+	)
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	if len(rows) > 0 {
+		var overrides int64
+		if err := tx.Model(&models.ItemServerAvailability{}).
+			Where("item_id = ? AND rcon_command_override IS NOT NULL AND rcon_command_override <> ''", item.ItemID).
+			Count(&overrides).Error; err != nil {
+			return nil, fmt.Errorf("failed to get item availability: %w", err)
+		}
+		if overrides > 0 {
+			return nil, validationErrorf("invalid item: items with server RCON command overrides can't have delivery steps")
+		}
+	}
+
+	if err := tx.Where("item_id = ?", item.ItemID).Delete(&models.ItemDeliveryStep{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update delivery steps: %w", err)
+	}
+	for i := range rows {
+		rows[i].ItemID = item.ItemID
+	}
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to update delivery steps: %w", err)
+		}
+	}
+
+	return changes, nil
+}
+
+// deliveryStepLogValue is the change log form of an item's delivery steps
+func deliveryStepLogValue(steps []models.ItemDeliveryStep) []map[string]interface{} {
+	values := make([]map[string]interface{}, len(steps))
+	for i, step := range steps {
+		values[i] = map[string]interface{}{
+			"step_order":      step.StepOrder,
+			"rcon_command":    step.RCONCommand,
+			"delay_seconds":   step.DelaySeconds,
+			"success_pattern": step.SuccessPattern,
+		}
+	}
+	return values
+}
+
+// GetChangeLog returns catalog changes, newest first. An empty entityType or
+// zero entityID matches all.
+func (s *CatalogService) GetChangeLog(ctx context.Context, entityType string, entityID uint, limit, offset int) ([]models.ItemChangeLog, int64, error) {
+	query := s.db.Model(&models.ItemChangeLog{})
+	if entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID != 0 {
+		query = query.Where("entity_id = ?", entityID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count change log: %w", err)
+	}
+
+	var entries []models.ItemChangeLog
+	if err := query.Order("changed_at DESC, change_id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get change log: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+func (s *CatalogService) deactivate(entityType string, model interface{}, idColumn string, id uint, adminID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var rows []bool
+		err := tx.Model(model).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(idColumn+" = ?", id).
+			Pluck("is_active", &rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to get %s: %w", entityType, err)
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("%s not found", entityType)
+		}
+		if !rows[0] {
+			return nil
+		}
+
+		if err := tx.Model(model).Where(idColumn+" = ?", id).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to deactivate %s: %w", entityType, err)
+		}
+
+		changes := models.JSONMap{"is_active": map[string]interface{}{"old": true, "new": false}}
+		return s.logChange(tx, entityType, id, models.ChangeActionDeactivate, changes, adminID)
+	})
+}
+
+func (s *CatalogService) logChange(tx *gorm.DB, entityType string, entityID uint, action string, changes models.JSONMap, adminID uint) error {
+	entry := models.ItemChangeLog{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+		ChangedBy:  &adminID,
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to write change log: %w", err)
+	}
+	return nil
+}
+
+func applyCategoryInput(category *models.ItemCategory, input CategoryInput) {
+	setOptionalString(&category.CategoryKey, input.CategoryKey)
+	setString(&category.CategoryName, input.CategoryName)
+	setString(&category.CategoryNameEN, input.CategoryNameEN)
+	setString(&category.CategoryNameTH, input.CategoryNameTH)
+	setOptionalString(&category.Description, input.Description)
+	setOptionalString(&category.DescriptionEN, input.DescriptionEN)
+	setOptionalString(&category.DescriptionTH, input.DescriptionTH)
+	setOptionalString(&category.IconURL, input.IconURL)
+	if input.DisplayOrder != nil {
+		category.DisplayOrder = *input.DisplayOrder
+	}
+	if input.IsActive != nil {
+		category.IsActive = *input.IsActive
+	}
+}
+
+func applyItemInput(item *models.Item, input ItemInput) {
+	if input.CategoryID != nil {
+		item.CategoryID = *input.CategoryID
+	}
+	setString(&item.ItemName, input.ItemName)
+	setString(&item.ItemNameEN, input.ItemNameEN)
+	setString(&item.ItemNameTH, input.ItemNameTH)
+	setString(&item.ItemCode, input.ItemCode)
+	setOptionalString(&item.Description, input.Description)
+	setOptionalString(&item.DescriptionEN, input.DescriptionEN)
+	setOptionalString(&item.DescriptionTH, input.DescriptionTH)
+	if input.Price != nil {
+		item.Price = *input.Price
+	}
+	if input.RCONCommand != nil {
+		item.RCONCommand = strings.TrimSpace(*input.RCONCommand)
+	}
+	setOptionalString(&item.ImageURL, input.ImageURL)
+	if input.StockQuantity != nil {
+		item.StockQuantity = *input.StockQuantity
+	}
+	if input.DisplayOrder != nil {
+		item.DisplayOrder = *input.DisplayOrder
+	}
+	if input.IsFeatured != nil {
+		item.IsFeatured = *input.IsFeatured
+	}
+	if input.IsActive != nil {
+		item.IsActive = *input.IsActive
+	}
+}
+
+// categoryKeyPattern keeps keys safe to use in CSV files and URLs
+var categoryKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// validateCategory checks a category before it is saved, including that its
+// key is unique
+func validateCategory(tx *gorm.DB, category *models.ItemCategory) error {
+	if category.CategoryName == "" {
+		return validationErrorf("invalid category: category_name is required")
+	}
+	if category.CategoryKey == nil {
+		return nil
+	}
+	if !categoryKeyPattern.MatchString(*category.CategoryKey) {
+		return validationErrorf("invalid category: category_key may only contain a-z, 0-9, _ and -")
+	}
+
+	var count int64
+	if err := tx.Model(&models.ItemCategory{}).
+		Where("category_key = ? AND category_id <> ?", *category.CategoryKey, category.CategoryID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check category key: %w", err)
+	}
+	if count > 0 {
+		return validationErrorf("category key %s already exists", *category.CategoryKey)
+	}
+	return nil
+}
+
+// validateItem checks an item before it is saved, including that its
+// category exists and its item code is unique
+func validateItem(tx *gorm.DB, item *models.Item) error {
+	if item.ItemName == "" {
+		return validationErrorf("invalid item: item_name is required")
+	}
+	if item.ItemCode == "" {
+		return validationErrorf("invalid item: item_code is required")
+	}
+	if item.Price < 0 {
+		return validationErrorf("invalid item: price must not be negative")
+	}
+	if item.StockQuantity < -1 {
+		return validationErrorf("invalid item: stock_quantity must be -1 (unlimited) or more")
+	}
+	if err := rcon.ValidateCommandTemplate(item.RCONCommand); err != nil {
+		return validationErrorf("invalid item: rcon_command: %w", err)
+	}
+
+	var count int64
+	if err := tx.Model(&models.ItemCategory{}).Where("category_id = ?", item.CategoryID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to get category: %w", err)
+	}
+	if count == 0 {
+		return validationErrorf("invalid item: category %d does not exist", item.CategoryID)
+	}
+
+	if err := tx.Model(&models.Item{}).
+		Where("item_code = ? AND item_id <> ?", item.ItemCode, item.ItemID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check item code: %w", err)
+	}
+	if count > 0 {
+		return validationErrorf("item code %s already exists", item.ItemCode)
+	}
+
+	return nil
+}
+
+// diffFields returns {"field": {"old": ..., "new": ...}} for the JSON fields
+// that differ between before and after
+func diffFields(before, after interface{}, fields []string) models.JSONMap {
+	oldValues := toJSONMap(before)
+	newValues := toJSONMap(after)
+
+	changes := models.JSONMap{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(oldValues[field], newValues[field]) {
+			changes[field] = map[string]interface{}{
+				"old": oldValues[field],
+				"new": newValues[field],
+			}
+		}
+	}
+	return changes
+}
+
+func toJSONMap(v interface{}) map[string]interface{} {
+	data, _ := json.Marshal(v)
+	values := map[string]interface{}{}
+	json.Unmarshal(data, &values)
+	return values
+}
+
+func setString(target *string, value *string) {
+	if value != nil {
+		*target = strings.TrimSpace(*value)
+	}
+}
+
+func setOptionalString(target **string, value *string) {
+	if value == nil {
+		return
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		*target = nil
+		return
+	}
+	*target = &trimmed
+}
@@ -0,0 +1,575 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,64}$`)
+
+// CouponService manages discount coupons and works out the discount a coupon
+// gives on a purchase.
+type CouponService struct {
+	db             *gorm.DB
+	pricingService *PricingService
+}
+
+func NewCouponService(db *gorm.DB, pricingService *PricingService) *CouponService {
+	return &CouponService{
+		db:             db,
+		pricingService: pricingService,
+	}
+}
+
+// CouponInput creates or partially updates a coupon; nil fields are left
+// unchanged. 0 removes a limit and an empty string clears a date or the
+// description. Codes are case-insensitive and stored upper case.
+type CouponInput struct {
+	Code           *string       `json:"code"`
+	Description    *string       `json:"description"`
+	DiscountType   *string       `json:"discount_type"`
+	DiscountValue  *money.Amount `json:"discount_value"`
+	MaxDiscount    *money.Amount `json:"max_discount"`
+	ItemID         *uint         `json:"item_id"`
+	CategoryID     *uint         `json:"category_id"`
+	ServerID       *uint         `json:"server_id"`
+	MinOrderAmount *money.Amount `json:"min_order_amount"`
+	MaxUses        *int          `json:"max_uses"`
+	MaxUsesPerUser *int          `json:"max_uses_per_user"`
+	// StartsAt and EndsAt are RFC3339 times
+	StartsAt *string `json:"starts_at"`
+	EndsAt   *string `json:"ends_at"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// CouponLine is one purchase line a coupon may apply to. Amount is the line
+// total before discount.
+type CouponLine struct {
+	ItemID     uint
+	CategoryID uint
+	ServerID   uint
+	Amount     money.Amount
+}
+
+// CouponApplication is the discount a coupon gives on a set of lines.
+// Discounts holds the share of Total for each line, in line order.
+type CouponApplication struct {
+	Coupon    models.Coupon
+	Discounts []money.Amount
+	Total     money.Amount
+}
+
+// CouponPreview is the outcome of checking a coupon against a basket
+type CouponPreview struct {
+	Code     string       `json:"code"`
+	Subtotal money.Amount `json:"subtotal"`
+	Discount money.Amount `json:"discount"`
+	Total    money.Amount `json:"total"`
+}
+
+// GetCoupons returns coupons, newest first, including inactive ones when
+// includeInactive is set
+func (s *CouponService) GetCoupons(ctx context.Context, includeInactive bool, limit, offset int) ([]models.Coupon, int64, error) {
+	query := s.db.Model(&models.Coupon{})
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count coupons: %w", err)
+	}
+
+	var coupons []models.Coupon
+	if err := query.Order("created_at DESC, coupon_id DESC").Limit(limit).Offset(offset).Find(&coupons).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get coupons: %w", err)
+	}
+
+	return coupons, total, nil
+}
+
+func (s *CouponService) GetCoupon(ctx context.Context, couponID uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := s.db.First(&coupon, couponID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("coupon not found")
+		}
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	return &coupon, nil
+}
+
+func (s *CouponService) CreateCoupon(ctx context.Context, input CouponInput, adminID uint) (*models.Coupon, error) {
+	coupon := models.Coupon{IsActive: true, CreatedBy: &adminID}
+	if err := applyCouponInput(&coupon, input); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := validateCoupon(tx, &coupon); err != nil {
+			return err
+		}
+
+		desired := coupon
+		if err := tx.Create(&coupon).Error; err != nil {
+			return fmt.Errorf("failed to create coupon: %w", err)
+		}
+		// Create replaces is_active = false with the column default
+		if !desired.IsActive {
+			if err := tx.Model(&coupon).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to create coupon: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCoupon(ctx, coupon.CouponID)
+}
+
+func (s *CouponService) UpdateCoupon(ctx context.Context, couponID uint, input CouponInput) (*models.Coupon, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, couponID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("coupon not found")
+			}
+			return fmt.Errorf("failed to get coupon: %w", err)
+		}
+
+		if err := applyCouponInput(&coupon, input); err != nil {
+			return err
+		}
+		if err := validateCoupon(tx, &coupon); err != nil {
+			return err
+		}
+
+		if err := tx.Save(&coupon).Error; err != nil {
+			return fmt.Errorf("failed to update coupon: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCoupon(ctx, couponID)
+}
+
+// DeactivateCoupon stops a coupon from being used. Coupons are kept for the
+// purchases that used them.
+func (s *CouponService) DeactivateCoupon(ctx context.Context, couponID uint) error {
+	result := s.db.Model(&models.Coupon{}).Where("coupon_id = ?", couponID).Update("is_active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to deactivate coupon: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetCoupon(ctx, couponID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRedemptions returns the purchases that used a coupon, newest first
+func (s *CouponService) GetRedemptions(ctx context.Context, couponID uint, limit, offset int) ([]models.CouponRedemption, int64, error) {
+	query := s.db.Model(&models.CouponRedemption{}).Where("coupon_id = ?", couponID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count coupon redemptions: %w", err)
+	}
+
+	var redemptions []models.CouponRedemption
+	if err := query.Order("created_at DESC, redemption_id DESC").Limit(limit).Offset(offset).Find(&redemptions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get coupon redemptions: %w", err)
+	}
+
+	return redemptions, total, nil
+}
+
+// PreviewCoupon works out the discount code would give on items at current
+// prices without using it
+func (s *CouponService) PreviewCoupon(ctx context.Context, userID uint, code string, items []PurchaseItem) (*CouponPreview, error) {
+	lines := make([]CouponLine, 0, len(items))
+	var subtotal money.Amount
+
+	for _, purchaseItem := range items {
+		var item models.Item
+		if err := s.db.Where("item_id = ? AND is_active = ?", purchaseItem.ItemID, true).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("item %d not found or inactive", purchaseItem.ItemID)
+			}
+			return nil, fmt.Errorf("failed to get item: %w", err)
+		}
+
+		offer, err := s.pricingService.ResolveOffer(s.db, &item, purchaseItem.ServerID)
+		if err != nil {
+			return nil, err
+		}
+		if !offer.Available {
+			return nil, fmt.Errorf("item %s is not available on server %d", item.ItemName, purchaseItem.ServerID)
+		}
+
+		amount := offer.Price.Mul(purchaseItem.Quantity)
+		subtotal += amount
+		lines = append(lines, CouponLine{
+			ItemID:     item.ItemID,
+			CategoryID: item.CategoryID,
+			ServerID:   purchaseItem.ServerID,
+			Amount:     amount,
+		})
+	}
+
+	application, err := s.applyCoupon(s.db, code, userID, lines, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CouponPreview{
+		Code:     application.Coupon.Code,
+		Subtotal: subtotal,
+		Discount: application.Total,
+		Total:    subtotal - application.Total,
+	}, nil
+}
+
+// ApplyCoupon checks code for userID and works out its discount on lines. The
+// coupon row stays locked until tx ends, so usage caps hold under concurrent
+// purchases; call Redeem in the same transaction once the purchase is made.
+func (s *CouponService) ApplyCoupon(tx *gorm.DB, code string, userID uint, lines []CouponLine) (*CouponApplication, error) {
+	return s.applyCoupon(tx, code, userID, lines, true)
+}
+
+// Redeem counts a use of the applied coupon against a purchase. The redemption
+// is stored against the first transaction, and every discounted transaction
+// is linked to it so a refund can reverse its share.
+func (s *CouponService) Redeem(tx *gorm.DB, application *CouponApplication, userID uint, transactions []*models.Transaction) error {
+	if err := tx.Model(&models.Coupon{}).
+		Where("coupon_id = ?", application.Coupon.CouponID).
+		Update("uses_count", gorm.Expr("uses_count + 1")).Error; err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+
+	redemption := models.CouponRedemption{
+		CouponID:       application.Coupon.CouponID,
+		UserID:         userID,
+		TransactionID:  transactions[0].TransactionID,
+		DiscountAmount: application.Total,
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+
+	for _, transaction := range transactions {
+		if transaction.CouponID == nil {
+			continue
+		}
+		if err := tx.Model(transaction).
+			Update("coupon_redemption_id", redemption.RedemptionID).Error; err != nil {
+			return fmt.Errorf("failed to redeem coupon: %w", err)
+		}
+		transaction.CouponRedemptionID = &redemption.RedemptionID
+	}
+
+	return nil
+}
+
+// ReverseRedemption takes a refunded transaction's discount off its coupon
+// redemption. Once the whole discount is reversed the redemption is deleted
+// and the use is given back to the coupon.
+func (s *CouponService) ReverseRedemption(tx *gorm.DB, transaction *models.Transaction) error {
+	if transaction.CouponRedemptionID == nil {
+		return nil
+	}
+
+	var redemption models.CouponRedemption
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("redemption_id = ?", *transaction.CouponRedemptionID).
+		First(&redemption).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get coupon redemption: %w", err)
+	}
+
+	remaining := redemption.DiscountAmount - transaction.DiscountAmount
+	if remaining > 0 {
+		if err := tx.Model(&redemption).Update("discount_amount", remaining).Error; err != nil {
+			return fmt.Errorf("failed to reverse coupon redemption: %w", err)
+		}
+		return nil
+	}
+
+	if err := tx.Delete(&redemption).Error; err != nil {
+		return fmt.Errorf("failed to reverse coupon redemption: %w", err)
+	}
+	if err := tx.Model(&models.Coupon{}).
+		Where("coupon_id = ? AND uses_count > 0", redemption.CouponID).
+		Update("uses_count", gorm.Expr("uses_count - 1")).Error; err != nil {
+		return fmt.Errorf("failed to reverse coupon redemption: %w", err)
+	}
+
+	return nil
+}
+
+func (s *CouponService) applyCoupon(tx *gorm.DB, code string, userID uint, lines []CouponLine, lock bool) (*CouponApplication, error) {
+	query := tx
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var coupon models.Coupon
+	err := query.Where("code = ? AND is_active = ?", normalizeCouponCode(code), true).First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("coupon not found")
+		}
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	now := time.Now()
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return nil, fmt.Errorf("coupon is not valid yet")
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return nil, fmt.Errorf("coupon has expired")
+	}
+	if coupon.MaxUses != nil && coupon.UsesCount >= *coupon.MaxUses {
+		return nil, fmt.Errorf("coupon usage limit reached")
+	}
+	if coupon.MaxUsesPerUser != nil {
+		var used int64
+		if err := tx.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.CouponID, userID).
+			Count(&used).Error; err != nil {
+			return nil, fmt.Errorf("failed to count coupon uses: %w", err)
+		}
+		if used >= int64(*coupon.MaxUsesPerUser) {
+			return nil, fmt.Errorf("coupon usage limit reached for this account")
+		}
+	}
+
+	eligible := make([]bool, len(lines))
+	var subtotal money.Amount
+	for i, line := range lines {
+		if coupon.ItemID != nil && *coupon.ItemID != line.ItemID ||
+			coupon.CategoryID != nil && *coupon.CategoryID != line.CategoryID ||
+			coupon.ServerID != nil && *coupon.ServerID != line.ServerID {
+			continue
+		}
+		eligible[i] = true
+		subtotal += line.Amount
+	}
+
+	if subtotal == 0 {
+		return nil, fmt.Errorf("coupon does not apply to these items")
+	}
+	if coupon.MinOrderAmount != nil && subtotal < *coupon.MinOrderAmount {
+		return nil, fmt.Errorf("coupon requires a minimum order of %s", *coupon.MinOrderAmount)
+	}
+
+	var discount money.Amount
+	switch coupon.DiscountType {
+	case models.CouponTypePercentage:
+		discount = subtotal.Percent(coupon.DiscountValue)
+		if coupon.MaxDiscount != nil && discount > *coupon.MaxDiscount {
+			discount = *coupon.MaxDiscount
+		}
+	default:
+		discount = coupon.DiscountValue
+	}
+	if discount > subtotal {
+		discount = subtotal
+	}
+
+	// Split the discount over the eligible lines by amount; rounding leftovers
+	// go to the last one
+	application := &CouponApplication{
+		Coupon:    coupon,
+		Discounts: make([]money.Amount, len(lines)),
+		Total:     discount,
+	}
+	remaining := discount
+	last := -1
+	for i, line := range lines {
+		if !eligible[i] {
+			continue
+		}
+		share := discount * line.Amount / subtotal
+		application.Discounts[i] = share
+		remaining -= share
+		last = i
+	}
+	application.Discounts[last] += remaining
+
+	return application, nil
+}
+
+func applyCouponInput(coupon *models.Coupon, input CouponInput) error {
+	if input.Code != nil {
+		coupon.Code = normalizeCouponCode(*input.Code)
+	}
+	setOptionalString(&coupon.Description, input.Description)
+	if input.DiscountType != nil {
+		coupon.DiscountType = *input.DiscountType
+	}
+	if input.DiscountValue != nil {
+		coupon.DiscountValue = *input.DiscountValue
+	}
+	setOptionalAmount(&coupon.MaxDiscount, input.MaxDiscount)
+	setOptionalUint(&coupon.ItemID, input.ItemID)
+	setOptionalUint(&coupon.CategoryID, input.CategoryID)
+	setOptionalUint(&coupon.ServerID, input.ServerID)
+	setOptionalAmount(&coupon.MinOrderAmount, input.MinOrderAmount)
+	setOptionalInt(&coupon.MaxUses, input.MaxUses)
+	setOptionalInt(&coupon.MaxUsesPerUser, input.MaxUsesPerUser)
+	if input.IsActive != nil {
+		coupon.IsActive = *input.IsActive
+	}
+
+	for _, field := range []struct {
+		name   string
+		value  *string
+		target **time.Time
+	}{
+		{"starts_at", input.StartsAt, &coupon.StartsAt},
+		{"ends_at", input.EndsAt, &coupon.EndsAt},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value == "" {
+			*field.target = nil
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			return fmt.Errorf("invalid coupon: %s must be an RFC3339 time", field.name)
+		}
+		*field.target = &t
+	}
+
+	return nil
+}
+
+func validateCoupon(tx *gorm.DB, coupon *models.Coupon) error {
+	if !couponCodePattern.MatchString(coupon.Code) {
+		return fmt.Errorf("invalid coupon: code must be 3-64 letters, digits, - or _")
+	}
+
+	switch coupon.DiscountType {
+	case models.CouponTypePercentage:
+		if coupon.DiscountValue <= 0 || coupon.DiscountValue > money.FromBaht(100) {
+			return fmt.Errorf("invalid coupon: percentage must be above 0 and at most 100")
+		}
+	case models.CouponTypeFixed:
+		if coupon.DiscountValue <= 0 {
+			return fmt.Errorf("invalid coupon: discount_value must be positive")
+		}
+		if coupon.MaxDiscount != nil {
+			return fmt.Errorf("invalid coupon: max_discount only applies to percentage coupons")
+		}
+	default:
+		return fmt.Errorf("invalid coupon: discount_type must be percentage or fixed")
+	}
+
+	if coupon.MaxDiscount != nil && *coupon.MaxDiscount < 0 ||
+		coupon.MinOrderAmount != nil && *coupon.MinOrderAmount < 0 ||
+		coupon.MaxUses != nil && *coupon.MaxUses < 0 ||
+		coupon.MaxUsesPerUser != nil && *coupon.MaxUsesPerUser < 0 {
+		return fmt.Errorf("invalid coupon: limits must not be negative")
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return fmt.Errorf("invalid coupon: ends_at must be after starts_at")
+	}
+
+	for _, ref := range []struct {
+		name  string
+		model interface{}
+		key   string
+		id    *uint
+	}{
+		{"item", &models.Item{}, "item_id", coupon.ItemID},
+		{"category", &models.ItemCategory{}, "category_id", coupon.CategoryID},
+		{"server", &models.Server{}, "server_id", coupon.ServerID},
+	} {
+		if ref.id == nil {
+			continue
+		}
+		var count int64
+		if err := tx.Model(ref.model).Where(ref.key+" = ?", *ref.id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to get %s: %w", ref.name, err)
+		}
+		if count == 0 {
+			return fmt.Errorf("invalid coupon: %s %d does not exist", ref.name, *ref.id)
+		}
+	}
+
+	var count int64
+	if err := tx.Model(&models.Coupon{}).
+		Where("code = ? AND coupon_id <> ?", coupon.Code, coupon.CouponID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check coupon code: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("coupon code %s already exists", coupon.Code)
+	}
+
+	return nil
+}
+
+// setOptionalAmount, setOptionalUint and setOptionalInt set a limit from
+// value, where 0 removes it
+func setOptionalAmount(target **money.Amount, value *money.Amount) {
+	if value == nil {
+		return
+	}
+	if *value == 0 {
+		*target = nil
+		return
+	}
+	v := *value
+	*target = &v
+}
+
+func setOptionalUint(target **uint, value *uint) {
+	if value == nil {
+		return
+	}
+	if *value == 0 {
+		*target = nil
+		return
+	}
+	v := *value
+	*target = &v
+}
+
+func setOptionalInt(target **int, value *int) {
+	if value == nil {
+		return
+	}
+	if *value == 0 {
+		*target = nil
+		return
+	}
+	v := *value
+	*target = &v
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"gorm.io/gorm"
 )
@@ -14,32 +15,36 @@ type CreditService struct {
 	db             *gorm.DB
 	userService    *UserService
 	paymentService *PaymentService
+	ledgerService  *LedgerService
 }
 
-func NewCreditService(db *gorm.DB, userService *UserService, paymentService *PaymentService) *CreditService {
+func NewCreditService(db *gorm.DB, userService *UserService, paymentService *PaymentService, ledgerService *LedgerService) *CreditService {
 	return &CreditService{
 		db:             db,
 		userService:    userService,
 		paymentService: paymentService,
+		ledgerService:  ledgerService,
 	}
 }
 
+// Amount limits are in satang: 100 to 50,000 THB
 type TopUpRequest struct {
-	Amount        float64 `json:"amount" binding:"required,min=100,max=50000"`
-	PaymentMethod string  `json:"payment_method" binding:"required"`
-	Currency      string  `json:"currency"`
+	Amount        money.Amount `json:"amount" binding:"required,min=10000,max=5000000"`
+	PaymentMethod string       `json:"payment_method" binding:"required"`
+	Currency      string       `json:"currency"`
 }
 
 type CreditBalance struct {
-	Balance         float64   `json:"balance"`
-	PendingPayments float64   `json:"pending_payments"`
-	LastUpdated     time.Time `json:"last_updated"`
+	Balance         money.Amount `json:"balance"`
+	PendingPayments money.Amount `json:"pending_payments"`
+	LastUpdated     time.Time    `json:"last_updated"`
 }
 
+// Amount is at least 1 THB
 type TransferRequest struct {
-	ToUserID    uint    `json:"to_user_id" binding:"required"`
-	Amount      float64 `json:"amount" binding:"required,min=1"`
-	Description string  `json:"description"`
+	ToUserID    uint         `json:"to_user_id" binding:"required"`
+	Amount      money.Amount `json:"amount" binding:"required,min=100"`
+	Description string       `json:"description"`
 }
 
 func (s *CreditService) GetCreditBalance(ctx context.Context, userID uint) (*CreditBalance, error) {
@@ -49,7 +54,7 @@ func (s *CreditService) GetCreditBalance(ctx context.Context, userID uint) (*Cre
 	}
 
 	// Get pending payments amount
-	var pendingAmount float64
+	var pendingAmount money.Amount
 	err = s.db.Model(&models.Payment{}).
 		Where("user_id = ? AND payment_status IN (?)", userID, []string{"pending", "processing"}).
 		Select("COALESCE(SUM(amount), 0)").
@@ -69,7 +74,7 @@ func (s *CreditService) GetCreditBalance(ctx context.Context, userID uint) (*Cre
 func (s *CreditService) TopUpCredits(ctx context.Context, userID uint, req TopUpRequest) (*models.Payment, string, error) {
 	// Set default currency
 	if req.Currency == "" {
-		req.Currency = "thb"
+		req.Currency = money.Currency
 	}
 
 	// Create a Stripe Checkout Session (hosted) through payment service
@@ -119,70 +124,50 @@ func (s *CreditService) GetCreditTransactions(ctx context.Context, userID uint,
 }
 
 func (s *CreditService) TransferCredits(ctx context.Context, fromUserID uint, req TransferRequest) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Get sender
-		fromUser, err := s.userService.GetUserByID(ctx, fromUserID)
-		if err != nil {
-			return fmt.Errorf("sender not found: %w", err)
-		}
-
-		// Get receiver
-		_, err = s.userService.GetUserByID(ctx, req.ToUserID)
-		if err != nil {
-			return fmt.Errorf("receiver not found: %w", err)
-		}
-
-		// Validate sender has sufficient balance
-		if fromUser.CreditBalance < req.Amount {
-			return fmt.Errorf("insufficient balance. Available: %.2f, Required: %.2f",
-				fromUser.CreditBalance, req.Amount)
-		}
-
-		// Deduct from sender
-		err = s.userService.UpdateCreditBalance(
-			ctx,
-			fromUserID,
-			-req.Amount,
-			"transfer_out",
-			fmt.Sprintf("Transfer to user %d: %s", req.ToUserID, req.Description),
-			nil,
-			nil,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to deduct from sender: %w", err)
-		}
-
-		// Add to receiver
-		err = s.userService.UpdateCreditBalance(
-			ctx,
-			req.ToUserID,
-			req.Amount,
-			"transfer_in",
-			fmt.Sprintf("Transfer from user %d: %s", fromUserID, req.Description),
-			nil,
-			nil,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to add to receiver: %w", err)
-		}
-
-		return nil
-	})
+	// Get sender
+	if _, err := s.userService.GetUserByID(ctx, fromUserID); err != nil {
+		return fmt.Errorf("sender not found: %w", err)
+	}
+
+	// Get receiver
+	if _, err := s.userService.GetUserByID(ctx, req.ToUserID); err != nil {
+		return fmt.Errorf("receiver not found: %w", err)
+	}
+
+	// Move the credits in one posting; the ledger checks the sender's balance
+	// with both users locked
+	_, err := s.ledgerService.Post(ctx,
+		LedgerEntry{
+			UserID:          fromUserID,
+			Amount:          -req.Amount,
+			TransactionType: "transfer_out",
+			Description:     fmt.Sprintf("Transfer to user %d: %s", req.ToUserID, req.Description),
+		},
+		LedgerEntry{
+			UserID:          req.ToUserID,
+			Amount:          req.Amount,
+			TransactionType: "transfer_in",
+			Description:     fmt.Sprintf("Transfer from user %d: %s", fromUserID, req.Description),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to transfer credits: %w", err)
+	}
+
+	return nil
 }
 
-func (s *CreditService) AdminAdjustCredits(ctx context.Context, userID uint, amount float64, reason string, adminID uint) error {
+func (s *CreditService) AdminAdjustCredits(ctx context.Context, userID uint, amount money.Amount, reason string, adminID uint) error {
 	transactionType := "admin_adjust"
 	description := fmt.Sprintf("Admin adjustment: %s", reason)
 
-	err := s.userService.UpdateCreditBalance(
-		ctx,
-		userID,
-		amount,
-		transactionType,
-		description,
-		nil,
-		nil,
-	)
+	_, err := s.ledgerService.Post(ctx, LedgerEntry{
+		UserID:          userID,
+		Amount:          amount,
+		TransactionType: transactionType,
+		Description:     description,
+		CreatedBy:       &adminID,
+	})
 
 	if err != nil {
 		return fmt.Errorf("failed to adjust credits: %w", err)
@@ -200,7 +185,7 @@ func (s *CreditService) GetCreditSummary(ctx context.Context, userID uint) (map[
 	// Get transaction summary for last 30 days
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
 
-	var deposits, purchases float64
+	var deposits, purchases money.Amount
 
 	err = s.db.Model(&models.CreditTransaction{}).
 		Where("user_id = ? AND created_at >= ? AND transaction_type = ?", userID, thirtyDaysAgo, "deposit").
@@ -221,7 +206,7 @@ func (s *CreditService) GetCreditSummary(ctx context.Context, userID uint) (map[
 	return map[string]interface{}{
 		"current_balance":  balance.Balance,
 		"pending_payments": balance.PendingPayments,
-		"last_30_days": map[string]float64{
+		"last_30_days": map[string]money.Amount{
 			"deposits":  deposits,
 			"purchases": purchases,
 		},
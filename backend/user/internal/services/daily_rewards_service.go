@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"gorm.io/gorm"
 )
@@ -143,7 +144,7 @@ func (s *DailyRewardsService) ClaimDailyReward(ctx context.Context, userID uint)
 		}
 
 		// Award the reward
-		err = s.awardDailyReward(ctx, userID, &reward)
+		err = s.awardDailyReward(ctx, tx, userID, &reward)
 		if err != nil {
 			return fmt.Errorf("failed to award reward: %w", err)
 		}
@@ -179,19 +180,20 @@ func (s *DailyRewardsService) ClaimDailyReward(ctx context.Context, userID uint)
 	return result, nil
 }
 
-func (s *DailyRewardsService) awardDailyReward(ctx context.Context, userID uint, reward *DailyRewardConfig) error {
+func (s *DailyRewardsService) awardDailyReward(ctx context.Context, tx *gorm.DB, userID uint, reward *DailyRewardConfig) error {
 	switch reward.RewardType {
 	case "credits":
-		amount, err := parseFloat(reward.RewardValue)
+		amount, err := money.Parse(reward.RewardValue)
 		if err != nil {
 			return fmt.Errorf("invalid credit amount: %w", err)
 		}
 
-		err = s.creditService.userService.UpdateCreditBalance(
-			ctx, userID, amount, "daily_reward",
-			fmt.Sprintf("Daily login reward: %.2f credits", amount),
-			nil, nil,
-		)
+		_, err = s.creditService.ledgerService.PostTx(tx, LedgerEntry{
+			UserID:          userID,
+			Amount:          amount,
+			TransactionType: "daily_reward",
+			Description:     fmt.Sprintf("Daily login reward: %s credits", amount),
+		})
 		if err != nil {
 			return fmt.Errorf("failed to award credits: %w", err)
 		}
@@ -240,10 +242,6 @@ func (s *DailyRewardsService) GetRewardHistory(ctx context.Context, userID uint,
 }
 
 // Helper functions
-func parseFloat(s string) (float64, error) {
-	return strconv.ParseFloat(s, 64)
-}
-
 func parseInt(s string) (int, error) {
 	return strconv.Atoi(s)
 }
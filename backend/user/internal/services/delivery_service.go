@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"nexark-user-backend/internal/config"
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/rcon"
+
+	"gorm.io/gorm"
+)
+
+// DeliveryService delivers purchased items to game servers over RCON.
+// Every delivery is persisted as an item_delivery job so that it survives
+// restarts and is retried with backoff while a server is unreachable.
+type DeliveryService struct {
+	db             *gorm.DB
+	serverService  *ServerService
+	jobService     *JobService
+	refundService  *RefundService
+	pricingService *PricingService
+	cfg            config.DeliveryConfig
+}
+
+func NewDeliveryService(db *gorm.DB, serverService *ServerService, jobService *JobService, refundService *RefundService, pricingService *PricingService, cfg config.DeliveryConfig) *DeliveryService {
+	service := &DeliveryService{
+		db:             db,
+		serverService:  serverService,
+		jobService:     jobService,
+		refundService:  refundService,
+		pricingService: pricingService,
+		cfg:            cfg,
+	}
+
+	jobService.RegisterHandler(models.JobTypeItemDelivery, JobHandler{
+		Process:     service.processDeliveryJob,
+		OnExhausted: service.handleDeliveryExhausted,
+		Retry: RetryPolicy{
+			MaxAttempts: cfg.MaxAttempts,
+			BaseDelay:   cfg.BaseRetryDelay,
+			MaxDelay:    cfg.MaxRetryDelay,
+			DeadLetter:  true,
+		},
+	})
+
+	return service
+}
+
+// EnqueueDeliveries creates a delivery job for each transaction using tx, so the
+// jobs only exist if the purchase itself is committed. Call Dispatch after commit.
+func (s *DeliveryService) EnqueueDeliveries(ctx context.Context, tx *gorm.DB, transactions []*models.Transaction) error {
+	for _, transaction := range transactions {
+		payload := JobPayload{
+			UserID:   &transaction.UserID,
+			Delivery: &DeliveryJobPayload{TransactionID: transaction.TransactionID},
+		}
+
+		job, err := s.jobService.CreateJobInTx(ctx, tx, models.JobTypeItemDelivery, payload, 5, nil)
+		if err != nil {
+			return fmt.Errorf("failed to queue delivery: %w", err)
+		}
+
+		if err := tx.Model(&models.Transaction{}).
+			Where("transaction_id = ?", transaction.TransactionID).
+			Update("delivery_job_id", job.JobID).Error; err != nil {
+			return fmt.Errorf("failed to link delivery job: %w", err)
+		}
+		transaction.DeliveryJobID = &job.JobID
+	}
+
+	return nil
+}
+
+// Dispatch asks the job processor to start on newly queued deliveries right away
+func (s *DeliveryService) Dispatch() {
+	s.jobService.Wake()
+}
+
+// ResumePendingDeliveries queues a delivery job for every undelivered transaction that has no live job, e.g. purchases made before a crash.
+func (s *DeliveryService) ResumePendingDeliveries(ctx context.Context) error {
+	var transactions []*models.Transaction
+	err := s.db.Where("status IN ?", []string{"pending", "processing", "awaiting_player"}).
+		Where("delivery_job_id IS NULL OR delivery_job_id NOT IN (?)",
+			s.db.Model(&models.Job{}).Select("job_id").
+				Where("status IN ?", []models.JobStatus{models.JobStatusPending, models.JobStatusProcessing})).
+		Find(&transactions).Error
+	if err != nil {
+		return fmt.Errorf("failed to find undelivered transactions: %w", err)
+	}
+
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return s.EnqueueDeliveries(ctx, tx, transactions)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Resumed delivery of %d transactions", len(transactions))
+	s.Dispatch()
+	return nil
+}
+
+// RetryDelivery queues a fresh delivery job for a failed transaction. Steps that
+// already completed are skipped, so only the missing part is delivered.
+func (s *DeliveryService) RetryDelivery(ctx context.Context, transaction *models.Transaction) error {
+	if transaction.Status != "failed" {
+		return fmt.Errorf("only failed deliveries can be retried")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Transaction{}).
+			Where("transaction_id = ? AND status = ?", transaction.TransactionID, "failed").
+			Updates(map[string]interface{}{
+				"status":                "pending",
+				"awaiting_player_since": nil,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to reset transaction: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("only failed deliveries can be retried")
+		}
+
+		return s.EnqueueDeliveries(ctx, tx, []*models.Transaction{transaction})
+	})
+	if err != nil {
+		return err
+	}
+
+	transaction.Status = "pending"
+	transaction.AwaitingPlayerSince = nil
+	s.Dispatch()
+	return nil
+}
+
+func (s *DeliveryService) processDeliveryJob(ctx context.Context, job *models.Job) error {
+	payload, err := parseDeliveryPayload(job)
+	if err != nil {
+		return PermanentJobError(err)
+	}
+
+	var transaction models.Transaction
+	if err := s.db.Where("transaction_id = ?", payload.TransactionID).First(&transaction).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return PermanentJobError(fmt.Errorf("transaction %d not found", payload.TransactionID))
+		}
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	// Already delivered or reversed; nothing left to do
+	if transaction.Status == "completed" || transaction.Status == "refunded" {
+		return nil
+	}
+
+	return s.deliverTransaction(ctx, &transaction)
+}
+
+func (s *DeliveryService) deliverTransaction(ctx context.Context, transaction *models.Transaction) error {
+	// Get item and server details
+	var item models.Item
+	var server models.Server
+
+	if err := s.db.Where("item_id = ?", transaction.ItemID).
+		Preload("DeliverySteps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("step_order ASC")
+		}).
+		First(&item).Error; err != nil {
+		return s.deliveryFailed(transaction, PermanentJobError(fmt.Errorf("failed to get item details: %w", err)))
+	}
+
+	if err := s.db.Where("server_id = ?", transaction.ServerID).First(&server).Error; err != nil {
+		return s.deliveryFailed(transaction, PermanentJobError(fmt.Errorf("failed to get server details: %w", err)))
+	}
+
+	// Deliver with the server's command override, if it has one. The purchase
+	// was already paid for, so availability isn't checked again here.
+	offer, err := s.pricingService.ResolveOffer(s.db, &item, transaction.ServerID)
+	if err != nil {
+		return s.deliveryFailed(transaction, err)
+	}
+	item.RCONCommand = offer.RCONCommand
+
+	// Gifts are delivered to the recipient, everything else to the buyer
+	vars, err := s.templateVars(transaction, &server)
+	if err != nil {
+		return s.deliveryFailed(transaction, err)
+	}
+
+	// ARK drops items given to players who aren't connected, so wait for them
+	if s.cfg.RequirePlayerOnline {
+		online, err := s.awaitPlayer(ctx, transaction, vars)
+		if err != nil || !online {
+			return err
+		}
+	}
+
+	// Update transaction status to processing
+	s.updateTransactionStatus(transaction.TransactionID, "processing", nil)
+
+	steps := deliveryPlan(&item)
+	results, err := s.loadStepResults(transaction, steps)
+	if err != nil {
+		return s.deliveryFailed(transaction, err)
+	}
+
+	// Execute each step in order, skipping the ones an earlier attempt completed
+	var commands, responses []string
+	for _, step := range steps {
+		command, err := rcon.RenderCommandTemplate(step.RCONCommand, vars)
+		if err != nil {
+			return s.deliveryFailed(transaction, PermanentJobError(fmt.Errorf("failed to render step %d: %w", step.StepOrder, err)))
+		}
+
+		var successPattern *regexp.Regexp
+		if step.SuccessPattern != nil && *step.SuccessPattern != "" {
+			successPattern, err = regexp.Compile(*step.SuccessPattern)
+			if err != nil {
+				return s.deliveryFailed(transaction, PermanentJobError(fmt.Errorf("invalid success pattern for step %d: %w", step.StepOrder, err)))
+			}
+		}
+
+		delayed := false
+		for unit := 0; unit < stepUnits(step, transaction.Quantity); unit++ {
+			result := results[stepKey{step.StepOrder, unit}]
+			if result.Status == "completed" {
+				commands = append(commands, stringValue(result.RCONCommandSent))
+				responses = append(responses, stringValue(result.RCONResponse))
+				continue
+			}
+
+			if step.DelaySeconds > 0 && !delayed {
+				delayed = true
+				if err := sleepContext(ctx, time.Duration(step.DelaySeconds)*time.Second); err != nil {
+					return s.deliveryFailed(transaction, err)
+				}
+			}
+
+			response, err := s.runStep(ctx, transaction.ServerID, result, command, successPattern)
+			if err != nil {
+				return s.deliveryFailed(transaction, fmt.Errorf("step %d failed: %w", step.StepOrder, err))
+			}
+			commands = append(commands, command)
+			responses = append(responses, response)
+		}
+	}
+
+	// Update transaction with success
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":            "completed",
+		"rcon_command_sent": strings.Join(commands, "\n"),
+		"rcon_response":     strings.Join(responses, "\n"),
+		"completed_at":      now,
+		"failure_reason":    nil,
+	}
+
+	if err := s.db.Model(&models.Transaction{}).
+		Where("transaction_id = ?", transaction.TransactionID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	return nil
+}
+
+// awaitPlayer reports whether the delivery target is on the server. While they
+// aren't, the transaction is held in awaiting_player and the job is deferred;
+// once AwaitPlayerTimeout has passed the delivery fails and is refunded, and
+// awaitPlayer returns false with no error so the job completes.
+func (s *DeliveryService) awaitPlayer(ctx context.Context, transaction *models.Transaction, vars rcon.TemplateVars) (bool, error) {
+	players, err := s.serverService.ListPlayers(ctx, transaction.ServerID)
+	if err != nil {
+		return false, s.deliveryFailed(transaction, fmt.Errorf("failed to check online players: %w", err))
+	}
+
+	if _, online := rcon.FindPlayer(players, vars.SteamID, vars.EOSID); online {
+		return true, nil
+	}
+
+	// ARK: Survival Ascended lists players by EOS ID, so without a linked one
+	// the player can't be recognised and would wait out the timeout. Deliver
+	// unchecked instead; an empty list still waits, as nobody is online.
+	if vars.EOSID == "" && listsEOSIDs(players) {
+		log.Printf("Delivering transaction %d without online check: server lists EOS IDs and player %s has none linked",
+			transaction.TransactionID, vars.SteamID)
+		return true, nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": "awaiting_player"}
+	if transaction.AwaitingPlayerSince == nil {
+		updates["awaiting_player_since"] = now
+		transaction.AwaitingPlayerSince = &now
+	}
+	if err := s.db.Model(&models.Transaction{}).
+		Where("transaction_id = ?", transaction.TransactionID).
+		Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	if now.Sub(*transaction.AwaitingPlayerSince) >= s.cfg.AwaitPlayerTimeout {
+		reason := fmt.Sprintf("Player did not join the server within %s", s.cfg.AwaitPlayerTimeout)
+		s.refundFailedDelivery(ctx, transaction.TransactionID, reason)
+		return false, nil
+	}
+
+	return false, DeferJobError(s.cfg.PlayerCheckInterval, fmt.Errorf("waiting for player %s to join", vars.SteamID))
+}
+
+// listsEOSIDs reports whether the server identifies players by EOS ID
+func listsEOSIDs(players []rcon.Player) bool {
+	for _, player := range players {
+		if rcon.ValidEOSID(player.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// runStep sends one step command and records its outcome on result
+func (s *DeliveryService) runStep(ctx context.Context, serverID uint, result *models.TransactionDeliveryStep, command string, successPattern *regexp.Regexp) (string, error) {
+	var stepErr error
+	var responseText string
+
+	response, err := s.serverService.ExecuteRCONCommand(ctx, serverID, command)
+	switch {
+	case err != nil:
+		stepErr = fmt.Errorf("RCON execution failed: %w", err)
+	case !response.Success:
+		stepErr = fmt.Errorf("RCON command failed: %s", response.Error)
+	default:
+		responseText = response.Response
+		if successPattern != nil && !successPattern.MatchString(responseText) {
+			stepErr = fmt.Errorf("unexpected RCON response: %q", responseText)
+		}
+	}
+
+	updates := map[string]interface{}{
+		"rcon_command_sent": command,
+		"rcon_response":     responseText,
+		"attempt_count":     gorm.Expr("attempt_count + 1"),
+	}
+	if stepErr != nil {
+		updates["status"] = "failed"
+		updates["error_message"] = stepErr.Error()
+	} else {
+		updates["status"] = "completed"
+		updates["error_message"] = nil
+		updates["completed_at"] = time.Now()
+	}
+
+	if err := s.db.Model(&models.TransactionDeliveryStep{}).
+		Where("transaction_step_id = ?", result.TransactionStepID).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to record delivery step %d: %v", result.TransactionStepID, err)
+	}
+
+	return responseText, stepErr
+}
+
+type stepKey struct {
+	order int
+	unit  int
+}
+
+// loadStepResults returns the per-step result rows of a transaction, creating
+// the ones a previous attempt didn't get to.
+func (s *DeliveryService) loadStepResults(transaction *models.Transaction, steps []models.ItemDeliveryStep) (map[stepKey]*models.TransactionDeliveryStep, error) {
+	var existing []models.TransactionDeliveryStep
+	if err := s.db.Where("transaction_id = ?", transaction.TransactionID).Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delivery steps: %w", err)
+	}
+
+	results := make(map[stepKey]*models.TransactionDeliveryStep)
+	for i := range existing {
+		results[stepKey{existing[i].StepOrder, existing[i].UnitIndex}] = &existing[i]
+	}
+
+	for _, step := range steps {
+		for unit := 0; unit < stepUnits(step, transaction.Quantity); unit++ {
+			key := stepKey{step.StepOrder, unit}
+			if _, ok := results[key]; ok {
+				continue
+			}
+
+			result := &models.TransactionDeliveryStep{
+				TransactionID: transaction.TransactionID,
+				StepOrder:     step.StepOrder,
+				UnitIndex:     unit,
+				Status:        "pending",
+			}
+			if err := s.db.Create(result).Error; err != nil {
+				return nil, fmt.Errorf("failed to create delivery step: %w", err)
+			}
+			results[key] = result
+		}
+	}
+
+	return results, nil
+}
+
+// deliveryPlan returns the ordered steps for an item. Items without steps are
+// delivered with their single RCONCommand.
+func deliveryPlan(item *models.Item) []models.ItemDeliveryStep {
+	if len(item.DeliverySteps) > 0 {
+		return item.DeliverySteps
+	}
+
+	return []models.ItemDeliveryStep{{
+		ItemID:      item.ItemID,
+		StepOrder:   1,
+		RCONCommand: item.RCONCommand,
+	}}
+}
+
+// stepUnits is how many times a step runs. Commands without {quantity} deliver
+// one unit each, so they are repeated per unit purchased.
+func stepUnits(step models.ItemDeliveryStep, quantity int) int {
+	if quantity <= 1 || rcon.UsesPlaceholder(step.RCONCommand, rcon.PlaceholderQuantity) {
+		return 1
+	}
+	return quantity
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// templateVars resolves the placeholder values for a delivery. Gifts target the
+// recipient, who may not have an account here; only {steam_id} is known then.
+func (s *DeliveryService) templateVars(transaction *models.Transaction, server *models.Server) (rcon.TemplateVars, error) {
+	vars := rcon.TemplateVars{
+		Quantity:   transaction.Quantity,
+		ServerName: server.ServerName,
+	}
+
+	var target models.User
+	var err error
+	if transaction.RecipientSteamID != nil {
+		vars.SteamID = *transaction.RecipientSteamID
+		err = s.db.Where("steam_id = ?", *transaction.RecipientSteamID).First(&target).Error
+	} else {
+		err = s.db.Where("user_id = ?", transaction.UserID).First(&target).Error
+	}
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound && transaction.RecipientSteamID != nil {
+			return vars, nil
+		}
+		if err == gorm.ErrRecordNotFound {
+			return vars, PermanentJobError(fmt.Errorf("buyer %d not found", transaction.UserID))
+		}
+		return vars, fmt.Errorf("failed to get delivery target: %w", err)
+	}
+
+	vars.SteamID = target.SteamID
+	vars.PlayerName = target.Username
+	if target.EOSID != nil {
+		vars.EOSID = *target.EOSID
+	}
+
+	return vars, nil
+}
+
+// deliveryFailed records the latest failure on the transaction and hands err back
+// to the job queue, which decides whether another attempt is made.
+func (s *DeliveryService) deliveryFailed(transaction *models.Transaction, err error) error {
+	reason := err.Error()
+	s.updateTransactionStatus(transaction.TransactionID, "processing", &reason)
+	return err
+}
+
+func (s *DeliveryService) handleDeliveryExhausted(ctx context.Context, job *models.Job, errorMsg string) {
+	payload, err := parseDeliveryPayload(job)
+	if err != nil {
+		log.Printf("Delivery job %d exhausted with unreadable payload: %v", job.JobID, err)
+		return
+	}
+
+	reason := fmt.Sprintf("Delivery gave up after %d attempts: %s", job.AttemptCount, errorMsg)
+	log.Printf("Delivery of transaction %d moved to dead letter: %s", payload.TransactionID, errorMsg)
+
+	s.refundFailedDelivery(ctx, payload.TransactionID, reason)
+}
+
+// refundFailedDelivery marks a transaction failed and refunds it, unless part
+// of it was already delivered; those are left failed for a manual decision.
+func (s *DeliveryService) refundFailedDelivery(ctx context.Context, transactionID uint, reason string) {
+	s.updateTransactionStatus(transactionID, "failed", &reason)
+
+	partial, err := s.refundService.IsPartiallyDelivered(ctx, transactionID)
+	if err != nil {
+		log.Printf("Failed to check delivery of transaction %d: %v", transactionID, err)
+		return
+	}
+	if partial {
+		log.Printf("Transaction %d was partially delivered, not refunding automatically", transactionID)
+		return
+	}
+
+	if _, err := s.refundService.RefundTransaction(ctx, transactionID, reason, nil); err != nil {
+		log.Printf("Failed to refund transaction %d: %v", transactionID, err)
+		return
+	}
+	log.Printf("Refunded transaction %d: %s", transactionID, reason)
+}
+
+func (s *DeliveryService) updateTransactionStatus(transactionID uint, status string, failureReason *string) {
+	updates := map[string]interface{}{
+		"status": status,
+	}
+
+	if failureReason != nil {
+		updates["failure_reason"] = *failureReason
+	}
+
+	if status == "completed" {
+		updates["completed_at"] = time.Now()
+	}
+
+	if err := s.db.Model(&models.Transaction{}).
+		Where("transaction_id = ?", transactionID).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to update transaction status: %v", err)
+	}
+}
+
+func parseDeliveryPayload(job *models.Job) (*DeliveryJobPayload, error) {
+	var payload JobPayload
+	payloadBytes, err := json.Marshal(job.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	if payload.Delivery == nil || payload.Delivery.TransactionID == 0 {
+		return nil, fmt.Errorf("delivery payload is required")
+	}
+
+	return payload.Delivery, nil
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+	"nexark-user-backend/pkg/rcon"
+	"nexark-user-backend/pkg/rcon/rcontest"
+)
+
+// purchase buys one of item for user and returns the resulting transaction
+func (s *testShop) purchase(t *testing.T, user *models.User, item *models.Item) *models.Transaction {
+	t.Helper()
+
+	if _, err := s.transactions.ProcessPurchase(context.Background(), user.UserID, PurchaseRequest{
+		Items: []PurchaseItem{{ItemID: item.ItemID, Quantity: 1, ServerID: s.server.ServerID}},
+	}); err != nil {
+		t.Fatalf("purchase failed: %v", err)
+	}
+
+	var transaction models.Transaction
+	if err := s.db.Where("user_id = ? AND item_id = ?", user.UserID, item.ItemID).
+		Order("transaction_id DESC").First(&transaction).Error; err != nil {
+		t.Fatalf("failed to find transaction: %v", err)
+	}
+	return &transaction
+}
+
+// reload returns the current state of a transaction and its delivery job
+func (s *testShop) reload(t *testing.T, transaction *models.Transaction) (*models.Transaction, *models.Job) {
+	t.Helper()
+
+	var reloaded models.Transaction
+	if err := s.db.First(&reloaded, transaction.TransactionID).Error; err != nil {
+		t.Fatalf("failed to reload transaction: %v", err)
+	}
+	if reloaded.DeliveryJobID == nil {
+		t.Fatalf("transaction %d has no delivery job", reloaded.TransactionID)
+	}
+
+	var job models.Job
+	if err := s.db.First(&job, *reloaded.DeliveryJobID).Error; err != nil {
+		t.Fatalf("failed to reload job: %v", err)
+	}
+	return &reloaded, &job
+}
+
+// waitForStatus waits for a transaction to reach status, e.g. for a refund
+// that the job processor makes after it has finished with the job
+func (s *testShop) waitForStatus(t *testing.T, transaction *models.Transaction, status string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var current models.Transaction
+		if err := s.db.Select("status").First(&current, transaction.TransactionID).Error; err != nil {
+			t.Fatalf("failed to reload transaction: %v", err)
+		}
+		if current.Status == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transaction is %s, want %s", current.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// commandsWithPrefix returns the commands the game server received that start with prefix
+func (s *testShop) commandsWithPrefix(prefix string) []string {
+	var matched []string
+	for _, command := range s.rcon.Commands() {
+		if strings.HasPrefix(command, prefix) {
+			matched = append(matched, command)
+		}
+	}
+	return matched
+}
+
+func TestDeliveryRetriesOnlyTheFailedStep(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	item := shop.createItem(t, "dino_bundle", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	pattern := "^Granted$"
+	steps := []models.ItemDeliveryStep{
+		{ItemID: item.ItemID, StepOrder: 1, RCONCommand: "GiveItemNum {steam_id} 1"},
+		{ItemID: item.ItemID, StepOrder: 2, RCONCommand: "ScriptCommand GrantDino {steam_id}", SuccessPattern: &pattern},
+	}
+	if err := shop.db.Create(&steps).Error; err != nil {
+		t.Fatalf("failed to create delivery steps: %v", err)
+	}
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000011", money.FromBaht(10))
+
+	// The second step is refused once, as when the game server is still loading
+	var mu sync.Mutex
+	grants := 0
+	shop.rcon.HandlePrefix("ScriptCommand GrantDino", func(string) rcontest.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		grants++
+		if grants == 1 {
+			return rcontest.Response{Body: "Denied"}
+		}
+		return rcontest.Response{Body: "Granted"}
+	})
+
+	transaction := shop.purchase(t, buyer, item)
+	shop.waitForJobs(t)
+
+	transaction, job := shop.reload(t, transaction)
+	if transaction.Status != "completed" {
+		t.Fatalf("transaction is %s (%s), want completed", transaction.Status, stringValue(transaction.FailureReason))
+	}
+	if job.Status != models.JobStatusCompleted || job.AttemptCount != 2 {
+		t.Errorf("job is %s after %d attempts, want completed after 2", job.Status, job.AttemptCount)
+	}
+	if given := shop.commandsWithPrefix("GiveItemNum"); len(given) != 1 {
+		t.Errorf("first step ran %d times, want once: %v", len(given), given)
+	}
+	if granted := shop.commandsWithPrefix("ScriptCommand GrantDino"); len(granted) != 2 {
+		t.Errorf("second step ran %d times, want twice: %v", len(granted), granted)
+	}
+	assertLedgerConsistent(t, shop.db)
+}
+
+func TestDeliveryDeadLettersAndRefundsAfterMaxAttempts(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	item := shop.createItem(t, "broken_item", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	pattern := "^Item given$"
+	if err := shop.db.Create(&models.ItemDeliveryStep{
+		ItemID:         item.ItemID,
+		StepOrder:      1,
+		RCONCommand:    "GiveItemNum {steam_id} 1",
+		SuccessPattern: &pattern,
+	}).Error; err != nil {
+		t.Fatalf("failed to create delivery step: %v", err)
+	}
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000012", money.FromBaht(10))
+	shop.rcon.HandlePrefix("GiveItemNum", func(string) rcontest.Response {
+		return rcontest.Response{Body: "No such item"}
+	})
+
+	transaction := shop.purchase(t, buyer, item)
+	shop.waitForJobs(t)
+	shop.waitForStatus(t, transaction, "refunded")
+
+	transaction, job := shop.reload(t, transaction)
+	if job.Status != models.JobStatusDeadLetter || job.AttemptCount != testDeliveryConfig.MaxAttempts {
+		t.Errorf("job is %s after %d attempts, want dead_letter after %d",
+			job.Status, job.AttemptCount, testDeliveryConfig.MaxAttempts)
+	}
+	if given := shop.commandsWithPrefix("GiveItemNum"); len(given) != testDeliveryConfig.MaxAttempts {
+		t.Errorf("command was sent %d times, want once per attempt", len(given))
+	}
+
+	var reloaded models.User
+	shop.db.First(&reloaded, buyer.UserID)
+	if reloaded.CreditBalance != money.FromBaht(10) {
+		t.Errorf("buyer balance is %s after the refund, want 10.00", reloaded.CreditBalance)
+	}
+	assertLedgerConsistent(t, shop.db)
+}
+
+func TestDeliveryAwaitsPlayer(t *testing.T) {
+	cfg := testDeliveryConfig
+	cfg.RequirePlayerOnline = true
+	shop := newTestShop(t, cfg)
+	item := shop.createItem(t, "metal_ingot", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000013", money.FromBaht(10))
+
+	transaction := shop.purchase(t, buyer, item)
+
+	// Let the player check run more often than MaxAttempts, which waiting
+	// must not use up
+	deadline := time.Now().Add(10 * time.Second)
+	for len(shop.commandsWithPrefix("ListPlayers")) <= cfg.MaxAttempts {
+		if time.Now().After(deadline) {
+			t.Fatal("delivery never checked for the player")
+		}
+		shop.jobs.Wake()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	waiting, job := shop.reload(t, transaction)
+	if waiting.Status != "awaiting_player" || waiting.AwaitingPlayerSince == nil {
+		t.Errorf("transaction is %s while the player is offline, want awaiting_player", waiting.Status)
+	}
+	if job.Status == models.JobStatusDeadLetter || job.Status == models.JobStatusCompleted {
+		t.Errorf("job is %s while the player is offline, want it still queued", job.Status)
+	}
+	if given := shop.commandsWithPrefix("GiveItemNum"); len(given) != 0 {
+		t.Errorf("item was given to an offline player: %v", given)
+	}
+
+	shop.rcon.SetPlayers(rcon.Player{Index: 0, Name: "Buyer", ID: buyer.SteamID})
+	shop.waitForJobs(t)
+
+	delivered, _ := shop.reload(t, transaction)
+	if delivered.Status != "completed" {
+		t.Errorf("transaction is %s once the player joined, want completed", delivered.Status)
+	}
+	if given := shop.commandsWithPrefix("GiveItemNum"); len(given) != 1 {
+		t.Errorf("item was given %d times, want once", len(given))
+	}
+}
+
+func TestDeliveryRefundsWhenPlayerNeverJoins(t *testing.T) {
+	cfg := testDeliveryConfig
+	cfg.RequirePlayerOnline = true
+	cfg.AwaitPlayerTimeout = 50 * time.Millisecond
+	shop := newTestShop(t, cfg)
+	item := shop.createItem(t, "metal_ingot", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000014", money.FromBaht(10))
+
+	transaction := shop.purchase(t, buyer, item)
+	shop.waitForJobs(t)
+
+	transaction, _ = shop.reload(t, transaction)
+	if transaction.Status != "refunded" {
+		t.Errorf("transaction is %s after the player never joined, want refunded", transaction.Status)
+	}
+	if given := shop.commandsWithPrefix("GiveItemNum"); len(given) != 0 {
+		t.Errorf("item was given to an offline player: %v", given)
+	}
+
+	var reloaded models.User
+	shop.db.First(&reloaded, buyer.UserID)
+	if reloaded.CreditBalance != money.FromBaht(10) {
+		t.Errorf("buyer balance is %s after the refund, want 10.00", reloaded.CreditBalance)
+	}
+	assertLedgerConsistent(t, shop.db)
+}
+
+func TestDeliveryWithoutEOSIDOnServerListingEOSIDs(t *testing.T) {
+	cfg := testDeliveryConfig
+	cfg.RequirePlayerOnline = true
+	shop := newTestShop(t, cfg)
+	item := shop.createItem(t, "metal_ingot", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000015", money.FromBaht(10))
+
+	// An ARK: Survival Ascended server; the buyer hasn't linked an EOS ID
+	shop.rcon.SetPlayers(rcon.Player{Index: 0, Name: "Someone", ID: "0002a1b2c3d4e5f60718293a4b5c6d7e"})
+
+	transaction := shop.purchase(t, buyer, item)
+	shop.waitForJobs(t)
+
+	transaction, _ = shop.reload(t, transaction)
+	if transaction.Status != "completed" {
+		t.Errorf("transaction is %s, want completed without an online check", transaction.Status)
+	}
+}
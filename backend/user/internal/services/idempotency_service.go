@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyKeyTTL is how long a stored response is replayed for
+const idempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyService stores the first response to each Idempotency-Key so
+// retried requests are answered without running again
+type IdempotencyService struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyService(db *gorm.DB) *IdempotencyService {
+	return &IdempotencyService{db: db}
+}
+
+// Start prunes expired keys every hour in the background
+func (s *IdempotencyService) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Prune(context.Background()); err != nil {
+				log.Printf("Idempotency key pruning failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Reserve claims key for userID before the request runs. When the key was
+// already used for the same request and that request finished, the stored
+// response is returned with replay set. A key used for a different request,
+// or whose request is still running, is an error.
+func (s *IdempotencyService) Reserve(ctx context.Context, userID uint, key, requestHash string) (int, []byte, bool, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      models.IdempotencyProcessing,
+		ExpiresAt:   now.Add(idempotencyKeyTTL),
+	})
+	if result.Error != nil {
+		return 0, nil, false, fmt.Errorf("failed to reserve idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return 0, nil, false, nil
+	}
+
+	// An expired key that has not been pruned yet is free to use again
+	result = db.Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND idempotency_key = ? AND expires_at <= ?", userID, key, now).
+		Updates(map[string]interface{}{
+			"request_hash":    requestHash,
+			"status":          models.IdempotencyProcessing,
+			"response_status": nil,
+			"response_body":   nil,
+			"created_at":      now,
+			"completed_at":    nil,
+			"expires_at":      now.Add(idempotencyKeyTTL),
+		})
+	if result.Error != nil {
+		return 0, nil, false, fmt.Errorf("failed to reserve idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return 0, nil, false, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil, false, fmt.Errorf("idempotency key is in progress")
+		}
+		return 0, nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	if existing.RequestHash != requestHash {
+		return 0, nil, false, fmt.Errorf("idempotency key was already used for a different request")
+	}
+	if existing.Status != models.IdempotencyCompleted || existing.ResponseStatus == nil {
+		return 0, nil, false, fmt.Errorf("idempotency key is in progress")
+	}
+
+	return *existing.ResponseStatus, existing.ResponseBody, true, nil
+}
+
+// Complete stores the response to the request that reserved key
+func (s *IdempotencyService) Complete(ctx context.Context, userID uint, key string, status int, body []byte) error {
+	err := s.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND idempotency_key = ? AND status = ?", userID, key, models.IdempotencyProcessing).
+		Updates(map[string]interface{}{
+			"status":          models.IdempotencyCompleted,
+			"response_status": status,
+			"response_body":   body,
+			"completed_at":    time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release frees a reserved key without storing a response, so the request can
+// be retried with it
+func (s *IdempotencyService) Release(ctx context.Context, userID uint, key string) error {
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND idempotency_key = ? AND status = ?", userID, key, models.IdempotencyProcessing).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes expired keys
+func (s *IdempotencyService) Prune(ctx context.Context) error {
+	if err := s.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return fmt.Errorf("failed to prune idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -3,21 +3,88 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"gorm.io/gorm"
 )
 
 type JobService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	handlers map[models.JobType]JobHandler
+	mutex    sync.RWMutex
+	wake     chan struct{}
+}
+
+// JobHandler lets other services process their own job types through the
+// shared job queue. Process returning an error reschedules the job according
+// to Retry; OnExhausted is called once no attempts are left.
+type JobHandler struct {
+	Process     func(ctx context.Context, job *models.Job) error
+	OnExhausted func(ctx context.Context, job *models.Job, errorMsg string)
+	Retry       RetryPolicy
+}
+
+// RetryPolicy describes how failed jobs are retried with exponential backoff
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// DeadLetter parks exhausted jobs as dead_letter instead of failed
+	DeadLetter bool
+}
+
+// jobLeaseDuration is how long a claimed job stays with its worker without
+// the lease being renewed. Workers renew it well before it runs out, so only
+// jobs of a stopped worker are requeued.
+const jobLeaseDuration = 2 * time.Minute
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Minute,
+	MaxDelay:    time.Hour,
+}
+
+// permanentJobError marks a failure that retrying cannot fix
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError wraps err so the job is not retried
+func PermanentJobError(err error) error {
+	return &permanentJobError{err: err}
+}
+
+// deferredJobError asks for the job to run again later without using an attempt
+type deferredJobError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *deferredJobError) Error() string { return e.err.Error() }
+func (e *deferredJobError) Unwrap() error { return e.err }
+
+// DeferJobError reschedules the job after the given delay. Unlike a failure it
+// doesn't count against the retry policy, e.g. while waiting on a player.
+func DeferJobError(after time.Duration, err error) error {
+	return &deferredJobError{err: err, after: after}
 }
 
 func NewJobService(db *gorm.DB) *JobService {
-	service := &JobService{db: db}
+	service := &JobService{
+		db:       db,
+		handlers: make(map[models.JobType]JobHandler),
+		wake:     make(chan struct{}, 1),
+	}
 
 	// Start job processor
 	go service.startJobProcessor()
@@ -25,10 +92,46 @@ func NewJobService(db *gorm.DB) *JobService {
 	return service
 }
 
+// RegisterHandler routes jobs of the given type to handler
+func (s *JobService) RegisterHandler(jobType models.JobType, handler JobHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[jobType] = handler
+}
+
+func (s *JobService) getHandler(jobType models.JobType) (JobHandler, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	handler, ok := s.handlers[jobType]
+	return handler, ok
+}
+
+func (s *JobService) retryPolicy(jobType models.JobType) RetryPolicy {
+	if handler, ok := s.getHandler(jobType); ok && handler.Retry.MaxAttempts > 0 {
+		return handler.Retry
+	}
+	return defaultRetryPolicy
+}
+
+// Wake makes the processor pick up due jobs now instead of on the next tick
+func (s *JobService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
 type JobPayload struct {
-	UserID *uint                  `json:"user_id,omitempty"`
-	Email  *EmailJobPayload       `json:"email,omitempty"`
-	Data   map[string]interface{} `json:"data,omitempty"`
+	UserID   *uint                  `json:"user_id,omitempty"`
+	Email    *EmailJobPayload       `json:"email,omitempty"`
+	Delivery *DeliveryJobPayload    `json:"delivery,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+type DeliveryJobPayload struct {
+	TransactionID uint `json:"transaction_id"`
 }
 
 type EmailJobPayload struct {
@@ -42,6 +145,11 @@ type EmailJobPayload struct {
 }
 
 func (s *JobService) CreateJob(ctx context.Context, jobType models.JobType, payload JobPayload, priority int, processAt *time.Time) (*models.Job, error) {
+	return s.CreateJobInTx(ctx, s.db, jobType, payload, priority, processAt)
+}
+
+// CreateJobInTx creates a job using tx so that it is committed together with the caller's changes
+func (s *JobService) CreateJobInTx(ctx context.Context, tx *gorm.DB, jobType models.JobType, payload JobPayload, priority int, processAt *time.Time) (*models.Job, error) {
 	if processAt == nil {
 		now := time.Now()
 		processAt = &now
@@ -63,10 +171,10 @@ func (s *JobService) CreateJob(ctx context.Context, jobType models.JobType, payl
 		Priority:    priority,
 		Payload:     payloadMap,
 		ProcessAt:   *processAt,
-		MaxAttempts: 3,
+		MaxAttempts: s.retryPolicy(jobType).MaxAttempts,
 	}
 
-	if err := s.db.Create(&job).Error; err != nil {
+	if err := tx.Create(&job).Error; err != nil {
 		return nil, fmt.Errorf("failed to create job: %w", err)
 	}
 
@@ -96,17 +204,28 @@ func (s *JobService) GetPendingJobs(ctx context.Context, limit int) ([]models.Jo
 }
 
 func (s *JobService) ProcessJob(ctx context.Context, job *models.Job) error {
-	// Update job status to processing
+	// Claim the job; another worker may have picked it up already
 	now := time.Now()
 	updates := map[string]interface{}{
 		"status":        models.JobStatusProcessing,
 		"started_at":    now,
+		"locked_until":  now.Add(jobLeaseDuration),
 		"attempt_count": gorm.Expr("attempt_count + 1"),
 	}
 
-	if err := s.db.Model(job).Updates(updates).Error; err != nil {
-		return fmt.Errorf("failed to update job status: %w", err)
+	result := s.db.Model(&models.Job{}).
+		Where("job_id = ? AND status = ?", job.JobID, models.JobStatusPending).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update job status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
 	}
+	job.AttemptCount++
+
+	stopLease := s.renewLease(job.JobID)
+	defer stopLease()
 
 	// Process based on job type
 	var err error
@@ -120,12 +239,22 @@ func (s *JobService) ProcessJob(ctx context.Context, job *models.Job) error {
 	case models.JobTypeDataCleanup:
 		err = s.processDataCleanupJob(ctx, job)
 	default:
-		err = fmt.Errorf("unknown job type: %s", job.JobType)
+		if handler, ok := s.getHandler(job.JobType); ok {
+			err = handler.Process(ctx, job)
+		} else {
+			err = fmt.Errorf("unknown job type: %s", job.JobType)
+		}
 	}
 
 	// Update job based on result
+	var deferred *deferredJobError
+	if errors.As(err, &deferred) {
+		s.markJobDeferred(job, deferred)
+		return nil
+	}
+
 	if err != nil {
-		s.markJobFailed(job, err.Error())
+		s.markJobFailed(ctx, job, err)
 		return err
 	} else {
 		s.markJobCompleted(job, nil)
@@ -224,33 +353,152 @@ func (s *JobService) markJobCompleted(job *models.Job, result map[string]interfa
 	s.db.Model(job).Updates(updates)
 }
 
-func (s *JobService) markJobFailed(job *models.Job, errorMsg string) {
+func (s *JobService) markJobFailed(ctx context.Context, job *models.Job, jobErr error) {
+	errorMsg := jobErr.Error()
+	policy := s.retryPolicy(job.JobType)
 	updates := map[string]interface{}{
 		"error_msg": errorMsg,
 	}
 
+	var permanent *permanentJobError
+	exhausted := job.AttemptCount >= job.MaxAttempts || errors.As(jobErr, &permanent)
+
 	// Check if we should retry
-	if job.AttemptCount >= job.MaxAttempts {
+	if exhausted {
 		updates["status"] = models.JobStatusFailed
+		if policy.DeadLetter {
+			updates["status"] = models.JobStatusDeadLetter
+		}
 		now := time.Now()
 		updates["completed_at"] = now
 	} else {
 		// Retry later (exponential backoff)
-		retryDelay := time.Duration(job.AttemptCount*job.AttemptCount) * time.Minute
 		updates["status"] = models.JobStatusPending
-		updates["process_at"] = time.Now().Add(retryDelay)
+		updates["process_at"] = time.Now().Add(retryDelay(policy, job.AttemptCount))
 	}
 
-	s.db.Model(job).Updates(updates)
+	if err := s.db.Model(job).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update job %d after failure: %v", job.JobID, err)
+	}
+
+	if exhausted {
+		if handler, ok := s.getHandler(job.JobType); ok && handler.OnExhausted != nil {
+			handler.OnExhausted(ctx, job, errorMsg)
+		}
+	}
+}
+
+// markJobDeferred puts the job back in the queue and returns the attempt it used
+func (s *JobService) markJobDeferred(job *models.Job, deferred *deferredJobError) {
+	updates := map[string]interface{}{
+		"status":        models.JobStatusPending,
+		"error_msg":     deferred.Error(),
+		"process_at":    time.Now().Add(deferred.after),
+		"attempt_count": gorm.Expr("GREATEST(attempt_count - 1, 0)"),
+	}
+
+	if err := s.db.Model(job).Updates(updates).Error; err != nil {
+		log.Printf("Failed to defer job %d: %v", job.JobID, err)
+	}
+}
+
+// retryDelay returns BaseDelay doubled for every previous attempt, capped at MaxDelay
+func retryDelay(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxDelay > 0 && delay >= policy.MaxDelay {
+			return policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+// RequeueJob moves a failed or dead-lettered job back to pending with a fresh set of attempts
+func (s *JobService) RequeueJob(ctx context.Context, jobID uint) error {
+	updates := map[string]interface{}{
+		"status":        models.JobStatusPending,
+		"attempt_count": 0,
+		"process_at":    time.Now(),
+		"completed_at":  nil,
+	}
+
+	result := s.db.Model(&models.Job{}).
+		Where("job_id = ? AND status IN ?", jobID, []models.JobStatus{models.JobStatusFailed, models.JobStatusDeadLetter}).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to requeue job: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("job not found or not requeueable")
+	}
+
+	s.Wake()
+	return nil
+}
+
+// renewLease keeps extending a running job's lease until the returned func is called
+func (s *JobService) renewLease(jobID uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLeaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.db.Model(&models.Job{}).
+					Where("job_id = ? AND status = ?", jobID, models.JobStatusProcessing).
+					Update("locked_until", time.Now().Add(jobLeaseDuration)).Error; err != nil {
+					log.Printf("Failed to renew lease of job %d: %v", jobID, err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// recoverStaleJobs returns jobs whose worker stopped, e.g. in a crash or
+// restart, to the queue. Jobs still leased by a running worker, possibly of
+// another instance, are left alone.
+func (s *JobService) recoverStaleJobs() {
+	// Jobs claimed before leases existed have none; they get as long from
+	// when they started
+	now := time.Now()
+	result := s.db.Model(&models.Job{}).
+		Where("status = ?", models.JobStatusProcessing).
+		Where("locked_until < ? OR (locked_until IS NULL AND started_at < ?)", now, now.Add(-jobLeaseDuration)).
+		Updates(map[string]interface{}{
+			"status":       models.JobStatusPending,
+			"process_at":   now,
+			"locked_until": nil,
+		})
+	if result.Error != nil {
+		log.Printf("Failed to recover stale jobs: %v", result.Error)
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Recovered %d jobs whose worker stopped", result.RowsAffected)
+	}
 }
 
 func (s *JobService) startJobProcessor() {
+	s.recoverStaleJobs()
+
 	ticker := time.NewTicker(10 * time.Second) // Process jobs every 10 seconds
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
+			s.recoverStaleJobs()
+			s.processJobs()
+		case <-s.wake:
 			s.processJobs()
 		}
 	}
@@ -351,13 +599,13 @@ func (s *JobService) ScheduleWelcomeEmail(ctx context.Context, userEmail, userNa
 	return err
 }
 
-func (s *JobService) SchedulePaymentConfirmationEmail(ctx context.Context, userEmail, userName string, amount float64) error {
+func (s *JobService) SchedulePaymentConfirmationEmail(ctx context.Context, userEmail, userName string, amount money.Amount) error {
 	emailPayload := EmailJobPayload{
 		ToEmail:  userEmail,
 		ToName:   userName,
 		Subject:  "Payment Confirmation",
-		BodyHTML: fmt.Sprintf("<h1>Payment Confirmed</h1><p>Hello %s,</p><p>Your payment of %.2f THB has been confirmed.</p>", userName, amount),
-		BodyText: fmt.Sprintf("Hello %s, Your payment of %.2f THB has been confirmed.", userName, amount),
+		BodyHTML: fmt.Sprintf("<h1>Payment Confirmed</h1><p>Hello %s,</p><p>Your payment of %s THB has been confirmed.</p>", userName, amount.String()),
+		BodyText: fmt.Sprintf("Hello %s, Your payment of %s THB has been confirmed.", userName, amount.String()),
 	}
 
 	_, err := s.CreateEmailJob(ctx, emailPayload, 2, nil)
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// newIdleJobService returns a JobService without the background processor,
+// so tests decide when jobs are claimed and recovered
+func newIdleJobService(db *gorm.DB) *JobService {
+	return &JobService{
+		db:       db,
+		handlers: make(map[models.JobType]JobHandler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func TestRecoverStaleJobsLeavesLeasedJobsAlone(t *testing.T) {
+	db := openTestDB(t)
+	jobs := newIdleJobService(db)
+
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	longAgo := now.Add(-2 * jobLeaseDuration)
+
+	cases := []struct {
+		name        string
+		startedAt   time.Time
+		lockedUntil *time.Time
+		recovered   bool
+	}{
+		{"lease running", now, &future, false},
+		{"lease expired", longAgo, &past, true},
+		{"no lease, started recently", now, nil, false},
+		{"no lease, started long ago", longAgo, nil, true},
+	}
+
+	ids := make([]uint, len(cases))
+	for i, c := range cases {
+		startedAt := c.startedAt
+		job := models.Job{
+			JobType:     models.JobTypeItemDelivery,
+			Status:      models.JobStatusProcessing,
+			Payload:     models.JSON{},
+			ProcessAt:   longAgo,
+			StartedAt:   &startedAt,
+			LockedUntil: c.lockedUntil,
+		}
+		if err := db.Create(&job).Error; err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+		ids[i] = job.JobID
+	}
+
+	jobs.recoverStaleJobs()
+
+	for i, c := range cases {
+		var job models.Job
+		if err := db.First(&job, ids[i]).Error; err != nil {
+			t.Fatalf("failed to reload job: %v", err)
+		}
+		want := models.JobStatusProcessing
+		if c.recovered {
+			want = models.JobStatusPending
+		}
+		if job.Status != want {
+			t.Errorf("%s: job is %s, want %s", c.name, job.Status, want)
+		}
+	}
+}
+
+func TestProcessJobHoldsLeaseWhileRunning(t *testing.T) {
+	db := openTestDB(t)
+	jobs := newIdleJobService(db)
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+	jobs.RegisterHandler(models.JobTypeItemDelivery, JobHandler{
+		Process: func(ctx context.Context, job *models.Job) error {
+			close(running)
+			<-release
+			return nil
+		},
+	})
+
+	job := models.Job{
+		JobType:   models.JobTypeItemDelivery,
+		Status:    models.JobStatusPending,
+		Payload:   models.JSON{},
+		ProcessAt: time.Now(),
+	}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- jobs.ProcessJob(context.Background(), &job) }()
+	<-running
+
+	// Another instance starting up must not take the job away
+	newIdleJobService(db).recoverStaleJobs()
+
+	var claimed models.Job
+	db.First(&claimed, job.JobID)
+	if claimed.Status != models.JobStatusProcessing {
+		t.Errorf("running job is %s after recovery, want processing", claimed.Status)
+	}
+	if claimed.LockedUntil == nil || !claimed.LockedUntil.After(time.Now()) {
+		t.Errorf("running job is leased until %v, want a time in the future", claimed.LockedUntil)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("ProcessJob: %v", err)
+	}
+	db.First(&claimed, job.JobID)
+	if claimed.Status != models.JobStatusCompleted {
+		t.Errorf("job is %s, want completed", claimed.Status)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerService owns every change to a user's credit balance. Each change is
+// written with its credit_transactions entry while the user row is locked, so
+// concurrent spends can't both pass the balance check.
+type LedgerService struct {
+	db *gorm.DB
+}
+
+func NewLedgerService(db *gorm.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// LedgerEntry is one balance change. Amount is positive for credits and
+// negative for debits.
+type LedgerEntry struct {
+	UserID               uint
+	Amount               money.Amount
+	TransactionType      string
+	Description          string
+	RelatedPaymentID     *uint
+	RelatedTransactionID *uint
+	StripeRefundID       *string
+	DiscountAmount       money.Amount
+	CouponID             *uint
+	CreatedBy            *uint
+}
+
+// Post applies entries in a transaction of its own. See PostTx.
+func (s *LedgerService) Post(ctx context.Context, entries ...LedgerEntry) ([]models.CreditTransaction, error) {
+	var records []models.CreditTransaction
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		records, err = s.PostTx(tx, entries...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// PostTx applies entries in order inside tx and returns the ledger records,
+// one per entry. The users are locked in ascending user_id order before any
+// change so that two postings touching the same users can't deadlock. An
+// entry that would take a balance below zero fails the whole posting.
+func (s *LedgerService) PostTx(tx *gorm.DB, entries ...LedgerEntry) ([]models.CreditTransaction, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]uint, 0, len(entries))
+	seen := make(map[uint]bool, len(entries))
+	for _, entry := range entries {
+		if !seen[entry.UserID] {
+			seen[entry.UserID] = true
+			userIDs = append(userIDs, entry.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	balances := make(map[uint]money.Amount, len(userIDs))
+	for _, userID := range userIDs {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("user_id", "credit_balance").
+			Where("user_id = ?", userID).
+			First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("user %d not found", userID)
+			}
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		balances[userID] = user.CreditBalance
+	}
+
+	records := make([]models.CreditTransaction, len(entries))
+	for i, entry := range entries {
+		before := balances[entry.UserID]
+		after := before + entry.Amount
+		if after < 0 {
+			return nil, fmt.Errorf("insufficient credits: required=%s, available=%s",
+				-entry.Amount, before)
+		}
+		balances[entry.UserID] = after
+
+		description := entry.Description
+		records[i] = models.CreditTransaction{
+			UserID:               entry.UserID,
+			RelatedPaymentID:     entry.RelatedPaymentID,
+			RelatedTransactionID: entry.RelatedTransactionID,
+			StripeRefundID:       entry.StripeRefundID,
+			Amount:               entry.Amount,
+			DiscountAmount:       entry.DiscountAmount,
+			CouponID:             entry.CouponID,
+			TransactionType:      entry.TransactionType,
+			Description:          &description,
+			BalanceBefore:        before,
+			BalanceAfter:         after,
+			CreatedBy:            entry.CreatedBy,
+		}
+		if err := tx.Create(&records[i]).Error; err != nil {
+			return nil, fmt.Errorf("failed to create credit transaction: %w", err)
+		}
+	}
+
+	for _, userID := range userIDs {
+		if err := tx.Model(&models.User{}).
+			Where("user_id = ?", userID).
+			Update("credit_balance", balances[userID]).Error; err != nil {
+			return nil, fmt.Errorf("failed to update user balance: %w", err)
+		}
+	}
+
+	return records, nil
+}
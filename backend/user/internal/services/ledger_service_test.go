@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+)
+
+// runConcurrently starts every fn at once and waits for them, failing the test
+// if they haven't finished within timeout, e.g. because of a deadlock
+func runConcurrently(t *testing.T, timeout time.Duration, fns ...func() error) []error {
+	t.Helper()
+
+	errs := make([]error, len(fns))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn func() error) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn()
+		}(i, fn)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	close(start)
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("concurrent postings did not finish within %s", timeout)
+	}
+	return errs
+}
+
+func TestLedgerParallelDebitsNeverOverdraw(t *testing.T) {
+	db := openTestDB(t)
+	ledger := NewLedgerService(db)
+	user := createTestUser(t, db, ledger, "76561198000000001", money.FromBaht(10))
+
+	const spenders = 20
+	fns := make([]func() error, spenders)
+	for i := range fns {
+		fns[i] = func() error {
+			_, err := ledger.Post(context.Background(), LedgerEntry{
+				UserID:          user.UserID,
+				Amount:          -money.FromBaht(1),
+				TransactionType: "purchase",
+				Description:     "Parallel debit",
+			})
+			return err
+		}
+	}
+
+	succeeded := 0
+	for _, err := range runConcurrently(t, 30*time.Second, fns...) {
+		switch {
+		case err == nil:
+			succeeded++
+		case !isInsufficientCredits(err):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if succeeded != 10 {
+		t.Errorf("%d debits of 1 baht succeeded against 10 baht, want 10", succeeded)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.UserID)
+	if reloaded.CreditBalance != 0 {
+		t.Errorf("balance is %s, want 0", reloaded.CreditBalance)
+	}
+	assertLedgerConsistent(t, db)
+}
+
+func TestTransferCreditsBothDirectionsDoesNotDeadlock(t *testing.T) {
+	db := openTestDB(t)
+	ledger := NewLedgerService(db)
+	credits := NewCreditService(db, NewUserService(db, nil, nil), nil, ledger)
+	alice := createTestUser(t, db, ledger, "76561198000000002", money.FromBaht(50))
+	bob := createTestUser(t, db, ledger, "76561198000000003", money.FromBaht(50))
+
+	// Each direction locks the other user second unless the ledger sorts them
+	const transfersEachWay = 25
+	var fns []func() error
+	for i := 0; i < transfersEachWay; i++ {
+		fns = append(fns,
+			func() error {
+				return credits.TransferCredits(context.Background(), alice.UserID, TransferRequest{
+					ToUserID: bob.UserID,
+					Amount:   money.FromBaht(1),
+				})
+			},
+			func() error {
+				return credits.TransferCredits(context.Background(), bob.UserID, TransferRequest{
+					ToUserID: alice.UserID,
+					Amount:   money.FromBaht(1),
+				})
+			},
+		)
+	}
+
+	for _, err := range runConcurrently(t, 60*time.Second, fns...) {
+		if err != nil {
+			t.Errorf("transfer failed: %v", err)
+		}
+	}
+
+	for _, user := range []*models.User{alice, bob} {
+		var reloaded models.User
+		db.First(&reloaded, user.UserID)
+		if reloaded.CreditBalance != money.FromBaht(50) {
+			t.Errorf("user %d has %s after equal transfers both ways, want 50.00", user.UserID, reloaded.CreditBalance)
+		}
+	}
+	assertLedgerConsistent(t, db)
+}
+
+func TestPurchaseRacingTransferSpendsBalanceOnce(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	item := shop.createItem(t, "metal_ingot", money.FromBaht(10), "GiveItemNum {steam_id} 1")
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000004", 0)
+	friend := createTestUser(t, shop.db, shop.ledger, "76561198000000005", 0)
+
+	const rounds = 10
+	purchases := 0
+	for round := 0; round < rounds; round++ {
+		// Fund exactly one of the two spends
+		if _, err := shop.ledger.Post(context.Background(), LedgerEntry{
+			UserID:          buyer.UserID,
+			Amount:          money.FromBaht(10),
+			TransactionType: "topup",
+			Description:     "Round funds",
+		}); err != nil {
+			t.Fatalf("failed to fund buyer: %v", err)
+		}
+
+		errs := runConcurrently(t, 30*time.Second,
+			func() error {
+				_, err := shop.transactions.ProcessPurchase(context.Background(), buyer.UserID, PurchaseRequest{
+					Items: []PurchaseItem{{ItemID: item.ItemID, Quantity: 1, ServerID: shop.server.ServerID}},
+				})
+				return err
+			},
+			func() error {
+				return shop.credits.TransferCredits(context.Background(), buyer.UserID, TransferRequest{
+					ToUserID: friend.UserID,
+					Amount:   money.FromBaht(10),
+				})
+			},
+		)
+
+		failed := 0
+		for _, err := range errs {
+			if err == nil {
+				continue
+			}
+			failed++
+			if !isInsufficientCredits(err) {
+				t.Errorf("round %d: unexpected error: %v", round, err)
+			}
+		}
+		if failed != 1 {
+			t.Fatalf("round %d: %d of the purchase and transfer failed, want exactly 1", round, failed)
+		}
+		if errs[0] == nil {
+			purchases++
+		}
+	}
+
+	shop.waitForJobs(t)
+
+	var transactions int64
+	shop.db.Model(&models.Transaction{}).Where("user_id = ?", buyer.UserID).Count(&transactions)
+	if transactions != int64(purchases) {
+		t.Errorf("%d transactions recorded for %d successful purchases", transactions, purchases)
+	}
+
+	var reloaded models.User
+	shop.db.First(&reloaded, buyer.UserID)
+	if reloaded.CreditBalance != 0 {
+		t.Errorf("buyer balance is %s, want 0", reloaded.CreditBalance)
+	}
+	assertLedgerConsistent(t, shop.db)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"gorm.io/gorm"
 )
@@ -172,13 +173,13 @@ func (s *LoyaltyService) GetPointsHistory(ctx context.Context, userID uint, limi
 	return transactions, total, nil
 }
 
-func (s *LoyaltyService) AwardPointsForPurchase(ctx context.Context, userID uint, purchaseAmount float64) error {
+func (s *LoyaltyService) AwardPointsForPurchase(ctx context.Context, userID uint, purchaseAmount money.Amount) error {
 	// Award 1 point per 1 credit spent (configurable)
-	pointsToAward := int(purchaseAmount)
+	pointsToAward := int(purchaseAmount.Baht())
 
 	if pointsToAward > 0 {
 		return s.AwardPoints(ctx, userID, pointsToAward, "purchase",
-			fmt.Sprintf("Points earned from purchase (%.2f credits)", purchaseAmount))
+			fmt.Sprintf("Points earned from purchase (%s credits)", purchaseAmount))
 	}
 
 	return nil
@@ -7,33 +7,38 @@ import (
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 	"nexark-user-backend/pkg/stripe"
 
 	"github.com/google/uuid"
 	stripelib "github.com/stripe/stripe-go/v75"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentService struct {
 	db            *gorm.DB
 	stripeService *stripe.StripeService
 	userService   *UserService
+	ledgerService *LedgerService
 	frontendURL   string
 }
 
-func NewPaymentService(db *gorm.DB, stripeService *stripe.StripeService, userService *UserService, frontendURL string) *PaymentService {
+func NewPaymentService(db *gorm.DB, stripeService *stripe.StripeService, userService *UserService, ledgerService *LedgerService, frontendURL string) *PaymentService {
 	return &PaymentService{
 		db:            db,
 		stripeService: stripeService,
 		userService:   userService,
+		ledgerService: ledgerService,
 		frontendURL:   frontendURL,
 	}
 }
 
+// Amount limits are in satang: 100 to 50,000 THB
 type CreatePaymentIntentRequest struct {
-	Amount        float64 `json:"amount" binding:"required,min=100,max=50000"`
-	Currency      string  `json:"currency"`
-	PaymentMethod string  `json:"payment_method"`
+	Amount        money.Amount `json:"amount" binding:"required,min=10000,max=5000000"`
+	Currency      string       `json:"currency"`
+	PaymentMethod string       `json:"payment_method"`
 }
 
 func (s *PaymentService) CreatePaymentIntent(ctx context.Context, userID uint, req CreatePaymentIntentRequest) (*models.Payment, error) {
@@ -70,7 +75,6 @@ func (s *PaymentService) CreatePaymentIntent(ctx context.Context, userID uint, r
 	}
 
 	// Create Stripe payment intent
-	amountInCents := int64(req.Amount * 100) // Convert to cents
 
 	var paymentMethodTypes []string
 	switch req.PaymentMethod {
@@ -83,7 +87,7 @@ func (s *PaymentService) CreatePaymentIntent(ctx context.Context, userID uint, r
 	}
 
 	stripeParams := stripe.CreatePaymentIntentParams{
-		Amount:             amountInCents,
+		Amount:             req.Amount,
 		Currency:           req.Currency,
 		CustomerID:         *user.StripeCustomerID,
 		PaymentMethodTypes: paymentMethodTypes,
@@ -145,6 +149,10 @@ func (s *PaymentService) ProcessWebhook(ctx context.Context, event *stripelib.Ev
 		return s.handlePaymentFailed(ctx, event)
 	case "checkout.session.completed":
 		return s.handleCheckoutSessionCompleted(ctx, event)
+	case "charge.refunded":
+		return s.handleChargeRefunded(ctx, event)
+	case "charge.dispute.created":
+		return s.handleDisputeCreated(ctx, event)
 	default:
 		// Log unknown event type but don't fail
 		fmt.Printf("Unhandled webhook event type: %s\n", event.Type)
@@ -403,11 +411,11 @@ func (s *PaymentService) ValidatePaymentMethod(ctx context.Context, userID uint,
 
 func (s *PaymentService) CreateCheckoutSession(ctx context.Context, userID uint, req CreatePaymentIntentRequest) (*models.Payment, string, error) {
 	// Security validations
-	if req.Amount < 100 || req.Amount > 50000 {
+	if req.Amount < money.FromBaht(100) || req.Amount > money.FromBaht(50000) {
 		return nil, "", fmt.Errorf("invalid amount: must be between 100 and 50,000 THB")
 	}
 
-	if req.Currency != "thb" {
+	if req.Currency != money.Currency {
 		return nil, "", fmt.Errorf("only THB currency is supported")
 	}
 
@@ -470,7 +478,6 @@ func (s *PaymentService) CreateCheckoutSession(ctx context.Context, userID uint,
 	}
 
 	// Create Stripe checkout session
-	amountInCents := int64(req.Amount * 100) // Convert to cents
 
 	var paymentMethodTypes []string
 	switch req.PaymentMethod {
@@ -490,10 +497,10 @@ func (s *PaymentService) CreateCheckoutSession(ctx context.Context, userID uint,
 		CustomerID:         *user.StripeCustomerID,
 		SuccessURL:         successURL,
 		CancelURL:          cancelURL,
-		Amount:             amountInCents,
+		Amount:             req.Amount,
 		Currency:           req.Currency,
 		PaymentMethodTypes: paymentMethodTypes,
-		Description:        fmt.Sprintf("Credit Top-up: ฿%.2f", req.Amount),
+		Description:        fmt.Sprintf("Credit Top-up: ฿%s", req.Amount),
 		Metadata: map[string]string{
 			"payment_id": fmt.Sprintf("%d", payment.PaymentID),
 			"user_id":    fmt.Sprintf("%d", userID),
@@ -564,14 +571,15 @@ func (s *PaymentService) applySuccessfulPayment(ctx context.Context, paymentInte
 		return fmt.Errorf("payment not found: %w", err)
 	}
 
-	// Check if already processed (idempotency)
-	if payment.PaymentStatus == "completed" {
+	// Check if already processed (idempotency), including payments refunded or
+	// disputed since
+	if isCreditedPaymentStatus(payment.PaymentStatus) {
 		fmt.Printf("[INFO] Payment %d already processed, skipping\n", payment.PaymentID)
 		return nil // Already processed
 	}
 
 	// Security check: verify payment amount matches
-	expectedAmount := int64(payment.Amount * 100)
+	expectedAmount := payment.Amount.Minor()
 	if paymentIntent.Amount != expectedAmount {
 		fmt.Printf("[SECURITY] Amount mismatch for payment %d: expected %d, got %d\n",
 			payment.PaymentID, expectedAmount, paymentIntent.Amount)
@@ -601,20 +609,18 @@ func (s *PaymentService) applySuccessfulPayment(ctx context.Context, paymentInte
 		}
 
 		// Add credits to user account
-		err = s.userService.UpdateCreditBalance(
-			ctx,
-			payment.UserID,
-			payment.Amount,
-			"deposit",
-			fmt.Sprintf("Credit top-up via %s - Payment ID: %d", payment.PaymentMethod, payment.PaymentID),
-			&payment.PaymentID,
-			nil,
-		)
+		_, err = s.ledgerService.PostTx(tx, LedgerEntry{
+			UserID:           payment.UserID,
+			Amount:           payment.Amount,
+			TransactionType:  "deposit",
+			Description:      fmt.Sprintf("Credit top-up via %s - Payment ID: %d", payment.PaymentMethod, payment.PaymentID),
+			RelatedPaymentID: &payment.PaymentID,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to add credits: %w", err)
 		}
 
-		fmt.Printf("[SUCCESS] Payment %d processed successfully, added ฿%.2f credits to user %d\n",
+		fmt.Printf("[SUCCESS] Payment %d processed successfully, added ฿%s credits to user %d\n",
 			payment.PaymentID, payment.Amount, payment.UserID)
 
 		return nil
@@ -677,3 +683,340 @@ func (s *PaymentService) updateStalePaymentStatuses(ctx context.Context, userID
 func (s *PaymentService) getFrontendURL() string {
 	return s.frontendURL
 }
+
+// creditedPaymentStatuses are the statuses of payments whose credits have been
+// deposited
+var creditedPaymentStatuses = []string{"completed", "partially_refunded", "refunded", "disputed"}
+
+func isCreditedPaymentStatus(status string) bool {
+	for _, credited := range creditedPaymentStatuses {
+		if status == credited {
+			return true
+		}
+	}
+	return false
+}
+
+// RefundPaymentRequest refunds Amount of a top-up, or all of what is left
+// unrefunded when Amount is omitted
+type RefundPaymentRequest struct {
+	Amount *money.Amount `json:"amount"`
+	Reason string        `json:"reason" binding:"required,oneof=duplicate fraudulent requested_by_customer"`
+	Note   string        `json:"note"`
+}
+
+// PaymentRefundFilter narrows the refund list; zero values match all
+type PaymentRefundFilter struct {
+	PaymentID     uint
+	UserID        uint
+	WithShortfall bool
+}
+
+// RefundPayment refunds a completed top-up through Stripe and claws the
+// credits back from the user. When their balance no longer covers the refund,
+// it is emptied and the rest is recorded as the refund's shortfall.
+func (s *PaymentService) RefundPayment(ctx context.Context, paymentID uint, req RefundPaymentRequest, adminID uint) (*models.PaymentRefund, error) {
+	var refund models.PaymentRefund
+	var paymentIntentID string
+
+	// Reserve the amount before calling Stripe so concurrent refunds can't
+	// exceed the payment
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("payment not found")
+			}
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+
+		if payment.PaymentStatus != "completed" && payment.PaymentStatus != "partially_refunded" {
+			return fmt.Errorf("invalid payment status: %s payments can't be refunded", payment.PaymentStatus)
+		}
+		if payment.StripePaymentIntentID == nil {
+			return fmt.Errorf("invalid payment: no Stripe payment intent")
+		}
+
+		refundable := payment.Amount - payment.RefundedAmount
+		amount := refundable
+		if req.Amount != nil {
+			amount = *req.Amount
+		}
+		if amount <= 0 || amount > refundable {
+			return fmt.Errorf("invalid refund amount: must be between 0.01 and %s", refundable)
+		}
+
+		if err := tx.Model(&payment).
+			Update("refunded_amount", gorm.Expr("refunded_amount + ?", amount)).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+
+		reason := req.Reason
+		refund = models.PaymentRefund{
+			PaymentID: payment.PaymentID,
+			UserID:    payment.UserID,
+			Amount:    amount,
+			Status:    models.RefundProcessing,
+			Source:    models.RefundSourceAdmin,
+			Reason:    &reason,
+			CreatedBy: &adminID,
+		}
+		if req.Note != "" {
+			refund.Note = &req.Note
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return fmt.Errorf("failed to create refund: %w", err)
+		}
+
+		paymentIntentID = *payment.StripePaymentIntentID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// From here on the refund must be recorded whatever Stripe answers, so a
+	// client disconnecting can't cancel the remaining steps
+	ctx = context.WithoutCancel(ctx)
+
+	stripeRefund, err := s.stripeService.CreateRefund(ctx, paymentIntentID, &refund.Amount, req.Reason)
+	if err != nil {
+		if releaseErr := s.failRefund(ctx, &refund, err); releaseErr != nil {
+			fmt.Printf("[ERROR] Failed to release refund %d of payment %d: %v\n", refund.RefundID, paymentID, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		return s.applyRefundTx(tx, &payment, &refund, &stripeRefund.ID, &adminID)
+	})
+	if err != nil {
+		fmt.Printf("[ERROR] Stripe refund %s of payment %d succeeded but was not recorded: %v\n",
+			stripeRefund.ID, paymentID, err)
+		return nil, fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	return &refund, nil
+}
+
+// failRefund marks a refund that Stripe rejected as failed and gives its
+// amount back to the payment
+func (s *PaymentService) failRefund(ctx context.Context, refund *models.PaymentRefund, cause error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Payment{}).
+			Where("payment_id = ?", refund.PaymentID).
+			Update("refunded_amount", gorm.Expr("refunded_amount - ?", refund.Amount)).Error; err != nil {
+			return err
+		}
+
+		message := cause.Error()
+		return tx.Model(refund).Updates(map[string]interface{}{
+			"status":         models.RefundFailed,
+			"failure_reason": message,
+		}).Error
+	})
+}
+
+// applyRefundTx claws back as much of refund as the user's balance covers and
+// completes the refund. payment must be locked in tx and already include the
+// refund in RefundedAmount.
+func (s *PaymentService) applyRefundTx(tx *gorm.DB, payment *models.Payment, refund *models.PaymentRefund, stripeRefundID *string, createdBy *uint) error {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("user_id", "credit_balance").
+		Where("user_id = ?", payment.UserID).
+		First(&user).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	clawback := refund.Amount
+	if user.CreditBalance < clawback {
+		clawback = user.CreditBalance
+	}
+
+	refund.StripeRefundID = stripeRefundID
+	refund.CreditsClawedBack = clawback
+	refund.Shortfall = refund.Amount - clawback
+	refund.Status = models.RefundCompleted
+
+	if clawback > 0 {
+		records, err := s.ledgerService.PostTx(tx, LedgerEntry{
+			UserID:           payment.UserID,
+			Amount:           -clawback,
+			TransactionType:  "payment_refund",
+			Description:      fmt.Sprintf("Refund of credit top-up - Payment ID: %d", payment.PaymentID),
+			RelatedPaymentID: &payment.PaymentID,
+			StripeRefundID:   stripeRefundID,
+			CreatedBy:        createdBy,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to claw back credits: %w", err)
+		}
+		refund.CreditTransactionID = &records[0].CreditTransactionID
+	}
+
+	if refund.Shortfall > 0 {
+		fmt.Printf("[WARNING] Refund of payment %d exceeds the balance of user %d by ฿%s\n",
+			payment.PaymentID, payment.UserID, refund.Shortfall)
+	}
+
+	if err := tx.Save(refund).Error; err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+
+	return s.updateRefundStatusTx(tx, payment)
+}
+
+// updateRefundStatusTx sets the status of a refunded payment from its
+// refunded amount. Disputed payments keep their status.
+func (s *PaymentService) updateRefundStatusTx(tx *gorm.DB, payment *models.Payment) error {
+	if payment.PaymentStatus == "disputed" || payment.RefundedAmount <= 0 {
+		return nil
+	}
+
+	status := "partially_refunded"
+	if payment.RefundedAmount >= payment.Amount {
+		status = "refunded"
+	}
+	if err := tx.Model(payment).Update("payment_status", status).Error; err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	return nil
+}
+
+// handleChargeRefunded records refunds made outside RefundPayment, such as
+// from the Stripe dashboard, and updates the payment status. Refunds made
+// through RefundPayment are already counted in the refunded amount.
+func (s *PaymentService) handleChargeRefunded(ctx context.Context, event *stripelib.Event) error {
+	var charge stripelib.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return fmt.Errorf("failed to unmarshal charge: %w", err)
+	}
+	if charge.PaymentIntent == nil {
+		fmt.Printf("[INFO] Refunded charge %s has no payment intent, skipping\n", charge.ID)
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("stripe_payment_intent_id = ?", charge.PaymentIntent.ID).
+			First(&payment).Error
+		if err != nil {
+			return fmt.Errorf("payment not found: %w", err)
+		}
+
+		refunded := money.FromMinor(charge.AmountRefunded)
+		if refunded <= payment.RefundedAmount {
+			return s.updateRefundStatusTx(tx, &payment)
+		}
+		if !isCreditedPaymentStatus(payment.PaymentStatus) {
+			// Nothing was deposited, so there is nothing to claw back
+			fmt.Printf("[WARNING] Payment %d refunded while %s, skipping\n", payment.PaymentID, payment.PaymentStatus)
+			return nil
+		}
+
+		refund := models.PaymentRefund{
+			PaymentID: payment.PaymentID,
+			UserID:    payment.UserID,
+			Amount:    refunded - payment.RefundedAmount,
+			Status:    models.RefundProcessing,
+			Source:    models.RefundSourceStripe,
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return fmt.Errorf("failed to create refund: %w", err)
+		}
+
+		if err := tx.Model(&payment).Update("refunded_amount", refunded).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		payment.RefundedAmount = refunded
+
+		// The refund list is only included when the event expands it; take the
+		// newest refund not recorded yet
+		var stripeRefundID *string
+		if charge.Refunds != nil {
+			for _, stripeRefund := range charge.Refunds.Data {
+				var count int64
+				if err := tx.Model(&models.PaymentRefund{}).
+					Where("stripe_refund_id = ?", stripeRefund.ID).
+					Count(&count).Error; err != nil {
+					return fmt.Errorf("failed to check refund: %w", err)
+				}
+				if count == 0 {
+					stripeRefundID = &stripeRefund.ID
+					break
+				}
+			}
+		}
+
+		return s.applyRefundTx(tx, &payment, &refund, stripeRefundID, nil)
+	})
+}
+
+// handleDisputeCreated marks the disputed payment. Credits are left alone
+// until the dispute is settled.
+func (s *PaymentService) handleDisputeCreated(ctx context.Context, event *stripelib.Event) error {
+	var dispute stripelib.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		return fmt.Errorf("failed to unmarshal dispute: %w", err)
+	}
+	if dispute.PaymentIntent == nil {
+		fmt.Printf("[INFO] Dispute %s has no payment intent, skipping\n", dispute.ID)
+		return nil
+	}
+
+	var payment models.Payment
+	err := s.db.Where("stripe_payment_intent_id = ?", dispute.PaymentIntent.ID).First(&payment).Error
+	if err != nil {
+		return fmt.Errorf("payment not found: %w", err)
+	}
+
+	metadata := payment.Metadata
+	if metadata == nil {
+		metadata = models.JSON{}
+	}
+	metadata["dispute_id"] = dispute.ID
+	metadata["dispute_reason"] = string(dispute.Reason)
+	metadata["dispute_amount"] = money.FromMinor(dispute.Amount)
+
+	if err := s.db.Model(&payment).Updates(map[string]interface{}{
+		"payment_status": "disputed",
+		"metadata":       metadata,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	fmt.Printf("[WARNING] Payment %d of user %d disputed: %s\n", payment.PaymentID, payment.UserID, dispute.Reason)
+	return nil
+}
+
+// GetRefunds returns refunds matching filter, newest first
+func (s *PaymentService) GetRefunds(ctx context.Context, filter PaymentRefundFilter, limit, offset int) ([]models.PaymentRefund, int64, error) {
+	query := s.db.Model(&models.PaymentRefund{})
+	if filter.PaymentID != 0 {
+		query = query.Where("payment_id = ?", filter.PaymentID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.WithShortfall {
+		query = query.Where("shortfall > 0")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count refunds: %w", err)
+	}
+
+	var refunds []models.PaymentRefund
+	if err := query.Order("refund_id DESC").Limit(limit).Offset(offset).Find(&refunds).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get refunds: %w", err)
+	}
+
+	return refunds, total, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// PricingService resolves whether an item is sold on a server, what it costs
+// there, including any running flash sale, and which command delivers it
+type PricingService struct {
+	db *gorm.DB
+}
+
+func NewPricingService(db *gorm.DB) *PricingService {
+	return &PricingService{db: db}
+}
+
+// ItemOffer is an item as sold on one server. Price is what the buyer pays;
+// OriginalPrice is the server price before any flash sale.
+type ItemOffer struct {
+	ItemID        uint
+	ServerID      uint
+	Available     bool
+	Price         money.Amount
+	OriginalPrice money.Amount
+	SaleID        *uint
+	RCONCommand   string
+}
+
+// ResolveOffer returns the offer for item on serverID using tx. Items without
+// availability rows are sold everywhere at their base price. The best running
+// flash sale is applied on top of the server price.
+func (s *PricingService) ResolveOffer(tx *gorm.DB, item *models.Item, serverID uint) (*ItemOffer, error) {
+	var rows []models.ItemServerAvailability
+	if err := tx.Where("item_id = ?", item.ItemID).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get item availability: %w", err)
+	}
+
+	offer := &ItemOffer{
+		ItemID:      item.ItemID,
+		ServerID:    serverID,
+		Available:   len(rows) == 0,
+		Price:       item.Price,
+		RCONCommand: item.RCONCommand,
+	}
+
+	for _, row := range rows {
+		if row.ServerID != serverID {
+			continue
+		}
+		offer.Available = row.IsAvailable
+		if row.PriceOverride != nil {
+			offer.Price = *row.PriceOverride
+		}
+		if row.RCONCommandOverride != nil && *row.RCONCommandOverride != "" {
+			offer.RCONCommand = *row.RCONCommandOverride
+		}
+	}
+
+	offer.OriginalPrice = offer.Price
+	sales, err := activeSales(tx, []uint{item.ItemID}, []uint{item.CategoryID}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if sale := bestSale(sales, item, offer.Price); sale != nil {
+		offer.Price = SalePrice(sale, offer.OriginalPrice)
+		offer.SaleID = &sale.SaleID
+	}
+
+	return offer, nil
+}
+
+// ApplyPrices prices items for the shop. With a non-zero serverID each price is
+// replaced with the price on that server; the items must already be filtered
+// with AvailableOnServer. Items on a running flash sale get SalePrice and
+// SaleEndsAt set, leaving Price as the original price.
+func (s *PricingService) ApplyPrices(ctx context.Context, items []models.Item, serverID uint) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	itemIDs := make([]uint, len(items))
+	categoryIDs := make([]uint, len(items))
+	for i := range items {
+		itemIDs[i] = items[i].ItemID
+		categoryIDs[i] = items[i].CategoryID
+	}
+
+	if serverID != 0 {
+		if err := s.applyServerPrices(items, itemIDs, serverID); err != nil {
+			return err
+		}
+	}
+
+	sales, err := activeSales(s.db, itemIDs, categoryIDs, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if sale := bestSale(sales, &items[i], items[i].Price); sale != nil {
+			price := SalePrice(sale, items[i].Price)
+			endsAt := sale.EndsAt
+			items[i].SalePrice = &price
+			items[i].SaleEndsAt = &endsAt
+		}
+	}
+
+	return nil
+}
+
+func (s *PricingService) applyServerPrices(items []models.Item, itemIDs []uint, serverID uint) error {
+	var rows []models.ItemServerAvailability
+	if err := s.db.Where("server_id = ? AND item_id IN ? AND price_override IS NOT NULL", serverID, itemIDs).
+		Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to get server prices: %w", err)
+	}
+
+	prices := make(map[uint]money.Amount, len(rows))
+	for _, row := range rows {
+		prices[row.ItemID] = *row.PriceOverride
+	}
+
+	for i := range items {
+		if price, ok := prices[items[i].ItemID]; ok {
+			items[i].Price = price
+		}
+	}
+
+	return nil
+}
+
+// SalePrice is price with the sale discount taken off, never below zero
+func SalePrice(sale *models.FlashSale, price money.Amount) money.Amount {
+	discounted := price - sale.DiscountValue
+	if sale.DiscountType == models.CouponTypePercentage {
+		discounted = price - price.Percent(sale.DiscountValue)
+	}
+	if discounted < 0 {
+		return 0
+	}
+	return discounted
+}
+
+// activeSales loads the sales running at now that target any of the items or
+// categories
+func activeSales(db *gorm.DB, itemIDs, categoryIDs []uint, now time.Time) ([]models.FlashSale, error) {
+	var sales []models.FlashSale
+	err := db.Where("is_active = ? AND starts_at <= ? AND ends_at > ?", true, now, now).
+		Where("sale_id IN (SELECT sale_id FROM flash_sale_targets WHERE (target_type = ? AND target_id IN ?) OR (target_type = ? AND target_id IN ?))",
+			models.SaleTargetItem, itemIDs, models.SaleTargetCategory, categoryIDs).
+		Preload("Targets").
+		Find(&sales).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flash sales: %w", err)
+	}
+	return sales, nil
+}
+
+// bestSale returns the sale giving item the lowest price, or nil when none
+// covers it
+func bestSale(sales []models.FlashSale, item *models.Item, price money.Amount) *models.FlashSale {
+	var best *models.FlashSale
+	bestPrice := price
+	for i := range sales {
+		if !sales[i].Covers(item.ItemID, item.CategoryID) {
+			continue
+		}
+		if salePrice := SalePrice(&sales[i], price); best == nil || salePrice < bestPrice {
+			best = &sales[i]
+			bestPrice = salePrice
+		}
+	}
+	return best
+}
+
+// AvailableOnServer limits an items query to the items sold on serverID
+func AvailableOnServer(serverID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"(NOT EXISTS (SELECT 1 FROM item_server_availability isa WHERE isa.item_id = items.item_id)"+
+				" OR EXISTS (SELECT 1 FROM item_server_availability isa WHERE isa.item_id = items.item_id AND isa.server_id = ? AND isa.is_available = ?))",
+			serverID, true)
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxConsoleServers caps how many servers one console command may target
+const MaxConsoleServers = 20
+
+// RCONConsoleService lets admins run RCON commands, subject to the command
+// policies of their roles, and search the command history.
+type RCONConsoleService struct {
+	db            *gorm.DB
+	serverService *ServerService
+	roleService   *RoleService
+}
+
+func NewRCONConsoleService(db *gorm.DB, serverService *ServerService, roleService *RoleService) *RCONConsoleService {
+	return &RCONConsoleService{
+		db:            db,
+		serverService: serverService,
+		roleService:   roleService,
+	}
+}
+
+// ConsoleResult is the outcome of a console command on one server
+type ConsoleResult struct {
+	ServerID uint   `json:"server_id"`
+	Success  bool   `json:"success"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RCONHistoryFilter narrows a command history search; zero values match all
+type RCONHistoryFilter struct {
+	ServerID         uint
+	ExecutedBy       uint
+	Status           string
+	ExecutionContext string
+	// Query matches part of the command
+	Query  string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// CheckCommand returns an error unless one of roles allows command. Within a
+// role a matching deny wins over a matching allow.
+func (s *RCONConsoleService) CheckCommand(ctx context.Context, roles []string, command string) error {
+	name := commandName(command)
+	if name == "" {
+		return fmt.Errorf("command is required")
+	}
+	if len(roles) == 0 {
+		return fmt.Errorf("command not allowed: no admin role")
+	}
+
+	var policies []models.RCONCommandPolicy
+	if err := s.db.Where("role IN ?", roles).Find(&policies).Error; err != nil {
+		return fmt.Errorf("failed to get command policies: %w", err)
+	}
+
+	allowed := make(map[string]bool)
+	denied := make(map[string]bool)
+	for _, policy := range policies {
+		if !matchCommandPattern(policy.Pattern, name) {
+			continue
+		}
+		if policy.Effect == models.RCONPolicyDeny {
+			denied[policy.Role] = true
+		} else {
+			allowed[policy.Role] = true
+		}
+	}
+
+	for role := range allowed {
+		if !denied[role] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("command not allowed: %s", name)
+}
+
+// Execute runs command on every server in serverIDs on behalf of userID. The
+// policy check happens once up front; a denied command is recorded in the
+// history of each targeted server and nothing is sent.
+func (s *RCONConsoleService) Execute(ctx context.Context, userID uint, serverIDs []uint, command string) ([]ConsoleResult, error) {
+	command = strings.TrimSpace(command)
+	serverIDs = uniqueIDs(serverIDs)
+	if len(serverIDs) == 0 {
+		return nil, fmt.Errorf("at least one server is required")
+	}
+	if len(serverIDs) > MaxConsoleServers {
+		return nil, fmt.Errorf("at most %d servers can be targeted at once", MaxConsoleServers)
+	}
+
+	roles, err := s.roleService.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.CheckCommand(ctx, roles, command); err != nil {
+		if strings.Contains(err.Error(), "not allowed") {
+			s.recordDenied(userID, serverIDs, command, err)
+		}
+		return nil, err
+	}
+
+	results := make([]ConsoleResult, len(serverIDs))
+	var wg sync.WaitGroup
+
+	for i, serverID := range serverIDs {
+		wg.Add(1)
+		go func(i int, serverID uint) {
+			defer wg.Done()
+
+			result := ConsoleResult{ServerID: serverID}
+			response, err := s.serverService.ExecuteRCONCommandAs(ctx, serverID, command, userID, RCONContextConsole)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = response.Success
+				result.Response = response.Response
+				result.Error = response.Error
+			}
+			results[i] = result
+		}(i, serverID)
+	}
+
+	wg.Wait()
+	return results, nil
+}
+
+func (s *RCONConsoleService) recordDenied(userID uint, serverIDs []uint, command string, reason error) {
+	message := reason.Error()
+	for _, serverID := range serverIDs {
+		entry := models.RCONCommandHistory{
+			ServerID:         serverID,
+			Command:          command,
+			Response:         &message,
+			Status:           "denied",
+			ExecutedBy:       &userID,
+			ExecutionContext: RCONContextConsole,
+			ExecutedAt:       time.Now(),
+		}
+		// Unknown server IDs fail the foreign key; the attempt is refused anyway
+		if err := s.db.Create(&entry).Error; err != nil {
+			log.Printf("Failed to log denied RCON command: %v", err)
+		}
+	}
+}
+
+// SearchHistory returns command history matching filter, newest first
+func (s *RCONConsoleService) SearchHistory(ctx context.Context, filter RCONHistoryFilter) ([]models.RCONCommandHistory, int64, error) {
+	query := s.db.Model(&models.RCONCommandHistory{})
+
+	if filter.ServerID != 0 {
+		query = query.Where("server_id = ?", filter.ServerID)
+	}
+	if filter.ExecutedBy != 0 {
+		query = query.Where("executed_by = ?", filter.ExecutedBy)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ExecutionContext != "" {
+		query = query.Where("execution_context = ?", filter.ExecutionContext)
+	}
+	if filter.Query != "" {
+		query = query.Where("command LIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.From != nil {
+		query = query.Where("executed_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("executed_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count command history: %w", err)
+	}
+
+	var history []models.RCONCommandHistory
+	err := query.Preload("Server").
+		Order("executed_at DESC, command_id DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&history).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get command history: %w", err)
+	}
+
+	return history, total, nil
+}
+
+// commandName returns the first word of an RCON command. ARK also accepts
+// commands behind cheat/admincheat, so those prefixes are skipped to keep them
+// from slipping past deny patterns.
+func commandName(command string) string {
+	fields := strings.Fields(command)
+	for len(fields) > 1 && (strings.EqualFold(fields[0], "cheat") || strings.EqualFold(fields[0], "admincheat")) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// matchCommandPattern matches a policy pattern against a command name, ignoring
+// case as ARK does
+func matchCommandPattern(pattern, name string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && matched
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
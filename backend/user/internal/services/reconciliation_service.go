@@ -0,0 +1,528 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"nexark-user-backend/internal/config"
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// ReconciliationService checks the credit and loyalty ledgers against the
+// balances they produce and completed payments against their deposits, and
+// records what it finds for admins to follow up.
+type ReconciliationService struct {
+	db      *gorm.DB
+	cfg     config.ReconciliationConfig
+	running sync.Mutex
+}
+
+func NewReconciliationService(db *gorm.DB, cfg config.ReconciliationConfig) *ReconciliationService {
+	return &ReconciliationService{db: db, cfg: cfg}
+}
+
+// ReconciliationReport is a run with its issue counts
+type ReconciliationReport struct {
+	models.ReconciliationRun
+	IssuesByType   map[string]int64 `json:"issues_by_type"`
+	IssuesByStatus map[string]int64 `json:"issues_by_status"`
+}
+
+// ReconciliationIssueFilter narrows the issue list; zero values match all
+type ReconciliationIssueFilter struct {
+	RunID     uint
+	IssueType string
+	Status    string
+	UserID    uint
+}
+
+// UpdateIssueRequest resolves or ignores an issue, or reopens it
+type UpdateIssueRequest struct {
+	Status string `json:"status" binding:"required,oneof=open resolved ignored"`
+	Note   string `json:"note"`
+}
+
+// ledgerRow is a credit or loyalty ledger row as checked by the chain check
+type ledgerRow struct {
+	ID            uint
+	UserID        uint
+	Amount        int64
+	BalanceBefore int64
+	BalanceAfter  int64
+}
+
+// ledgerSpec describes one of the two ledgers: credits in minor units, loyalty
+// in points
+type ledgerSpec struct {
+	table        string
+	idColumn     string
+	amountColumn string
+	userColumn   string
+	driftIssue   string
+	chainIssue   string
+	format       func(int64) string
+	setEntryID   func(issue *models.ReconciliationIssue, id uint)
+}
+
+var (
+	creditLedger = ledgerSpec{
+		table:        "credit_transactions",
+		idColumn:     "credit_transaction_id",
+		amountColumn: "amount",
+		userColumn:   "credit_balance",
+		driftIssue:   models.IssueCreditBalanceDrift,
+		chainIssue:   models.IssueCreditChainBreak,
+		format:       func(v int64) string { return money.FromMinor(v).String() },
+		setEntryID: func(issue *models.ReconciliationIssue, id uint) {
+			issue.CreditTransactionID = &id
+		},
+	}
+	loyaltyLedger = ledgerSpec{
+		table:        "loyalty_point_transactions",
+		idColumn:     "point_transaction_id",
+		amountColumn: "points",
+		userColumn:   "loyalty_points",
+		driftIssue:   models.IssueLoyaltyPointsDrift,
+		chainIssue:   models.IssueLoyaltyChainBreak,
+		format:       func(v int64) string { return strconv.FormatInt(v, 10) },
+		setEntryID: func(issue *models.ReconciliationIssue, id uint) {
+			issue.PointTransactionID = &id
+		},
+	}
+)
+
+// Start runs the reconciliation on the configured interval in the background
+func (s *ReconciliationService) Start() {
+	if !s.cfg.Enabled || s.cfg.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			run, err := s.Run(context.Background(), nil)
+			if err != nil {
+				log.Printf("Ledger reconciliation failed: %v", err)
+			} else if run.IssueCount > 0 {
+				log.Printf("Ledger reconciliation run %d found %d issues", run.RunID, run.IssueCount)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Run reconciles the ledgers now. triggeredBy is the admin who asked for the
+// run, or nil for scheduled runs. Only one run happens at a time.
+func (s *ReconciliationService) Run(ctx context.Context, triggeredBy *uint) (*models.ReconciliationRun, error) {
+	if !s.running.TryLock() {
+		return nil, fmt.Errorf("reconciliation already running")
+	}
+	defer s.running.Unlock()
+
+	run := models.ReconciliationRun{
+		Status:      models.ReconciliationRunning,
+		TriggeredBy: triggeredBy,
+	}
+	if err := s.db.Create(&run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create reconciliation run: %w", err)
+	}
+
+	issues, err := s.check(ctx, &run)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = models.ReconciliationCompleted
+	if err == nil && len(issues) > 0 {
+		for i := range issues {
+			issues[i].RunID = run.RunID
+		}
+		if createErr := s.db.CreateInBatches(issues, 100).Error; createErr != nil {
+			err = fmt.Errorf("failed to save reconciliation issues: %w", createErr)
+		}
+	}
+	if err != nil {
+		message := err.Error()
+		run.Status = models.ReconciliationFailed
+		run.ErrorMessage = &message
+	} else {
+		run.IssueCount = len(issues)
+	}
+
+	if saveErr := s.db.Save(&run).Error; saveErr != nil {
+		return nil, fmt.Errorf("failed to update reconciliation run: %w", saveErr)
+	}
+	if err != nil {
+		return &run, err
+	}
+	return &run, nil
+}
+
+func (s *ReconciliationService) check(ctx context.Context, run *models.ReconciliationRun) ([]models.ReconciliationIssue, error) {
+	var issues []models.ReconciliationIssue
+	db := s.db.WithContext(ctx)
+
+	var users int64
+	if err := db.Model(&models.User{}).Count(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	run.UsersChecked = int(users)
+
+	for _, ledger := range []ledgerSpec{creditLedger, loyaltyLedger} {
+		drift, err := checkBalanceDrift(db, ledger)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, drift...)
+
+		chain, entries, err := checkLedgerChain(db, ledger)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, chain...)
+		run.EntriesChecked += entries
+	}
+
+	payments, checked, err := checkPaymentDeposits(db)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, payments...)
+	run.PaymentsChecked = checked
+
+	return issues, nil
+}
+
+// checkBalanceDrift finds users whose balance differs from the sum of their
+// ledger entries
+func checkBalanceDrift(db *gorm.DB, ledger ledgerSpec) ([]models.ReconciliationIssue, error) {
+	var rows []struct {
+		UserID      uint
+		Balance     int64
+		LedgerTotal int64
+	}
+	err := db.Table("users u").
+		Select(fmt.Sprintf("u.user_id, COALESCE(u.%s, 0) AS balance, COALESCE(SUM(l.%s), 0) AS ledger_total",
+			ledger.userColumn, ledger.amountColumn)).
+		Joins(fmt.Sprintf("LEFT JOIN %s l ON l.user_id = u.user_id", ledger.table)).
+		Group(fmt.Sprintf("u.user_id, u.%s", ledger.userColumn)).
+		Having("balance <> ledger_total").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s balances: %w", ledger.table, err)
+	}
+
+	issues := make([]models.ReconciliationIssue, 0, len(rows))
+	for _, row := range rows {
+		userID := row.UserID
+		expected := ledger.format(row.LedgerTotal)
+		actual := ledger.format(row.Balance)
+		issues = append(issues, models.ReconciliationIssue{
+			IssueType: ledger.driftIssue,
+			UserID:    &userID,
+			Expected:  &expected,
+			Actual:    &actual,
+			Details: fmt.Sprintf("Balance %s does not match the %s total %s (difference %s)",
+				actual, ledger.table, expected, ledger.format(row.Balance-row.LedgerTotal)),
+		})
+	}
+	return issues, nil
+}
+
+// checkLedgerChain walks each user's ledger in order. Every row must start from
+// the previous row's balance_after (0 for the first row) and end at
+// balance_before plus its amount.
+func checkLedgerChain(db *gorm.DB, ledger ledgerSpec) ([]models.ReconciliationIssue, int, error) {
+	rows, err := db.Table(ledger.table).
+		Select(fmt.Sprintf("%s AS id, user_id, %s AS amount, balance_before, balance_after",
+			ledger.idColumn, ledger.amountColumn)).
+		Order("user_id, " + ledger.idColumn).
+		Rows()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", ledger.table, err)
+	}
+	defer rows.Close()
+
+	var issues []models.ReconciliationIssue
+	var entries int
+	var previous *ledgerRow
+
+	for rows.Next() {
+		var row ledgerRow
+		if err := db.ScanRows(rows, &row); err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", ledger.table, err)
+		}
+		entries++
+
+		var expectedBefore int64
+		if previous != nil && previous.UserID == row.UserID {
+			expectedBefore = previous.BalanceAfter
+		}
+
+		if row.BalanceBefore != expectedBefore {
+			details := fmt.Sprintf("Entry %d starts at %s but the previous entry ended at %s",
+				row.ID, ledger.format(row.BalanceBefore), ledger.format(expectedBefore))
+			if previous == nil || previous.UserID != row.UserID {
+				details = fmt.Sprintf("First entry %d starts at %s instead of 0",
+					row.ID, ledger.format(row.BalanceBefore))
+			}
+			issues = append(issues, chainIssue(ledger, row, expectedBefore, row.BalanceBefore, details))
+		}
+		if row.BalanceAfter != row.BalanceBefore+row.Amount {
+			issues = append(issues, chainIssue(ledger, row, row.BalanceBefore+row.Amount, row.BalanceAfter,
+				fmt.Sprintf("Entry %d ends at %s but %s %+d should end at %s",
+					row.ID, ledger.format(row.BalanceAfter), ledger.format(row.BalanceBefore),
+					row.Amount, ledger.format(row.BalanceBefore+row.Amount))))
+		}
+
+		previous = &row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", ledger.table, err)
+	}
+
+	return issues, entries, nil
+}
+
+func chainIssue(ledger ledgerSpec, row ledgerRow, expected, actual int64, details string) models.ReconciliationIssue {
+	userID := row.UserID
+	expectedValue := ledger.format(expected)
+	actualValue := ledger.format(actual)
+	issue := models.ReconciliationIssue{
+		IssueType: ledger.chainIssue,
+		UserID:    &userID,
+		Expected:  &expectedValue,
+		Actual:    &actualValue,
+		Details:   details,
+	}
+	ledger.setEntryID(&issue, row.ID)
+	return issue
+}
+
+// checkPaymentDeposits matches completed payments, including those refunded or
+// disputed since, with exactly one deposit entry of the same amount, and
+// deposits with such a payment. Refunds are separate ledger entries.
+func checkPaymentDeposits(db *gorm.DB) ([]models.ReconciliationIssue, int, error) {
+	var issues []models.ReconciliationIssue
+
+	var completed int64
+	if err := db.Model(&models.Payment{}).Where("payment_status IN ?", creditedPaymentStatuses).Count(&completed).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count payments: %w", err)
+	}
+
+	// Completed payments that never credited the user
+	var missing []models.Payment
+	err := db.Where("payment_status IN ?", creditedPaymentStatuses).
+		Where("NOT EXISTS (SELECT 1 FROM credit_transactions ct WHERE ct.related_payment_id = payments.payment_id AND ct.transaction_type = ?)", "deposit").
+		Find(&missing).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check payments: %w", err)
+	}
+	for _, payment := range missing {
+		paymentID, userID := payment.PaymentID, payment.UserID
+		expected := payment.Amount.String()
+		actual := money.Amount(0).String()
+		issues = append(issues, models.ReconciliationIssue{
+			IssueType: models.IssuePaymentMissingDeposit,
+			UserID:    &userID,
+			PaymentID: &paymentID,
+			Expected:  &expected,
+			Actual:    &actual,
+			Details:   fmt.Sprintf("Payment %d completed but no deposit was credited", paymentID),
+		})
+	}
+
+	// Deposits per payment, compared with the payment
+	var deposits []struct {
+		PaymentID     uint
+		UserID        uint
+		Deposits      int
+		Total         money.Amount
+		Amount        money.Amount
+		PaymentStatus string
+	}
+	err = db.Table("credit_transactions ct").
+		Select("p.payment_id, p.user_id, COUNT(*) AS deposits, SUM(ct.amount) AS total, p.amount, p.payment_status").
+		Joins("JOIN payments p ON p.payment_id = ct.related_payment_id").
+		Where("ct.transaction_type = ?", "deposit").
+		Group("p.payment_id, p.user_id, p.amount, p.payment_status").
+		Scan(&deposits).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check deposits: %w", err)
+	}
+	for _, deposit := range deposits {
+		paymentID, userID := deposit.PaymentID, deposit.UserID
+		expected := deposit.Amount.String()
+		actual := deposit.Total.String()
+		issue := models.ReconciliationIssue{
+			UserID:    &userID,
+			PaymentID: &paymentID,
+			Expected:  &expected,
+			Actual:    &actual,
+		}
+		switch {
+		case !isCreditedPaymentStatus(deposit.PaymentStatus):
+			issue.IssueType = models.IssueOrphanDeposit
+			issue.Details = fmt.Sprintf("Payment %d was credited but is %s", paymentID, deposit.PaymentStatus)
+		case deposit.Deposits > 1:
+			issue.IssueType = models.IssueDuplicateDeposit
+			issue.Details = fmt.Sprintf("Payment %d was credited %d times", paymentID, deposit.Deposits)
+		case deposit.Total != deposit.Amount:
+			issue.IssueType = models.IssueDepositAmountMismatch
+			issue.Details = fmt.Sprintf("Payment %d of %s was credited %s", paymentID, expected, actual)
+		default:
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	// Deposits without a payment
+	var orphans []models.CreditTransaction
+	err = db.Where("transaction_type = ?", "deposit").
+		Where("related_payment_id IS NULL OR NOT EXISTS (SELECT 1 FROM payments p WHERE p.payment_id = credit_transactions.related_payment_id)").
+		Find(&orphans).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check deposits: %w", err)
+	}
+	for _, orphan := range orphans {
+		creditTransactionID, userID := orphan.CreditTransactionID, orphan.UserID
+		actual := orphan.Amount.String()
+		issues = append(issues, models.ReconciliationIssue{
+			IssueType:           models.IssueOrphanDeposit,
+			UserID:              &userID,
+			CreditTransactionID: &creditTransactionID,
+			Actual:              &actual,
+			Details:             fmt.Sprintf("Deposit %d has no payment", creditTransactionID),
+		})
+	}
+
+	return issues, int(completed), nil
+}
+
+// GetRuns returns reconciliation runs, newest first
+func (s *ReconciliationService) GetRuns(ctx context.Context, limit, offset int) ([]models.ReconciliationRun, int64, error) {
+	var total int64
+	if err := s.db.Model(&models.ReconciliationRun{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count reconciliation runs: %w", err)
+	}
+
+	var runs []models.ReconciliationRun
+	if err := s.db.Order("run_id DESC").Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get reconciliation runs: %w", err)
+	}
+
+	return runs, total, nil
+}
+
+// GetReport returns a run with its issues counted by type and status
+func (s *ReconciliationService) GetReport(ctx context.Context, runID uint) (*ReconciliationReport, error) {
+	var run models.ReconciliationRun
+	if err := s.db.First(&run, runID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("reconciliation run not found")
+		}
+		return nil, fmt.Errorf("failed to get reconciliation run: %w", err)
+	}
+
+	report := &ReconciliationReport{
+		ReconciliationRun: run,
+		IssuesByType:      map[string]int64{},
+		IssuesByStatus:    map[string]int64{},
+	}
+
+	for _, group := range []struct {
+		column string
+		counts map[string]int64
+	}{
+		{"issue_type", report.IssuesByType},
+		{"status", report.IssuesByStatus},
+	} {
+		var rows []struct {
+			Key   string
+			Count int64
+		}
+		if err := s.db.Model(&models.ReconciliationIssue{}).
+			Select(group.column+" AS `key`, COUNT(*) AS count").
+			Where("run_id = ?", runID).
+			Group(group.column).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count reconciliation issues: %w", err)
+		}
+		for _, row := range rows {
+			group.counts[row.Key] = row.Count
+		}
+	}
+
+	return report, nil
+}
+
+// GetIssues returns issues matching filter, newest first
+func (s *ReconciliationService) GetIssues(ctx context.Context, filter ReconciliationIssueFilter, limit, offset int) ([]models.ReconciliationIssue, int64, error) {
+	query := s.db.Model(&models.ReconciliationIssue{})
+	if filter.RunID != 0 {
+		query = query.Where("run_id = ?", filter.RunID)
+	}
+	if filter.IssueType != "" {
+		query = query.Where("issue_type = ?", filter.IssueType)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count reconciliation issues: %w", err)
+	}
+
+	var issues []models.ReconciliationIssue
+	if err := query.Order("issue_id DESC").Limit(limit).Offset(offset).Find(&issues).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get reconciliation issues: %w", err)
+	}
+
+	return issues, total, nil
+}
+
+// UpdateIssue records how an admin dealt with an issue. Reopening clears the
+// resolution.
+func (s *ReconciliationService) UpdateIssue(ctx context.Context, issueID uint, req UpdateIssueRequest, adminID uint) (*models.ReconciliationIssue, error) {
+	var issue models.ReconciliationIssue
+	if err := s.db.First(&issue, issueID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("reconciliation issue not found")
+		}
+		return nil, fmt.Errorf("failed to get reconciliation issue: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"status":          req.Status,
+		"resolution_note": nil,
+		"resolved_by":     nil,
+		"resolved_at":     nil,
+	}
+	if req.Status != models.IssueStatusOpen {
+		updates["resolution_note"] = req.Note
+		updates["resolved_by"] = adminID
+		updates["resolved_at"] = time.Now()
+	}
+
+	if err := s.db.Model(&issue).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update reconciliation issue: %w", err)
+	}
+	if err := s.db.First(&issue, issueID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation issue: %w", err)
+	}
+
+	return &issue, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefundService returns the credits of purchases that could not be delivered
+type RefundService struct {
+	db            *gorm.DB
+	ledgerService *LedgerService
+	couponService *CouponService
+}
+
+func NewRefundService(db *gorm.DB, ledgerService *LedgerService, couponService *CouponService) *RefundService {
+	return &RefundService{
+		db:            db,
+		ledgerService: ledgerService,
+		couponService: couponService,
+	}
+}
+
+// refundableStatuses are the transaction states in which nothing more will be delivered
+var refundableStatuses = map[string]bool{
+	"failed":          true,
+	"awaiting_player": true,
+}
+
+// RefundTransaction reverses the purchase of a transaction: the buyer gets the
+// amount back as a "refund" ledger entry, limited stock is restored, its coupon
+// discount is taken off the redemption and the transaction is marked refunded. refundedBy is nil for automatic refunds.
+func (s *RefundService) RefundTransaction(ctx context.Context, transactionID uint, reason string, refundedBy *uint) (*models.CreditTransaction, error) {
+	var refund models.CreditTransaction
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the transaction so concurrent refunds can't both pass the checks
+		var transaction models.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("transaction_id = ?", transactionID).
+			First(&transaction).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("transaction not found")
+			}
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+
+		if transaction.Status == "refunded" {
+			return fmt.Errorf("transaction already refunded")
+		}
+		if !refundableStatuses[transaction.Status] {
+			return fmt.Errorf("transaction is not refundable in status %s", transaction.Status)
+		}
+
+		// The purchase debit this refund reverses, if it was linked to this transaction
+		var purchase models.CreditTransaction
+		err := tx.Where("related_transaction_id = ? AND transaction_type IN ?",
+			transaction.TransactionID, []string{"purchase", "gift"}).
+			First(&purchase).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed to get purchase record: %w", err)
+		}
+
+		description := fmt.Sprintf("Refund for transaction %s: %s", transaction.TransactionUUID, reason)
+		if purchase.CreditTransactionID != 0 {
+			description = fmt.Sprintf("Refund of credit transaction %d for transaction %s: %s",
+				purchase.CreditTransactionID, transaction.TransactionUUID, reason)
+		}
+
+		records, err := s.ledgerService.PostTx(tx, LedgerEntry{
+			UserID:               transaction.UserID,
+			Amount:               transaction.Amount,
+			TransactionType:      "refund",
+			Description:          description,
+			RelatedTransactionID: &transaction.TransactionID,
+			CreatedBy:            refundedBy,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to refund credits: %w", err)
+		}
+		refund = records[0]
+
+		// Put limited stock back (-1 means unlimited)
+		if err := tx.Model(&models.Item{}).
+			Where("item_id = ? AND stock_quantity <> -1", transaction.ItemID).
+			Update("stock_quantity", gorm.Expr("stock_quantity + ?", transaction.Quantity)).Error; err != nil {
+			return fmt.Errorf("failed to restore stock: %w", err)
+		}
+
+		if err := s.couponService.ReverseRedemption(tx, &transaction); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Transaction{}).
+			Where("transaction_id = ?", transaction.TransactionID).
+			Updates(map[string]interface{}{
+				"status":         "refunded",
+				"failure_reason": reason,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// IsPartiallyDelivered reports whether any delivery step of a transaction
+// completed. Those aren't refunded automatically since the player got something.
+func (s *RefundService) IsPartiallyDelivered(ctx context.Context, transactionID uint) (bool, error) {
+	var delivered int64
+	if err := s.db.Model(&models.TransactionDeliveryStep{}).
+		Where("transaction_id = ? AND status = ?", transactionID, "completed").
+		Count(&delivered).Error; err != nil {
+		return false, fmt.Errorf("failed to count delivered steps: %w", err)
+	}
+
+	return delivered > 0, nil
+}
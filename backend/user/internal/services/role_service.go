@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RoleService manages admin roles and resolves the permissions of a user.
+// Permissions are looked up per request, so revoking a role takes effect
+// without waiting for tokens to expire.
+type RoleService struct {
+	db *gorm.DB
+}
+
+func NewRoleService(db *gorm.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// UserRoleAssignment is a role held by a user, for admin listings
+type UserRoleAssignment struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	SteamID   string    `json:"steam_id"`
+	Role      string    `json:"role"`
+	GrantedBy *uint     `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// GetUserRoles returns the roles granted to a user
+func (s *RoleService) GetUserRoles(ctx context.Context, userID uint) ([]string, error) {
+	var roles []string
+	err := s.db.Model(&models.UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role").
+		Pluck("role", &roles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetUserPermissions returns the permissions a user holds through their roles
+func (s *RoleService) GetUserPermissions(ctx context.Context, userID uint) ([]string, error) {
+	roles, err := s.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	var permissions []string
+	query := s.db.Model(&models.Permission{})
+	if !containsString(roles, models.RoleSuperadmin) {
+		query = query.Where("permission_key IN (?)",
+			s.db.Model(&models.RolePermission{}).Select("permission_key").Where("role_key IN ?", roles))
+	}
+	if err := query.Order("permission_key").Pluck("permission_key", &permissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// HasPermission reports whether a user holds permission
+func (s *RoleService) HasPermission(ctx context.Context, userID uint, permission string) (bool, error) {
+	permissions, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return containsString(permissions, permission), nil
+}
+
+// GetRoles returns every role with its permissions
+func (s *RoleService) GetRoles(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.Order("role_key").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	var allPermissions []string
+	if err := s.db.Model(&models.Permission{}).Order("permission_key").Pluck("permission_key", &allPermissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+
+	var rolePermissions []models.RolePermission
+	if err := s.db.Order("permission_key").Find(&rolePermissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	byRole := make(map[string][]string)
+	for _, rp := range rolePermissions {
+		byRole[rp.RoleKey] = append(byRole[rp.RoleKey], rp.PermissionKey)
+	}
+
+	for i := range roles {
+		if roles[i].RoleKey == models.RoleSuperadmin {
+			roles[i].Permissions = allPermissions
+		} else {
+			roles[i].Permissions = byRole[roles[i].RoleKey]
+		}
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []string{}
+		}
+	}
+
+	return roles, nil
+}
+
+// GetRoleAssignments returns the users holding any role, optionally only role
+func (s *RoleService) GetRoleAssignments(ctx context.Context, role string) ([]UserRoleAssignment, error) {
+	var assignments []UserRoleAssignment
+	query := s.db.Table("user_roles").
+		Select("user_roles.user_id, users.username, users.steam_id, user_roles.role, user_roles.granted_by, user_roles.granted_at").
+		Joins("JOIN users ON users.user_id = user_roles.user_id")
+	if role != "" {
+		query = query.Where("user_roles.role = ?", role)
+	}
+
+	if err := query.Order("user_roles.role, users.username").Scan(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get role assignments: %w", err)
+	}
+
+	return assignments, nil
+}
+
+// GrantRole gives role to a user and records it in the audit log
+func (s *RoleService) GrantRole(ctx context.Context, userID uint, role string, performedBy *uint, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkRoleAndUser(tx, userID, role); err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserRole{
+			UserID:    userID,
+			Role:      role,
+			GrantedBy: performedBy,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to grant role: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user already has role %s", role)
+		}
+
+		return s.audit(tx, userID, role, models.RoleActionGrant, performedBy, reason)
+	})
+}
+
+// RevokeRole takes role away from a user and records it in the audit log. The
+// last superadmin can't be revoked, so someone can always manage roles.
+func (s *RoleService) RevokeRole(ctx context.Context, userID uint, role string, performedBy *uint, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkRoleAndUser(tx, userID, role); err != nil {
+			return err
+		}
+
+		if role == models.RoleSuperadmin {
+			var superadmins []models.UserRole
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ?", models.RoleSuperadmin).
+				Find(&superadmins).Error; err != nil {
+				return fmt.Errorf("failed to count superadmins: %w", err)
+			}
+			if len(superadmins) == 1 && superadmins[0].UserID == userID {
+				return fmt.Errorf("cannot revoke the last superadmin")
+			}
+		}
+
+		result := tx.Where("user_id = ? AND role = ?", userID, role).Delete(&models.UserRole{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke role: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user does not have role %s", role)
+		}
+
+		return s.audit(tx, userID, role, models.RoleActionRevoke, performedBy, reason)
+	})
+}
+
+// GetAuditLog returns role changes, newest first. userID 0 returns all users.
+func (s *RoleService) GetAuditLog(ctx context.Context, userID uint, limit, offset int) ([]models.RoleAuditLog, int64, error) {
+	query := s.db.Model(&models.RoleAuditLog{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count role audit log: %w", err)
+	}
+
+	var entries []models.RoleAuditLog
+	if err := query.Order("created_at DESC, audit_id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get role audit log: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// BootstrapSuperadmins grants superadmin to the users with the given Steam IDs.
+// Users who haven't signed in yet are skipped and picked up on a later start.
+func (s *RoleService) BootstrapSuperadmins(ctx context.Context, steamIDs []string) {
+	for _, steamID := range steamIDs {
+		var user models.User
+		if err := s.db.Where("steam_id = ?", steamID).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Failed to look up bootstrap superadmin %s: %v", steamID, err)
+			}
+			continue
+		}
+
+		err := s.GrantRole(ctx, user.UserID, models.RoleSuperadmin, nil, "bootstrap from ADMIN_SUPERADMIN_STEAM_IDS")
+		if err == nil {
+			log.Printf("Granted superadmin to %s", steamID)
+		}
+	}
+}
+
+func (s *RoleService) checkRoleAndUser(tx *gorm.DB, userID uint, role string) error {
+	var count int64
+	if err := tx.Model(&models.Role{}).Where("role_key = ?", role).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("role not found")
+	}
+
+	if err := tx.Model(&models.User{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+func (s *RoleService) audit(tx *gorm.DB, userID uint, role, action string, performedBy *uint, reason string) error {
+	entry := models.RoleAuditLog{
+		UserID:      userID,
+		RoleKey:     role,
+		Action:      action,
+		PerformedBy: performedBy,
+	}
+	if reason != "" {
+		entry.Reason = &reason
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to write role audit log: %w", err)
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaleService schedules flash sales. Sale prices themselves are worked out by
+// PricingService.
+type SaleService struct {
+	db *gorm.DB
+}
+
+func NewSaleService(db *gorm.DB) *SaleService {
+	return &SaleService{db: db}
+}
+
+// SaleInput creates or partially updates a flash sale; nil fields are left
+// unchanged. ItemIDs and CategoryIDs, when set, replace the sale's targets.
+type SaleInput struct {
+	Name          *string       `json:"name"`
+	DiscountType  *string       `json:"discount_type"`
+	DiscountValue *money.Amount `json:"discount_value"`
+	// StartsAt and EndsAt are RFC3339 times
+	StartsAt    *string `json:"starts_at"`
+	EndsAt      *string `json:"ends_at"`
+	IsActive    *bool   `json:"is_active"`
+	ItemIDs     *[]uint `json:"item_ids"`
+	CategoryIDs *[]uint `json:"category_ids"`
+}
+
+// GetSales returns sales, latest start first. status is "running",
+// "scheduled", "ended" or empty for all sales including inactive ones.
+func (s *SaleService) GetSales(ctx context.Context, status string, limit, offset int) ([]models.FlashSale, int64, error) {
+	now := time.Now()
+	query := s.db.Model(&models.FlashSale{})
+	switch status {
+	case "":
+	case "running":
+		query = query.Where("is_active = ? AND starts_at <= ? AND ends_at > ?", true, now, now)
+	case "scheduled":
+		query = query.Where("is_active = ? AND starts_at > ?", true, now)
+	case "ended":
+		query = query.Where("is_active = ? OR ends_at <= ?", false, now)
+	default:
+		return nil, 0, fmt.Errorf("invalid status %q", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count sales: %w", err)
+	}
+
+	var sales []models.FlashSale
+	if err := query.Order("starts_at DESC, sale_id DESC").Limit(limit).Offset(offset).
+		Preload("Targets").Find(&sales).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get sales: %w", err)
+	}
+
+	return sales, total, nil
+}
+
+func (s *SaleService) GetSale(ctx context.Context, saleID uint) (*models.FlashSale, error) {
+	var sale models.FlashSale
+	if err := s.db.Preload("Targets").First(&sale, saleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("sale not found")
+		}
+		return nil, fmt.Errorf("failed to get sale: %w", err)
+	}
+	return &sale, nil
+}
+
+func (s *SaleService) CreateSale(ctx context.Context, input SaleInput, adminID uint) (*models.FlashSale, error) {
+	sale := models.FlashSale{IsActive: true, CreatedBy: &adminID}
+	if err := applySaleInput(&sale, input); err != nil {
+		return nil, err
+	}
+	if sale.StartsAt.IsZero() || sale.EndsAt.IsZero() {
+		return nil, fmt.Errorf("invalid sale: starts_at and ends_at are required")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := validateSale(tx, &sale); err != nil {
+			return err
+		}
+
+		desired := sale
+		if err := tx.Omit("Targets").Create(&sale).Error; err != nil {
+			return fmt.Errorf("failed to create sale: %w", err)
+		}
+		// Create replaces is_active = false with the column default
+		if !desired.IsActive {
+			if err := tx.Model(&sale).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to create sale: %w", err)
+			}
+		}
+		return replaceSaleTargets(tx, sale.SaleID, desired.Targets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetSale(ctx, sale.SaleID)
+}
+
+func (s *SaleService) UpdateSale(ctx context.Context, saleID uint, input SaleInput) (*models.FlashSale, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var sale models.FlashSale
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Targets").First(&sale, saleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("sale not found")
+			}
+			return fmt.Errorf("failed to get sale: %w", err)
+		}
+
+		if err := applySaleInput(&sale, input); err != nil {
+			return err
+		}
+		if err := validateSale(tx, &sale); err != nil {
+			return err
+		}
+
+		if err := tx.Omit("Targets").Save(&sale).Error; err != nil {
+			return fmt.Errorf("failed to update sale: %w", err)
+		}
+		if input.ItemIDs != nil || input.CategoryIDs != nil {
+			return replaceSaleTargets(tx, sale.SaleID, sale.Targets)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetSale(ctx, saleID)
+}
+
+// DeactivateSale ends a sale early or cancels a scheduled one. Sales are kept
+// as a record of past prices.
+func (s *SaleService) DeactivateSale(ctx context.Context, saleID uint) error {
+	result := s.db.Model(&models.FlashSale{}).Where("sale_id = ?", saleID).Update("is_active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to deactivate sale: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetSale(ctx, saleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applySaleInput(sale *models.FlashSale, input SaleInput) error {
+	if input.Name != nil {
+		sale.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.DiscountType != nil {
+		sale.DiscountType = *input.DiscountType
+	}
+	if input.DiscountValue != nil {
+		sale.DiscountValue = *input.DiscountValue
+	}
+	if input.IsActive != nil {
+		sale.IsActive = *input.IsActive
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+		dest  *time.Time
+	}{
+		{"starts_at", input.StartsAt, &sale.StartsAt},
+		{"ends_at", input.EndsAt, &sale.EndsAt},
+	} {
+		if field.value == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			return fmt.Errorf("invalid sale: %s must be an RFC3339 time", field.name)
+		}
+		*field.dest = t
+	}
+
+	if input.ItemIDs != nil || input.CategoryIDs != nil {
+		targets := []models.FlashSaleTarget{}
+		for _, target := range sale.Targets {
+			if target.TargetType == models.SaleTargetItem && input.ItemIDs == nil ||
+				target.TargetType == models.SaleTargetCategory && input.CategoryIDs == nil {
+				targets = append(targets, target)
+			}
+		}
+		if input.ItemIDs != nil {
+			for _, id := range *input.ItemIDs {
+				targets = append(targets, models.FlashSaleTarget{TargetType: models.SaleTargetItem, TargetID: id})
+			}
+		}
+		if input.CategoryIDs != nil {
+			for _, id := range *input.CategoryIDs {
+				targets = append(targets, models.FlashSaleTarget{TargetType: models.SaleTargetCategory, TargetID: id})
+			}
+		}
+		sale.Targets = targets
+	}
+
+	return nil
+}
+
+func validateSale(tx *gorm.DB, sale *models.FlashSale) error {
+	if sale.Name == "" || len(sale.Name) > 100 {
+		return fmt.Errorf("invalid sale: name must be 1-100 characters")
+	}
+
+	switch sale.DiscountType {
+	case models.CouponTypePercentage:
+		if sale.DiscountValue <= 0 || sale.DiscountValue > money.FromBaht(100) {
+			return fmt.Errorf("invalid sale: percentage must be above 0 and at most 100")
+		}
+	case models.CouponTypeFixed:
+		if sale.DiscountValue <= 0 {
+			return fmt.Errorf("invalid sale: discount_value must be positive")
+		}
+	default:
+		return fmt.Errorf("invalid sale: discount_type must be percentage or fixed")
+	}
+
+	if !sale.EndsAt.After(sale.StartsAt) {
+		return fmt.Errorf("invalid sale: ends_at must be after starts_at")
+	}
+
+	if len(sale.Targets) == 0 {
+		return fmt.Errorf("invalid sale: at least one item or category is required")
+	}
+	seen := make(map[models.FlashSaleTarget]bool, len(sale.Targets))
+	for _, target := range sale.Targets {
+		key := models.FlashSaleTarget{TargetType: target.TargetType, TargetID: target.TargetID}
+		if seen[key] {
+			return fmt.Errorf("invalid sale: %s %d is listed twice", target.TargetType, target.TargetID)
+		}
+		seen[key] = true
+
+		var count int64
+		query := tx.Model(&models.Item{}).Where("item_id = ?", target.TargetID)
+		if target.TargetType == models.SaleTargetCategory {
+			query = tx.Model(&models.ItemCategory{}).Where("category_id = ?", target.TargetID)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to get %s: %w", target.TargetType, err)
+		}
+		if count == 0 {
+			return fmt.Errorf("invalid sale: %s %d does not exist", target.TargetType, target.TargetID)
+		}
+	}
+
+	return nil
+}
+
+func replaceSaleTargets(tx *gorm.DB, saleID uint, targets []models.FlashSaleTarget) error {
+	if err := tx.Where("sale_id = ?", saleID).Delete(&models.FlashSaleTarget{}).Error; err != nil {
+		return fmt.Errorf("failed to update sale targets: %w", err)
+	}
+
+	rows := make([]models.FlashSaleTarget, len(targets))
+	for i, target := range targets {
+		rows[i] = models.FlashSaleTarget{SaleID: saleID, TargetType: target.TargetType, TargetID: target.TargetID}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to update sale targets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"nexark-user-backend/internal/config"
+	"nexark-user-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// History resolutions. Raw samples are served in 5-minute buckets.
+const (
+	HistoryResolutionRaw    = "5m"
+	HistoryResolutionHourly = "1h"
+	HistoryResolutionDaily  = "1d"
+)
+
+const rawBucketSeconds = 300
+
+// ServerHistoryService downsamples server status samples into hourly and daily
+// rollups and serves population and uptime history from them.
+type ServerHistoryService struct {
+	db  *gorm.DB
+	cfg config.MonitorConfig
+}
+
+func NewServerHistoryService(db *gorm.DB, cfg config.MonitorConfig) *ServerHistoryService {
+	return &ServerHistoryService{db: db, cfg: cfg}
+}
+
+// HistoryPoint is the population and uptime of a server in one bucket
+type HistoryPoint struct {
+	Time          time.Time `json:"time"`
+	AvgPlayers    float64   `json:"avg_players"`
+	PeakPlayers   int       `json:"peak_players"`
+	UptimePercent float64   `json:"uptime_percent"`
+	Samples       int       `json:"samples"`
+}
+
+// HistorySummary aggregates a whole range
+type HistorySummary struct {
+	UptimePercent float64 `json:"uptime_percent"`
+	AvgPlayers    float64 `json:"avg_players"`
+	PeakPlayers   int     `json:"peak_players"`
+	Samples       int     `json:"samples"`
+}
+
+// ServerHistory is the history of one server over a range
+type ServerHistory struct {
+	ServerID   uint           `json:"server_id"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Resolution string         `json:"resolution"`
+	Summary    HistorySummary `json:"summary"`
+	Points     []HistoryPoint `json:"points"`
+}
+
+type historyBucket struct {
+	BucketStart time.Time
+	SampleCount int
+	OnlineCount int
+	PlayerSum   int64
+	PeakPlayers int
+}
+
+// Start rolls up and prunes history every hour in the background
+func (s *ServerHistoryService) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Rollup(context.Background()); err != nil {
+				log.Printf("Server history rollup failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Rollup recomputes the hourly rollups of the last two days and the daily
+// rollups of the last three, then prunes data past its retention. Buckets are
+// upserted, so running it again is harmless.
+func (s *ServerHistoryService) Rollup(ctx context.Context) error {
+	now := time.Now()
+
+	hourlySince := now.Add(-48 * time.Hour).Truncate(time.Hour)
+	err := s.db.Exec(`
+		INSERT INTO server_status_hourly (server_id, bucket_start, sample_count, online_count, player_sum, peak_players)
+		SELECT server_id,
+			DATE_FORMAT(sampled_at, '%Y-%m-%d %H:00:00') AS bucket,
+			COUNT(*),
+			SUM(is_online),
+			SUM(player_count),
+			MAX(player_count)
+		FROM server_status_samples
+		WHERE sampled_at >= ?
+		GROUP BY server_id, bucket
+		ON DUPLICATE KEY UPDATE
+			sample_count = VALUES(sample_count),
+			online_count = VALUES(online_count),
+			player_sum = VALUES(player_sum),
+			peak_players = VALUES(peak_players)`, hourlySince).Error
+	if err != nil {
+		return fmt.Errorf("failed to roll up hourly history: %w", err)
+	}
+
+	dailySince := now.AddDate(0, 0, -3).Format("2006-01-02")
+	err = s.db.Exec(`
+		INSERT INTO server_status_daily (server_id, bucket_start, sample_count, online_count, player_sum, peak_players)
+		SELECT server_id,
+			DATE(bucket_start) AS bucket,
+			SUM(sample_count),
+			SUM(online_count),
+			SUM(player_sum),
+			MAX(peak_players)
+		FROM server_status_hourly
+		WHERE bucket_start >= ?
+		GROUP BY server_id, bucket
+		ON DUPLICATE KEY UPDATE
+			sample_count = VALUES(sample_count),
+			online_count = VALUES(online_count),
+			player_sum = VALUES(player_sum),
+			peak_players = VALUES(peak_players)`, dailySince).Error
+	if err != nil {
+		return fmt.Errorf("failed to roll up daily history: %w", err)
+	}
+
+	// Prune, keeping enough raw data to rebuild the buckets above
+	rawCutoff := now.Add(-s.cfg.RawRetention)
+	if rawCutoff.After(hourlySince) {
+		rawCutoff = hourlySince
+	}
+	if err := s.db.Where("sampled_at < ?", rawCutoff).Delete(&models.ServerStatusSample{}).Error; err != nil {
+		return fmt.Errorf("failed to prune status samples: %w", err)
+	}
+
+	hourlyCutoff := now.Add(-s.cfg.HourlyRetention)
+	if hourlyCutoff.After(now.AddDate(0, 0, -3)) {
+		hourlyCutoff = now.AddDate(0, 0, -3)
+	}
+	if err := s.db.Where("bucket_start < ?", hourlyCutoff).Delete(&models.ServerStatusHourly{}).Error; err != nil {
+		return fmt.Errorf("failed to prune hourly history: %w", err)
+	}
+
+	return nil
+}
+
+// ChooseResolution picks the finest resolution still covered by retention and
+// reasonable in size for the range.
+func (s *ServerHistoryService) ChooseResolution(from, to time.Time) string {
+	span := to.Sub(from)
+	switch {
+	case span <= 2*24*time.Hour && time.Since(from) <= s.cfg.RawRetention:
+		return HistoryResolutionRaw
+	case span <= 31*24*time.Hour && time.Since(from) <= s.cfg.HourlyRetention:
+		return HistoryResolutionHourly
+	default:
+		return HistoryResolutionDaily
+	}
+}
+
+// GetHistory returns population and uptime of a server between from and to.
+// An empty resolution is chosen from the range.
+func (s *ServerHistoryService) GetHistory(ctx context.Context, serverID uint, from, to time.Time, resolution string) (*ServerHistory, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid range: from must be before to")
+	}
+	if resolution == "" {
+		resolution = s.ChooseResolution(from, to)
+	}
+
+	var buckets []historyBucket
+	var err error
+
+	switch resolution {
+	case HistoryResolutionRaw:
+		err = s.db.Raw(`
+			SELECT FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(sampled_at) / ?) * ?) AS bucket_start,
+				COUNT(*) AS sample_count,
+				SUM(is_online) AS online_count,
+				SUM(player_count) AS player_sum,
+				MAX(player_count) AS peak_players
+			FROM server_status_samples
+			WHERE server_id = ? AND sampled_at >= ? AND sampled_at < ?
+			GROUP BY bucket_start
+			ORDER BY bucket_start`,
+			rawBucketSeconds, rawBucketSeconds, serverID, from, to).Scan(&buckets).Error
+	case HistoryResolutionHourly:
+		err = s.db.Model(&models.ServerStatusHourly{}).
+			Where("server_id = ? AND bucket_start >= ? AND bucket_start < ?", serverID, from.Truncate(time.Hour), to).
+			Order("bucket_start").
+			Scan(&buckets).Error
+	case HistoryResolutionDaily:
+		err = s.db.Model(&models.ServerStatusDaily{}).
+			Where("server_id = ? AND bucket_start >= ? AND bucket_start < ?", serverID, from.Format("2006-01-02"), to).
+			Order("bucket_start").
+			Scan(&buckets).Error
+	default:
+		return nil, fmt.Errorf("invalid resolution %q", resolution)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server history: %w", err)
+	}
+
+	history := &ServerHistory{
+		ServerID:   serverID,
+		From:       from,
+		To:         to,
+		Resolution: resolution,
+		Points:     make([]HistoryPoint, 0, len(buckets)),
+	}
+
+	var total historyBucket
+	for _, bucket := range buckets {
+		history.Points = append(history.Points, bucket.point())
+
+		total.SampleCount += bucket.SampleCount
+		total.OnlineCount += bucket.OnlineCount
+		total.PlayerSum += bucket.PlayerSum
+		if bucket.PeakPlayers > total.PeakPlayers {
+			total.PeakPlayers = bucket.PeakPlayers
+		}
+	}
+
+	summary := total.point()
+	history.Summary = HistorySummary{
+		UptimePercent: summary.UptimePercent,
+		AvgPlayers:    summary.AvgPlayers,
+		PeakPlayers:   summary.PeakPlayers,
+		Samples:       summary.Samples,
+	}
+
+	return history, nil
+}
+
+func (b historyBucket) point() HistoryPoint {
+	point := HistoryPoint{
+		Time:        b.BucketStart,
+		PeakPlayers: b.PeakPlayers,
+		Samples:     b.SampleCount,
+	}
+	if b.SampleCount > 0 {
+		point.AvgPlayers = float64(b.PlayerSum) / float64(b.SampleCount)
+		point.UptimePercent = float64(b.OnlineCount) * 100 / float64(b.SampleCount)
+	}
+	return point
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"nexark-user-backend/internal/config"
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/a2s"
+
+	"gorm.io/gorm"
+)
+
+// ServerProbe checks whether a game server is up and how many players it has
+type ServerProbe interface {
+	Name() string
+	Probe(ctx context.Context, server *models.Server) (*ProbeResult, error)
+}
+
+// ProbeResult is what a probe learned about a server. MaxPlayers is 0 when
+// the probe can't tell.
+type ProbeResult struct {
+	Players    int
+	MaxPlayers int
+	Latency    time.Duration
+}
+
+// RCONProbe counts players with the ListPlayers RCON command
+type RCONProbe struct {
+	serverService *ServerService
+}
+
+func NewRCONProbe(serverService *ServerService) *RCONProbe {
+	return &RCONProbe{serverService: serverService}
+}
+
+func (p *RCONProbe) Name() string {
+	return "rcon"
+}
+
+func (p *RCONProbe) Probe(ctx context.Context, server *models.Server) (*ProbeResult, error) {
+	start := time.Now()
+	players, err := p.serverService.ListPlayers(ctx, server.ServerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProbeResult{
+		Players: len(players),
+		Latency: time.Since(start),
+	}, nil
+}
+
+// A2SProbe queries the server's Steam query port; servers without one are skipped
+type A2SProbe struct{}
+
+func NewA2SProbe() *A2SProbe {
+	return &A2SProbe{}
+}
+
+func (p *A2SProbe) Name() string {
+	return "a2s"
+}
+
+func (p *A2SProbe) Probe(ctx context.Context, server *models.Server) (*ProbeResult, error) {
+	if server.QueryPort == nil {
+		return nil, fmt.Errorf("no query port configured")
+	}
+
+	info, err := a2s.NewClient(server.IPAddress, *server.QueryPort).Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProbeResult{
+		Players:    info.Players,
+		MaxPlayers: info.MaxPlayers,
+		Latency:    info.Ping,
+	}, nil
+}
+
+// ServerMonitor periodically probes every server, keeps IsOnline,
+// CurrentPlayers and LastPing up to date and records a status sample per poll.
+type ServerMonitor struct {
+	db     *gorm.DB
+	cfg    config.MonitorConfig
+	probes []ServerProbe
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewServerMonitor creates a monitor that tries probes in order until one
+// answers. Probes not named in cfg.Probes are left out.
+func NewServerMonitor(db *gorm.DB, cfg config.MonitorConfig, probes ...ServerProbe) *ServerMonitor {
+	available := make(map[string]ServerProbe, len(probes))
+	for _, probe := range probes {
+		available[probe.Name()] = probe
+	}
+
+	var enabled []ServerProbe
+	for _, name := range cfg.Probes {
+		if probe, ok := available[name]; ok {
+			enabled = append(enabled, probe)
+		} else {
+			log.Printf("Unknown server monitor probe %q ignored", name)
+		}
+	}
+
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	// time.NewTicker panics on a non-positive interval
+	if cfg.Interval <= 0 {
+		log.Printf("Server monitor interval %s is not positive, using %s", cfg.Interval, config.DefaultMonitorInterval)
+		cfg.Interval = config.DefaultMonitorInterval
+	}
+
+	return &ServerMonitor{
+		db:     db,
+		cfg:    cfg,
+		probes: enabled,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start begins polling in the background
+func (m *ServerMonitor) Start() {
+	if !m.cfg.Enabled || len(m.probes) == 0 {
+		log.Printf("Server monitoring disabled")
+		close(m.done)
+		return
+	}
+
+	go m.run()
+}
+
+// Stop ends polling and waits for the current poll to finish
+func (m *ServerMonitor) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+}
+
+func (m *ServerMonitor) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	m.PollAll(context.Background())
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.PollAll(context.Background())
+		}
+	}
+}
+
+// PollAll probes every server, at most cfg.Concurrency at a time
+func (m *ServerMonitor) PollAll(ctx context.Context) {
+	var servers []models.Server
+	if err := m.db.Find(&servers).Error; err != nil {
+		log.Printf("Server monitor failed to get servers: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, m.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for i := range servers {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(server *models.Server) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			m.poll(ctx, server)
+		}(&servers[i])
+	}
+
+	wg.Wait()
+}
+
+func (m *ServerMonitor) poll(ctx context.Context, server *models.Server) {
+	sample := models.ServerStatusSample{
+		ServerID:  server.ServerID,
+		SampledAt: time.Now(),
+	}
+
+	var lastErr error
+	for _, probe := range m.probes {
+		probeCtx, cancel := context.WithTimeout(ctx, m.cfg.ProbeTimeout)
+		result, err := probe.Probe(probeCtx, server)
+		cancel()
+
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", probe.Name(), err)
+			continue
+		}
+
+		name := probe.Name()
+		latency := int(result.Latency.Milliseconds())
+		sample.IsOnline = true
+		sample.PlayerCount = result.Players
+		sample.LatencyMs = &latency
+		sample.Probe = &name
+		if result.MaxPlayers > 0 {
+			sample.MaxPlayers = &result.MaxPlayers
+		}
+		break
+	}
+
+	if !sample.IsOnline && lastErr != nil {
+		message := lastErr.Error()
+		sample.ErrorMessage = &message
+	}
+
+	if err := m.db.Create(&sample).Error; err != nil {
+		log.Printf("Failed to record status of server %d: %v", server.ServerID, err)
+	}
+
+	updates := map[string]interface{}{
+		"is_online":       sample.IsOnline,
+		"current_players": sample.PlayerCount,
+	}
+	if sample.IsOnline {
+		updates["last_ping"] = sample.SampledAt
+	}
+	if sample.MaxPlayers != nil {
+		updates["max_players"] = *sample.MaxPlayers
+	}
+
+	if err := m.db.Model(&models.Server{}).
+		Where("server_id = ?", server.ServerID).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to update status of server %d: %v", server.ServerID, err)
+	}
+}
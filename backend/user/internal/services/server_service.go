@@ -9,25 +9,29 @@ import (
 	"sync"
 	"time"
 
+	"nexark-user-backend/internal/config"
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/a2s"
 	"nexark-user-backend/pkg/rcon"
 
 	"gorm.io/gorm"
 )
 
 type ServerService struct {
-	db          *gorm.DB
-	rconClients map[uint]*rcon.RCONClient
-	mutex       sync.RWMutex
+	db        *gorm.DB
+	rconCfg   config.RCONConfig
+	rconPools map[uint]*rcon.Pool
+	mutex     sync.RWMutex
 }
 
-func NewServerService(db *gorm.DB) *ServerService {
+func NewServerService(db *gorm.DB, rconCfg config.RCONConfig) *ServerService {
 	service := &ServerService{
-		db:          db,
-		rconClients: make(map[uint]*rcon.RCONClient),
+		db:        db,
+		rconCfg:   rconCfg,
+		rconPools: make(map[uint]*rcon.Pool),
 	}
 
-	// Server status monitoring disabled per requirements
+	// Server status is polled by ServerMonitor
 
 	return service
 }
@@ -45,7 +49,7 @@ func (s *ServerService) GetServers(ctx context.Context) ([]models.Server, error)
 func (s *ServerService) GetServerByID(ctx context.Context, serverID uint) (*models.Server, error) {
 	var server models.Server
 	err := s.db.Where("server_id = ?", serverID).
-		Select("server_id, server_name, server_type, ip_address, port, rcon_port, rcon_password, is_online, current_players, max_players, last_ping, details, details_i18n").
+		Select("server_id, server_name, server_type, ip_address, port, rcon_port, query_port, rcon_password, is_online, current_players, max_players, last_ping, details, details_i18n").
 		First(&server).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -130,62 +134,178 @@ func (s *ServerService) GetDisplayCategories(ctx context.Context) ([]models.Serv
 	return categories, nil
 }
 
+// RCON execution contexts recorded in the command history
+const (
+	RCONContextSystem  = "system"
+	RCONContextConsole = "admin_console"
+)
+
 func (s *ServerService) ExecuteRCONCommand(ctx context.Context, serverID uint, command string) (*rcon.RCONResponse, error) {
+	return s.executeRCON(ctx, serverID, command, &rconOrigin{context: RCONContextSystem})
+}
+
+// ExecuteRCONCommandAs runs command on behalf of a user and records it in the
+// command history with executionContext.
+func (s *ServerService) ExecuteRCONCommandAs(ctx context.Context, serverID uint, command string, userID uint, executionContext string) (*rcon.RCONResponse, error) {
+	return s.executeRCON(ctx, serverID, command, &rconOrigin{executedBy: &userID, context: executionContext})
+}
+
+// rconOrigin is who a command is recorded as executed by
+type rconOrigin struct {
+	executedBy *uint
+	context    string
+}
+
+// executeRCON runs command on a server. Commands without an origin, such as
+// read-only polling, skip the command history so it isn't flooded.
+func (s *ServerService) executeRCON(ctx context.Context, serverID uint, command string, origin *rconOrigin) (*rcon.RCONResponse, error) {
 	server, err := s.GetServerByID(ctx, serverID)
 	if err != nil {
 		return nil, err
 	}
 
-	rconClient, err := s.getRCONClient(server)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get RCON client: %w", err)
-	}
+	pool := s.getRCONPool(server)
 
-	response, err := rconClient.ExecuteCommand(command)
+	response, err := pool.Execute(ctx, command)
 	if err != nil {
+		if origin != nil {
+			s.logRCONCommand(serverID, command, &rcon.RCONResponse{Error: err.Error()}, origin)
+		}
 		return nil, fmt.Errorf("failed to execute RCON command: %w", err)
 	}
 
 	// Log command execution
-	s.logRCONCommand(serverID, command, response, "system")
+	if origin != nil {
+		s.logRCONCommand(serverID, command, response, origin)
+	}
 
 	return response, nil
 }
 
-func (s *ServerService) getRCONClient(server *models.Server) (*rcon.RCONClient, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// ListPlayers returns the players currently connected to a server
+func (s *ServerService) ListPlayers(ctx context.Context, serverID uint) ([]rcon.Player, error) {
+	response, err := s.executeRCON(ctx, serverID, "ListPlayers", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		return nil, fmt.Errorf("ListPlayers failed: %s", response.Error)
+	}
+
+	return rcon.ParseListPlayers(response.Response), nil
+}
+
+// ServerQueryResult is the public state of a server as reported by A2S
+type ServerQueryResult struct {
+	Info    *a2s.Info         `json:"info"`
+	Players []a2s.Player      `json:"players"`
+	Rules   map[string]string `json:"rules,omitempty"`
+	PingMs  int64             `json:"ping_ms"`
+}
+
+// QueryServer asks a server for its map, version, players and ping over the
+// Steam query protocol, which needs no RCON credentials.
+func (s *ServerService) QueryServer(ctx context.Context, server *models.Server, includeRules bool) (*ServerQueryResult, error) {
+	if server.QueryPort == nil {
+		return nil, fmt.Errorf("server has no query port")
+	}
 
-	client, exists := s.rconClients[server.ServerID]
-	if !exists || !client.IsConnected() {
-		client = rcon.NewRCONClient(
-			server.IPAddress,
-			fmt.Sprintf("%d", server.RCONPort),
-			server.RCONPassword,
-		)
+	client := a2s.NewClient(server.IPAddress, *server.QueryPort)
 
-		if err := client.Connect(); err != nil {
-			return nil, fmt.Errorf("failed to connect to RCON: %w", err)
+	info, err := client.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server info: %w", err)
+	}
+
+	result := &ServerQueryResult{
+		Info:   info,
+		PingMs: info.Ping.Milliseconds(),
+	}
+
+	// The player list and rules are extras; the info alone is still useful
+	if players, err := client.Players(ctx); err == nil {
+		result.Players = players
+	} else {
+		log.Printf("Failed to query players of server %d: %v", server.ServerID, err)
+	}
+
+	if includeRules {
+		if rules, err := client.Rules(ctx); err == nil {
+			result.Rules = rules
+		} else {
+			log.Printf("Failed to query rules of server %d: %v", server.ServerID, err)
 		}
+	}
+
+	return result, nil
+}
 
-		s.rconClients[server.ServerID] = client
+// getRCONPool returns the connection pool of a server, replacing it when the
+// server's RCON address or password changed.
+func (s *ServerService) getRCONPool(server *models.Server) *rcon.Pool {
+	cfg := rcon.PoolConfig{
+		Host:              server.IPAddress,
+		Port:              fmt.Sprintf("%d", server.RCONPort),
+		Password:          server.RCONPassword,
+		MaxConns:          s.rconCfg.MaxConnsPerServer,
+		CommandTimeout:    s.rconCfg.CommandTimeout,
+		KeepAliveInterval: s.rconCfg.KeepAliveInterval,
+		IdleTimeout:       s.rconCfg.IdleTimeout,
 	}
 
-	return client, nil
+	s.mutex.RLock()
+	pool, exists := s.rconPools[server.ServerID]
+	s.mutex.RUnlock()
+	if exists && pool.Config() == cfg {
+		return pool
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if pool, exists := s.rconPools[server.ServerID]; exists {
+		if pool.Config() == cfg {
+			return pool
+		}
+		go pool.Close()
+	}
+
+	pool = rcon.NewPool(cfg)
+	s.rconPools[server.ServerID] = pool
+	return pool
+}
+
+// RCONPoolStats returns connection pool usage per server ID
+func (s *ServerService) RCONPoolStats() map[uint]rcon.PoolStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := make(map[uint]rcon.PoolStats, len(s.rconPools))
+	for serverID, pool := range s.rconPools {
+		stats[serverID] = pool.Stats()
+	}
+	return stats
 }
 
-func (s *ServerService) logRCONCommand(serverID uint, command string, response *rcon.RCONResponse, context string) {
+func (s *ServerService) logRCONCommand(serverID uint, command string, response *rcon.RCONResponse, origin *rconOrigin) {
 	status := "success"
 	if !response.Success {
 		status = "failed"
 	}
 
+	output := response.Response
+	if output == "" && response.Error != "" {
+		output = response.Error
+	}
+
 	commandLog := models.RCONCommandHistory{
 		ServerID:         serverID,
 		Command:          command,
-		Response:         &response.Response,
+		Response:         &output,
 		Status:           status,
-		ExecutionContext: context,
+		ExecutedBy:       origin.executedBy,
+		ExecutionContext: origin.context,
 		ExecutedAt:       time.Now(),
 	}
 
@@ -194,20 +314,11 @@ func (s *ServerService) logRCONCommand(serverID uint, command string, response *
 	}
 }
 
-/*
-Server status monitoring code removed per requirements:
-- startServerMonitoring
-- monitorServers
-- checkServerStatus
-- parsePlayerCount
-- updateServerStatus
-*/
-
 func (s *ServerService) CloseConnections() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for _, client := range s.rconClients {
-		client.Close()
+	for _, pool := range s.rconPools {
+		pool.Close()
 	}
 }
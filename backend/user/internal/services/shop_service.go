@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/steam"
 
 	"github.com/google/uuid"
 
@@ -13,11 +14,21 @@ import (
 )
 
 type ShopService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	deliveryService *DeliveryService
+	pricingService  *PricingService
+	couponService   *CouponService
+	ledgerService   *LedgerService
 }
 
-func NewShopService(db *gorm.DB) *ShopService {
-	return &ShopService{db: db}
+func NewShopService(db *gorm.DB, deliveryService *DeliveryService, pricingService *PricingService, couponService *CouponService, ledgerService *LedgerService) *ShopService {
+	return &ShopService{
+		db:              db,
+		deliveryService: deliveryService,
+		pricingService:  pricingService,
+		couponService:   couponService,
+		ledgerService:   ledgerService,
+	}
 }
 
 func (s *ShopService) GetCategories(ctx context.Context) ([]models.ItemCategory, error) {
@@ -33,11 +44,17 @@ func (s *ShopService) GetCategories(ctx context.Context) ([]models.ItemCategory,
 	return categories, nil
 }
 
-func (s *ShopService) GetItemsByCategory(ctx context.Context, categoryID uint, limit, offset int) ([]models.Item, int64, error) {
+// GetItemsByCategory lists the active items of a category with any running
+// sale price. A non-zero serverID only returns items sold on that server,
+// priced for it.
+func (s *ShopService) GetItemsByCategory(ctx context.Context, categoryID uint, serverID uint, limit, offset int) ([]models.Item, int64, error) {
 	var items []models.Item
 	var total int64
 
 	query := s.db.Model(&models.Item{}).Where("category_id = ? AND is_active = ?", categoryID, true)
+	if serverID != 0 {
+		query = query.Scopes(AvailableOnServer(serverID))
+	}
 
 	// Get total count
 	if err := query.Count(&total).Error; err != nil {
@@ -55,14 +72,23 @@ func (s *ShopService) GetItemsByCategory(ctx context.Context, categoryID uint, l
 		return nil, 0, fmt.Errorf("failed to get items: %w", err)
 	}
 
+	if err := s.pricingService.ApplyPrices(ctx, items, serverID); err != nil {
+		return nil, 0, err
+	}
+
 	return items, total, nil
 }
 
-func (s *ShopService) GetAllItems(ctx context.Context, limit, offset int, featured bool) ([]models.Item, int64, error) {
+// GetAllItems lists active items with any running sale price. A non-zero
+// serverID only returns items sold on that server, priced for it.
+func (s *ShopService) GetAllItems(ctx context.Context, serverID uint, limit, offset int, featured bool) ([]models.Item, int64, error) {
 	var items []models.Item
 	var total int64
 
 	query := s.db.Model(&models.Item{}).Where("is_active = ?", true)
+	if serverID != 0 {
+		query = query.Scopes(AvailableOnServer(serverID))
+	}
 
 	if featured {
 		query = query.Where("is_featured = ?", true)
@@ -84,10 +110,16 @@ func (s *ShopService) GetAllItems(ctx context.Context, limit, offset int, featur
 		return nil, 0, fmt.Errorf("failed to get items: %w", err)
 	}
 
+	if err := s.pricingService.ApplyPrices(ctx, items, serverID); err != nil {
+		return nil, 0, err
+	}
+
 	return items, total, nil
 }
 
-func (s *ShopService) GetItemByID(ctx context.Context, itemID uint) (*models.Item, error) {
+// GetItemByID returns an active item. With a non-zero serverID the item must be
+// sold on that server and is priced for it.
+func (s *ShopService) GetItemByID(ctx context.Context, itemID uint, serverID uint) (*models.Item, error) {
 	var item models.Item
 	err := s.db.Where("item_id = ? AND is_active = ?", itemID, true).
 		Preload("Category").
@@ -100,99 +132,70 @@ func (s *ShopService) GetItemByID(ctx context.Context, itemID uint) (*models.Ite
 		return nil, fmt.Errorf("failed to get item: %w", err)
 	}
 
-	return &item, nil
-}
-
-// BuyItem processes item purchase for a user
-func (s *ShopService) BuyItem(ctx context.Context, userID, itemID uint, serverID *uint) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Get the item
-		var item models.Item
-		if err := tx.Where("item_id = ? AND is_active = ?", itemID, true).First(&item).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return fmt.Errorf("item not found")
-			}
-			return fmt.Errorf("failed to get item: %w", err)
-		}
-
-		// Check stock if limited (-1 means unlimited)
-		if item.StockQuantity != -1 && item.StockQuantity < 1 {
-			return fmt.Errorf("item out of stock")
-		}
-
-		// Get user to check credits
-		var user models.User
-		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
-		}
-
-		// Check if user has enough credits
-		if user.CreditBalance < item.Price {
-			return fmt.Errorf("insufficient credits: required=%.2f, available=%.2f", item.Price, user.CreditBalance)
+	if serverID != 0 {
+		offer, err := s.pricingService.ResolveOffer(s.db, &item, serverID)
+		if err != nil {
+			return nil, err
 		}
-
-		// Get balance before transaction
-		balanceBefore := user.CreditBalance
-
-		// Deduct credits from user
-		if err := tx.Model(&user).Update("credit_balance", gorm.Expr("credit_balance - ?", item.Price)).Error; err != nil {
-			return fmt.Errorf("failed to deduct credits: %w", err)
-		}
-
-		// Update stock if limited
-		if item.StockQuantity > 0 {
-			if err := tx.Model(&item).Update("stock_quantity", gorm.Expr("stock_quantity - 1")).Error; err != nil {
-				return fmt.Errorf("failed to update stock: %w", err)
-			}
+		if !offer.Available {
+			return nil, fmt.Errorf("item is not available on this server")
 		}
+		item.Price = offer.OriginalPrice
+	}
 
-		// Create credit transaction record
-		description := fmt.Sprintf("Purchased %s", item.ItemName)
-		creditTransaction := models.CreditTransaction{
-			UserID:          userID,
-			Amount:          -item.Price, // Negative for deduction
-			TransactionType: "purchase",
-			Description:     &description,
-			BalanceBefore:   balanceBefore,
-			BalanceAfter:    balanceBefore - item.Price,
-		}
-		if err := tx.Create(&creditTransaction).Error; err != nil {
-			return fmt.Errorf("failed to create credit transaction: %w", err)
-		}
+	// Add any running sale on top of the server price
+	items := []models.Item{item}
+	if err := s.pricingService.ApplyPrices(ctx, items, 0); err != nil {
+		return nil, err
+	}
 
-		// Create item transaction record for RCON processing
-		actualServerID := uint(1) // Default server
-		if serverID != nil {
-			actualServerID = *serverID
-		}
+	return &items[0], nil
+}
 
-		transaction := models.Transaction{
-			TransactionUUID: uuid.New().String(),
-			UserID:          userID,
-			ItemID:          itemID,
-			ServerID:        actualServerID,
-			Amount:          item.Price,
-			Quantity:        1,
-			Status:          "pending", // Will be updated when RCON is executed
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			return fmt.Errorf("failed to create transaction: %w", err)
-		}
+// BuyItem processes item purchase for a user, with an optional coupon code
+func (s *ShopService) BuyItem(ctx context.Context, userID, itemID uint, serverID *uint, couponCode string) (*models.Transaction, error) {
+	return s.purchaseSingleItem(ctx, singleItemPurchase{
+		buyerID:    userID,
+		itemID:     itemID,
+		serverID:   serverID,
+		couponCode: couponCode,
+	})
+}
 
-		// TODO: Execute RCON command on server
-		// This would require integration with server service to execute the RCON command
-		// For now, we'll just complete the purchase
+// GiftItem processes item gift from one user to another
+func (s *ShopService) GiftItem(ctx context.Context, senderID, itemID uint, recipientSteamID string, serverID *uint, couponCode string) (*models.Transaction, error) {
+	// Validate recipient Steam ID format; it ends up inside an RCON command
+	recipientSteamID = strings.TrimSpace(recipientSteamID)
+	if !steam.IsValidSteamID(recipientSteamID) {
+		return nil, fmt.Errorf("invalid recipient Steam ID")
+	}
 
-		return nil
+	return s.purchaseSingleItem(ctx, singleItemPurchase{
+		buyerID:          senderID,
+		itemID:           itemID,
+		serverID:         serverID,
+		recipientSteamID: &recipientSteamID,
+		couponCode:       couponCode,
 	})
 }
 
-// GiftItem processes item gift from one user to another
-func (s *ShopService) GiftItem(ctx context.Context, senderID, itemID uint, recipientSteamID string, serverID *uint) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+type singleItemPurchase struct {
+	buyerID          uint
+	itemID           uint
+	serverID         *uint
+	recipientSteamID *string
+	couponCode       string
+}
+
+// purchaseSingleItem charges the buyer for one unit of an item and queues its
+// delivery through the same pipeline as TransactionService purchases.
+func (s *ShopService) purchaseSingleItem(ctx context.Context, p singleItemPurchase) (*models.Transaction, error) {
+	var transaction models.Transaction
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// Get the item
 		var item models.Item
-		if err := tx.Where("item_id = ? AND is_active = ?", itemID, true).First(&item).Error; err != nil {
+		if err := tx.Where("item_id = ? AND is_active = ?", p.itemID, true).First(&item).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return fmt.Errorf("item not found")
 			}
@@ -204,75 +207,111 @@ func (s *ShopService) GiftItem(ctx context.Context, senderID, itemID uint, recip
 			return fmt.Errorf("item out of stock")
 		}
 
-		// Get sender to check credits
-		var sender models.User
-		if err := tx.Where("user_id = ?", senderID).First(&sender).Error; err != nil {
-			return fmt.Errorf("failed to get sender: %w", err)
+		// Resolve the target server
+		actualServerID := uint(1) // Default server
+		if p.serverID != nil {
+			actualServerID = *p.serverID
 		}
 
-		// Check if sender has enough credits
-		if sender.CreditBalance < item.Price {
-			return fmt.Errorf("insufficient credits: required=%.2f, available=%.2f", item.Price, sender.CreditBalance)
+		var server models.Server
+		if err := tx.Select("server_id").Where("server_id = ?", actualServerID).First(&server).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("server not found")
+			}
+			return fmt.Errorf("failed to get server: %w", err)
 		}
 
-		// Validate recipient Steam ID format
-		recipientSteamID = strings.TrimSpace(recipientSteamID)
-		if len(recipientSteamID) == 0 {
-			return fmt.Errorf("invalid recipient Steam ID")
+		// Resolve availability and price on that server
+		offer, err := s.pricingService.ResolveOffer(tx, &item, actualServerID)
+		if err != nil {
+			return err
+		}
+		if !offer.Available {
+			return fmt.Errorf("item is not available on this server")
 		}
 
-		// Get balance before transaction
-		balanceBefore := sender.CreditBalance
+		// Apply the coupon, if any
+		price := offer.Price
+		var coupon *CouponApplication
+		if p.couponCode != "" {
+			coupon, err = s.couponService.ApplyCoupon(tx, p.couponCode, p.buyerID, []CouponLine{{
+				ItemID:     item.ItemID,
+				CategoryID: item.CategoryID,
+				ServerID:   actualServerID,
+				Amount:     offer.Price,
+			}})
+			if err != nil {
+				return err
+			}
+			price -= coupon.Total
+		}
 
-		// Deduct credits from sender
-		if err := tx.Model(&sender).Update("credit_balance", gorm.Expr("credit_balance - ?", item.Price)).Error; err != nil {
-			return fmt.Errorf("failed to deduct credits: %w", err)
+		// Create item transaction record for RCON processing
+		transaction = models.Transaction{
+			TransactionUUID:  uuid.New().String(),
+			UserID:           p.buyerID,
+			ItemID:           p.itemID,
+			ServerID:         actualServerID,
+			RecipientSteamID: p.recipientSteamID,
+			Amount:           price,
+			Quantity:         1,
+			Status:           "pending", // Updated by the delivery job
+		}
+		if coupon != nil {
+			transaction.DiscountAmount = coupon.Total
+			transaction.CouponID = &coupon.Coupon.CouponID
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
 		}
 
 		// Update stock if limited
-		if item.StockQuantity > 0 {
-			if err := tx.Model(&item).Update("stock_quantity", gorm.Expr("stock_quantity - 1")).Error; err != nil {
-				return fmt.Errorf("failed to update stock: %w", err)
+		if item.StockQuantity != -1 {
+			taken, err := takeStock(tx, item.ItemID, 1)
+			if err != nil {
+				return err
+			}
+			if !taken {
+				return fmt.Errorf("item out of stock")
 			}
 		}
 
 		// Create credit transaction record
-		description := fmt.Sprintf("Gifted %s to Steam ID: %s", item.ItemName, recipientSteamID)
-		creditTransaction := models.CreditTransaction{
-			UserID:          senderID,
-			Amount:          -item.Price, // Negative for deduction
-			TransactionType: "gift",
-			Description:     &description,
-			BalanceBefore:   balanceBefore,
-			BalanceAfter:    balanceBefore - item.Price,
-		}
-		if err := tx.Create(&creditTransaction).Error; err != nil {
-			return fmt.Errorf("failed to create credit transaction: %w", err)
+		transactionType := "purchase"
+		description := fmt.Sprintf("Purchased %s", item.ItemName)
+		if p.recipientSteamID != nil {
+			transactionType = "gift"
+			description = fmt.Sprintf("Gifted %s to Steam ID: %s", item.ItemName, *p.recipientSteamID)
 		}
 
-		// Create item transaction record for RCON processing
-		actualServerID := uint(1) // Default server
-		if serverID != nil {
-			actualServerID = *serverID
+		// Deduct credits from buyer; fails when the balance is too low
+		debit := LedgerEntry{
+			UserID:               p.buyerID,
+			Amount:               -price, // Negative for deduction
+			TransactionType:      transactionType,
+			Description:          description,
+			RelatedTransactionID: &transaction.TransactionID,
 		}
+		if coupon != nil {
+			debit.DiscountAmount = coupon.Total
+			debit.CouponID = &coupon.Coupon.CouponID
 
-		transaction := models.Transaction{
-			TransactionUUID: uuid.New().String(),
-			UserID:          senderID,
-			ItemID:          itemID,
-			ServerID:        actualServerID,
-			Amount:          item.Price,
-			Quantity:        1,
-			Status:          "pending", // Will be updated when RCON is executed
+			if err := s.couponService.Redeem(tx, coupon, p.buyerID, []*models.Transaction{&transaction}); err != nil {
+				return err
+			}
 		}
-		if err := tx.Create(&transaction).Error; err != nil {
-			return fmt.Errorf("failed to create transaction: %w", err)
+		if _, err := s.ledgerService.PostTx(tx, debit); err != nil {
+			return err
 		}
 
-		// TODO: Execute RCON command on server for recipient
-		// This would require integration with server service to execute the RCON command
-		// The RCON command would need to be modified to target the recipient Steam ID
-
-		return nil
+		// Queue RCON delivery together with the purchase
+		return s.deliveryService.EnqueueDeliveries(ctx, tx, []*models.Transaction{&transaction})
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.deliveryService.Dispatch()
+
+	return &transaction, nil
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"gorm.io/gorm"
 )
@@ -155,7 +156,7 @@ func (s *SpinWheelService) performSpin(ctx context.Context, userID uint) (*SpinR
 		}
 
 		// Award the reward
-		err = s.awardSpinReward(ctx, userID, selectedReward)
+		err = s.awardSpinReward(ctx, tx, userID, selectedReward)
 		if err != nil {
 			return fmt.Errorf("failed to award reward: %w", err)
 		}
@@ -217,20 +218,21 @@ func (s *SpinWheelService) selectRandomReward(rewards []models.SpinWheelConfig)
 	return &rewards[len(rewards)-1], nil
 }
 
-func (s *SpinWheelService) awardSpinReward(ctx context.Context, userID uint, reward *models.SpinWheelConfig) error {
+func (s *SpinWheelService) awardSpinReward(ctx context.Context, tx *gorm.DB, userID uint, reward *models.SpinWheelConfig) error {
 	switch reward.RewardType {
 	case "credits":
-		amount, err := strconv.ParseFloat(reward.RewardValue, 64)
+		amount, err := money.Parse(reward.RewardValue)
 		if err != nil {
 			return fmt.Errorf("invalid credit amount: %w", err)
 		}
 
 		// Award credits directly (bypass payment system for rewards)
-		err = s.creditService.userService.UpdateCreditBalance(
-			ctx, userID, amount, "spin_wheel_reward",
-			fmt.Sprintf("Spin wheel reward: %.2f credits", amount),
-			nil, nil,
-		)
+		_, err = s.creditService.ledgerService.PostTx(tx, LedgerEntry{
+			UserID:          userID,
+			Amount:          amount,
+			TransactionType: "spin_wheel_reward",
+			Description:     fmt.Sprintf("Spin wheel reward: %s credits", amount),
+		})
 		if err != nil {
 			return fmt.Errorf("failed to award credits: %w", err)
 		}
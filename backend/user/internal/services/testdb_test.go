@@ -0,0 +1,366 @@
+package services
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexark-user-backend/internal/config"
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/database"
+	"nexark-user-backend/pkg/money"
+	"nexark-user-backend/pkg/rcon/rcontest"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDSNEnv names a MySQL DSN without a database, e.g.
+// "root:secret@tcp(127.0.0.1:3306)/". When set, each test gets a fresh
+// database built by the real migrations, so row locks are exercised as in
+// production. Otherwise tests use SQLite, where transactions are serialised.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+// testModels is the schema created for SQLite test databases
+var testModels = []interface{}{
+	&models.User{},
+	&models.Payment{},
+	&models.CreditTransaction{},
+	&models.ItemCategory{},
+	&models.Item{},
+	&models.ItemDeliveryStep{},
+	&models.ItemServerAvailability{},
+	&models.Server{},
+	&models.Transaction{},
+	&models.TransactionDeliveryStep{},
+	&models.ShoppingCart{},
+	&models.Coupon{},
+	&models.CouponRedemption{},
+	&models.FlashSale{},
+	&models.FlashSaleTarget{},
+	&models.Job{},
+	&models.RCONCommandHistory{},
+}
+
+var registerSQLiteFunctions sync.Once
+
+// openTestDB returns an empty database with the application schema that is
+// dropped when the test ends
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if dsn := os.Getenv(testDSNEnv); dsn != "" {
+		return openMySQLTestDB(t, dsn)
+	}
+	return openSQLiteTestDB(t)
+}
+
+func openSQLiteTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	// MySQL functions used by the services
+	registerSQLiteFunctions.Do(func() {
+		err := gosqlite.RegisterDeterministicScalarFunction("greatest", -1,
+			func(ctx *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				var greatest int64
+				for i, arg := range args {
+					value, ok := arg.(int64)
+					if !ok {
+						return nil, fmt.Errorf("greatest: unsupported argument %T", arg)
+					}
+					if i == 0 || value > greatest {
+						greatest = value
+					}
+				}
+				return greatest, nil
+			})
+		if err != nil {
+			t.Fatalf("failed to register greatest: %v", err)
+		}
+	})
+
+	// A file rather than :memory: so every pooled connection sees the same
+	// data; _txlock=immediate takes the write lock at BEGIN, which stands in
+	// for SELECT ... FOR UPDATE
+	path := filepath.Join(t.TempDir(), "test.db")
+	dsn := path + "?_txlock=immediate&_pragma=busy_timeout(30000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+		// The models' relations don't all map to the real foreign keys
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	closeOnCleanup(t, db)
+
+	if err := db.AutoMigrate(testModels...); err != nil {
+		t.Fatalf("failed to create test schema: %v", err)
+	}
+	return db
+}
+
+func openMySQLTestDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", testDSNEnv, err)
+	}
+	cfg.ParseTime = true
+
+	admin, err := gorm.Open(mysql.Open(cfg.FormatDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database server: %v", err)
+	}
+	closeOnCleanup(t, admin)
+
+	name := fmt.Sprintf("nexark_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE " + name)
+	})
+
+	cfg.DBName = name
+	db, err := gorm.Open(mysql.Open(cfg.FormatDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	closeOnCleanup(t, db)
+
+	if err := database.RunMigrations(db, filepath.Join("..", "..", "migrations")); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func closeOnCleanup(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+}
+
+// createTestUser adds a user and funds them through the ledger, so their
+// balance matches their credit_transactions from the start
+func createTestUser(t *testing.T, db *gorm.DB, ledger *LedgerService, steamID string, balance money.Amount) *models.User {
+	t.Helper()
+
+	user := models.User{
+		SteamID:     steamID,
+		Username:    "player_" + steamID[len(steamID)-4:],
+		DisplayName: "Player " + steamID[len(steamID)-4:],
+		IsActive:    true,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if balance > 0 {
+		if _, err := ledger.PostTx(db, LedgerEntry{
+			UserID:          user.UserID,
+			Amount:          balance,
+			TransactionType: "topup",
+			Description:     "Test funds",
+		}); err != nil {
+			t.Fatalf("failed to fund user: %v", err)
+		}
+		user.CreditBalance = balance
+	}
+
+	return &user
+}
+
+// assertLedgerConsistent fails the test if any balance is negative or differs
+// from the sum of that user's credit_transactions
+func assertLedgerConsistent(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	var rows []struct {
+		UserID        uint
+		CreditBalance money.Amount
+		LedgerTotal   money.Amount
+	}
+	err := db.Table("users").
+		Select("users.user_id, users.credit_balance, COALESCE(SUM(credit_transactions.amount), 0) AS ledger_total").
+		Joins("LEFT JOIN credit_transactions ON credit_transactions.user_id = users.user_id").
+		Group("users.user_id, users.credit_balance").
+		Scan(&rows).Error
+	if err != nil {
+		t.Fatalf("failed to sum ledger: %v", err)
+	}
+
+	for _, row := range rows {
+		if row.CreditBalance < 0 {
+			t.Errorf("user %d has a negative balance of %s", row.UserID, row.CreditBalance)
+		}
+		if row.CreditBalance != row.LedgerTotal {
+			t.Errorf("user %d has a balance of %s but credit_transactions sum to %s",
+				row.UserID, row.CreditBalance, row.LedgerTotal)
+		}
+	}
+}
+
+// isInsufficientCredits reports whether err is the ledger's refusal to take a
+// balance below zero
+func isInsufficientCredits(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "insufficient credits")
+}
+
+// testShop wires the services a purchase and its delivery go through, with
+// the game server played by an in-process RCON server
+type testShop struct {
+	db           *gorm.DB
+	ledger       *LedgerService
+	credits      *CreditService
+	jobs         *JobService
+	delivery     *DeliveryService
+	transactions *TransactionService
+	shop         *ShopService
+	cart         *CartService
+	rcon         *rcontest.Server
+	server       *models.Server
+	category     *models.ItemCategory
+}
+
+// testDeliveryConfig retries quickly and doesn't wait for players unless a
+// test asks for it
+var testDeliveryConfig = config.DeliveryConfig{
+	MaxAttempts:         3,
+	BaseRetryDelay:      time.Millisecond,
+	MaxRetryDelay:       time.Millisecond,
+	PlayerCheckInterval: time.Millisecond,
+	AwaitPlayerTimeout:  time.Hour,
+}
+
+func newTestShop(t *testing.T, deliveryCfg config.DeliveryConfig) *testShop {
+	t.Helper()
+
+	db := openTestDB(t)
+	rconServer := rcontest.NewServer("secret")
+	t.Cleanup(rconServer.Close)
+
+	port, err := strconv.Atoi(rconServer.Port())
+	if err != nil {
+		t.Fatalf("invalid rcontest port: %v", err)
+	}
+	server := models.Server{
+		ServerName:   "Test Island",
+		ServerType:   "pve",
+		IPAddress:    rconServer.Host(),
+		Port:         7777,
+		RCONPort:     port,
+		RCONPassword: "secret",
+		IsOnline:     true,
+	}
+	if err := db.Create(&server).Error; err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	category := models.ItemCategory{CategoryName: "Resources", IsActive: true}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	serverService := NewServerService(db, config.RCONConfig{
+		MaxConnsPerServer: 2,
+		CommandTimeout:    5 * time.Second,
+	})
+	t.Cleanup(serverService.CloseConnections)
+
+	ledger := NewLedgerService(db)
+	userService := NewUserService(db, nil, nil)
+	jobs := NewJobService(db)
+	pricing := NewPricingService(db)
+	coupons := NewCouponService(db, pricing)
+	refunds := NewRefundService(db, ledger, coupons)
+	delivery := NewDeliveryService(db, serverService, jobs, refunds, pricing, deliveryCfg)
+	transactions := NewTransactionService(db, serverService, ledger, delivery, refunds, pricing, coupons)
+
+	return &testShop{
+		db:           db,
+		ledger:       ledger,
+		credits:      NewCreditService(db, userService, nil, ledger),
+		jobs:         jobs,
+		delivery:     delivery,
+		transactions: transactions,
+		shop:         NewShopService(db, delivery, pricing, coupons, ledger),
+		cart:         NewCartService(db, pricing, transactions),
+		rcon:         rconServer,
+		server:       &server,
+		category:     &category,
+	}
+}
+
+// createServer adds another game server answered by the same RCON server
+func (s *testShop) createServer(t *testing.T, name string) *models.Server {
+	t.Helper()
+
+	server := *s.server
+	server.ServerID = 0
+	server.ServerName = name
+	if err := s.db.Create(&server).Error; err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return &server
+}
+
+// createItem adds an item with unlimited stock delivered by command
+func (s *testShop) createItem(t *testing.T, code string, price money.Amount, command string) *models.Item {
+	t.Helper()
+
+	item := models.Item{
+		CategoryID:    s.category.CategoryID,
+		ItemName:      code,
+		ItemNameEN:    code,
+		ItemNameTH:    code,
+		ItemCode:      code,
+		Price:         price,
+		RCONCommand:   command,
+		StockQuantity: -1,
+		IsActive:      true,
+	}
+	if err := s.db.Create(&item).Error; err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	return &item
+}
+
+// waitForJobs waits for the background job processor to finish every queued
+// job, so none is left running against a closed database
+func (s *testShop) waitForJobs(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var open int64
+		if err := s.db.Model(&models.Job{}).
+			Where("status IN ?", []models.JobStatus{models.JobStatusPending, models.JobStatusProcessing}).
+			Count(&open).Error; err != nil {
+			t.Fatalf("failed to count jobs: %v", err)
+		}
+		if open == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d jobs still queued", open)
+		}
+		s.jobs.Wake()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
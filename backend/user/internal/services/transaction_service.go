@@ -3,30 +3,39 @@ package services
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type TransactionService struct {
-	db            *gorm.DB
-	serverService *ServerService
-	userService   *UserService
+	db              *gorm.DB
+	serverService   *ServerService
+	ledgerService   *LedgerService
+	deliveryService *DeliveryService
+	refundService   *RefundService
+	pricingService  *PricingService
+	couponService   *CouponService
 }
 
-func NewTransactionService(db *gorm.DB, serverService *ServerService, userService *UserService) *TransactionService {
+func NewTransactionService(db *gorm.DB, serverService *ServerService, ledgerService *LedgerService, deliveryService *DeliveryService, refundService *RefundService, pricingService *PricingService, couponService *CouponService) *TransactionService {
 	return &TransactionService{
-		db:            db,
-		serverService: serverService,
-		userService:   userService,
+		db:              db,
+		serverService:   serverService,
+		ledgerService:   ledgerService,
+		deliveryService: deliveryService,
+		refundService:   refundService,
+		pricingService:  pricingService,
+		couponService:   couponService,
 	}
 }
 
 type PurchaseRequest struct {
-	Items []PurchaseItem `json:"items" binding:"required"`
+	Items      []PurchaseItem `json:"items" binding:"required"`
+	CouponCode string         `json:"coupon_code"`
 }
 
 type PurchaseItem struct {
@@ -38,7 +47,8 @@ type PurchaseItem struct {
 type PurchaseResponse struct {
 	TransactionID string                    `json:"transaction_id"`
 	Status        string                    `json:"status"`
-	TotalAmount   float64                   `json:"total_amount"`
+	TotalAmount   money.Amount              `json:"total_amount"`
+	Discount      money.Amount              `json:"discount"`
 	Items         []TransactionItemResponse `json:"items"`
 	Message       string                    `json:"message"`
 }
@@ -52,31 +62,41 @@ type TransactionItemResponse struct {
 
 func (s *TransactionService) ProcessPurchase(ctx context.Context, userID uint, req PurchaseRequest) (*PurchaseResponse, error) {
 	// Start database transaction
-	return s.processPurchaseTransaction(ctx, userID, req)
+	return s.processPurchaseTransaction(ctx, userID, req, nil)
 }
 
-func (s *TransactionService) processPurchaseTransaction(ctx context.Context, userID uint, req PurchaseRequest) (*PurchaseResponse, error) {
-	var totalAmount float64
+// processPurchaseTransaction charges for and queues the delivery of every item
+// in req. beforeCommit, when set, runs last inside the same database
+// transaction with the created transactions, and rolls the purchase back if
+// it fails.
+func (s *TransactionService) processPurchaseTransaction(ctx context.Context, userID uint, req PurchaseRequest, beforeCommit func(tx *gorm.DB, transactions []*models.Transaction) error) (*PurchaseResponse, error) {
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("no items to purchase")
+	}
+
+	var totalAmount, discountAmount money.Amount
 	var transactions []*models.Transaction
 
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// Get user and check balance
-		user, err := s.userService.GetUserByID(ctx, userID)
-		if err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
+		// The same item may be bought for several servers, so stock is
+		// checked against its total quantity
+		quantities := make(map[uint]int)
+		for _, purchaseItem := range req.Items {
+			quantities[purchaseItem.ItemID] += purchaseItem.Quantity
 		}
 
-		// Process each item
-		for _, purchaseItem := range req.Items {
-			// Get item details
-			var item models.Item
+		// Resolve each item, its price on the chosen server and its stock
+		items := make([]models.Item, len(req.Items))
+		lines := make([]CouponLine, len(req.Items))
+		for i, purchaseItem := range req.Items {
+			item := &items[i]
 			if err := tx.Where("item_id = ? AND is_active = ?", purchaseItem.ItemID, true).
-				Preload("Category").First(&item).Error; err != nil {
+				Preload("Category").First(item).Error; err != nil {
 				return fmt.Errorf("item %d not found or inactive", purchaseItem.ItemID)
 			}
 
 			// Check stock
-			if item.StockQuantity != -1 && item.StockQuantity < purchaseItem.Quantity {
+			if item.StockQuantity != -1 && item.StockQuantity < quantities[item.ItemID] {
 				return fmt.Errorf("insufficient stock for item %s", item.ItemName)
 			}
 
@@ -86,56 +106,109 @@ func (s *TransactionService) processPurchaseTransaction(ctx context.Context, use
 				return fmt.Errorf("server %d not found", purchaseItem.ServerID)
 			}
 
-			// Calculate item total
-			itemTotal := item.Price * float64(purchaseItem.Quantity)
-			totalAmount += itemTotal
+			// Resolve availability and price on that server
+			offer, err := s.pricingService.ResolveOffer(tx, item, purchaseItem.ServerID)
+			if err != nil {
+				return err
+			}
+			if !offer.Available {
+				return fmt.Errorf("item %s is not available on server %d", item.ItemName, purchaseItem.ServerID)
+			}
+
+			lines[i] = CouponLine{
+				ItemID:     item.ItemID,
+				CategoryID: item.CategoryID,
+				ServerID:   purchaseItem.ServerID,
+				Amount:     offer.Price.Mul(purchaseItem.Quantity),
+			}
+		}
 
-			// Create transaction record
+		// Apply the coupon, if any, across the lines it covers
+		var coupon *CouponApplication
+		if req.CouponCode != "" {
+			var err error
+			coupon, err = s.couponService.ApplyCoupon(tx, req.CouponCode, userID, lines)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, purchaseItem := range req.Items {
+			// Calculate item total
+			itemTotal := lines[i].Amount
 			transaction := &models.Transaction{
 				TransactionUUID: uuid.New().String(),
 				UserID:          userID,
 				ItemID:          purchaseItem.ItemID,
 				ServerID:        purchaseItem.ServerID,
-				Amount:          itemTotal,
 				Quantity:        purchaseItem.Quantity,
 				Status:          "pending",
 			}
+			if coupon != nil && coupon.Discounts[i] > 0 {
+				itemTotal -= coupon.Discounts[i]
+				transaction.DiscountAmount = coupon.Discounts[i]
+				transaction.CouponID = &coupon.Coupon.CouponID
+			}
+			transaction.Amount = itemTotal
+			totalAmount += itemTotal
 
 			if err := tx.Create(transaction).Error; err != nil {
 				return fmt.Errorf("failed to create transaction: %w", err)
 			}
 
 			transactions = append(transactions, transaction)
+		}
+
+		// Take limited stock once per item, for all of its lines
+		for _, item := range items {
+			quantity, ok := quantities[item.ItemID]
+			if !ok || item.StockQuantity == -1 {
+				continue
+			}
+			delete(quantities, item.ItemID)
 
-			// Update stock if limited
-			if item.StockQuantity != -1 {
-				if err := tx.Model(&item).
-					Update("stock_quantity", gorm.Expr("stock_quantity - ?", purchaseItem.Quantity)).Error; err != nil {
-					return fmt.Errorf("failed to update stock: %w", err)
-				}
+			taken, err := takeStock(tx, item.ItemID, quantity)
+			if err != nil {
+				return err
+			}
+			if !taken {
+				return fmt.Errorf("insufficient stock for item %s", item.ItemName)
 			}
 		}
 
-		// Check if user has sufficient balance
-		if user.CreditBalance < totalAmount {
-			return fmt.Errorf("insufficient credit balance. Required: %.2f, Available: %.2f",
-				totalAmount, user.CreditBalance)
+		// Deduct credits from user with one debit per line item, so each
+		// transaction can be refunded against its own payment
+		debits := make([]LedgerEntry, len(transactions))
+		for i, transaction := range transactions {
+			debits[i] = LedgerEntry{
+				UserID:               userID,
+				Amount:               -transaction.Amount,
+				TransactionType:      "purchase",
+				Description:          fmt.Sprintf("Purchase of %s x%d", items[i].ItemName, transaction.Quantity),
+				RelatedTransactionID: &transaction.TransactionID,
+				DiscountAmount:       transaction.DiscountAmount,
+				CouponID:             transaction.CouponID,
+			}
+		}
+		if coupon != nil {
+			discountAmount = coupon.Total
+
+			if err := s.couponService.Redeem(tx, coupon, userID, transactions); err != nil {
+				return err
+			}
+		}
+		if _, err := s.ledgerService.PostTx(tx, debits...); err != nil {
+			return err
 		}
 
-		// Deduct credits from user
-		err = s.userService.UpdateCreditBalance(
-			ctx,
-			userID,
-			-totalAmount,
-			"purchase",
-			fmt.Sprintf("Purchase of %d items", len(req.Items)),
-			nil,
-			&transactions[0].TransactionID,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to deduct credits: %w", err)
+		// Queue RCON delivery together with the purchase
+		if err := s.deliveryService.EnqueueDeliveries(ctx, tx, transactions); err != nil {
+			return err
 		}
 
+		if beforeCommit != nil {
+			return beforeCommit(tx, transactions)
+		}
 		return nil
 	})
 
@@ -143,14 +216,14 @@ func (s *TransactionService) processPurchaseTransaction(ctx context.Context, use
 		return nil, err
 	}
 
-	// Process RCON commands asynchronously
-	go s.processRCONCommands(transactions)
+	s.deliveryService.Dispatch()
 
 	// Prepare response
 	response := &PurchaseResponse{
 		TransactionID: transactions[0].TransactionUUID,
 		Status:        "processing",
 		TotalAmount:   totalAmount,
+		Discount:      discountAmount,
 		Message:       "Purchase completed successfully. Items are being delivered.",
 	}
 
@@ -173,93 +246,6 @@ func (s *TransactionService) processPurchaseTransaction(ctx context.Context, use
 	return response, nil
 }
 
-func (s *TransactionService) processRCONCommands(transactions []*models.Transaction) {
-	for _, transaction := range transactions {
-		s.processTransactionRCON(transaction)
-	}
-}
-
-func (s *TransactionService) processTransactionRCON(transaction *models.Transaction) {
-	// Update transaction status to processing
-	s.updateTransactionStatus(transaction.TransactionID, "processing", nil)
-
-	// Get item and server details
-	var item models.Item
-	var server models.Server
-
-	if err := s.db.Where("item_id = ?", transaction.ItemID).First(&item).Error; err != nil {
-		reason := fmt.Sprintf("Failed to get item details: %v", err)
-		s.updateTransactionStatus(transaction.TransactionID, "failed", &reason)
-		return
-	}
-
-	if err := s.db.Where("server_id = ?", transaction.ServerID).First(&server).Error; err != nil {
-		reason := fmt.Sprintf("Failed to get server details: %v", err)
-		s.updateTransactionStatus(transaction.TransactionID, "failed", &reason)
-		return
-	}
-
-	// Prepare RCON command with quantity
-	command := item.RCONCommand
-	if transaction.Quantity > 1 {
-		command = fmt.Sprintf("%s %d", command, transaction.Quantity)
-	}
-
-	// Execute RCON command
-	response, err := s.serverService.ExecuteRCONCommand(
-		context.Background(),
-		transaction.ServerID,
-		command,
-	)
-
-	if err != nil {
-		reason := fmt.Sprintf("RCON execution failed: %v", err)
-		s.updateTransactionStatus(transaction.TransactionID, "failed", &reason)
-		return
-	}
-
-	if !response.Success {
-		reason := fmt.Sprintf("RCON command failed: %s", response.Error)
-		s.updateTransactionStatus(transaction.TransactionID, "failed", &reason)
-		return
-	}
-
-	// Update transaction with success
-	now := time.Now()
-	updates := map[string]interface{}{
-		"status":            "completed",
-		"rcon_command_sent": command,
-		"rcon_response":     response.Response,
-		"completed_at":      now,
-	}
-
-	if err := s.db.Model(&models.Transaction{}).
-		Where("transaction_id = ?", transaction.TransactionID).
-		Updates(updates).Error; err != nil {
-		fmt.Printf("Failed to update transaction status: %v\n", err)
-	}
-}
-
-func (s *TransactionService) updateTransactionStatus(transactionID uint, status string, failureReason *string) {
-	updates := map[string]interface{}{
-		"status": status,
-	}
-
-	if failureReason != nil {
-		updates["failure_reason"] = *failureReason
-	}
-
-	if status == "completed" {
-		updates["completed_at"] = time.Now()
-	}
-
-	if err := s.db.Model(&models.Transaction{}).
-		Where("transaction_id = ?", transactionID).
-		Updates(updates).Error; err != nil {
-		fmt.Printf("Failed to update transaction status: %v\n", err)
-	}
-}
-
 func (s *TransactionService) GetUserTransactions(ctx context.Context, userID uint, limit, offset int) ([]models.Transaction, int64, error) {
 	var transactions []models.Transaction
 	var total int64
@@ -292,6 +278,9 @@ func (s *TransactionService) GetTransactionByID(ctx context.Context, userID uint
 		Preload("Item").
 		Preload("Item.Category").
 		Preload("Server").
+		Preload("DeliverySteps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("step_order ASC, unit_index ASC")
+		}).
 		First(&transaction).Error
 
 	if err != nil {
@@ -303,3 +292,61 @@ func (s *TransactionService) GetTransactionByID(ctx context.Context, userID uint
 
 	return &transaction, nil
 }
+
+// RetryDelivery re-queues the delivery of one of the user's failed transactions
+func (s *TransactionService) RetryDelivery(ctx context.Context, userID uint, transactionUUID string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	err := s.db.Where("transaction_uuid = ? AND user_id = ?", transactionUUID, userID).First(&transaction).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("transaction not found")
+		}
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if err := s.deliveryService.RetryDelivery(ctx, &transaction); err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+// RefundTransaction refunds a failed transaction on behalf of an admin.
+// Partially delivered transactions can't be refunded this way.
+func (s *TransactionService) RefundTransaction(ctx context.Context, transactionUUID string, adminID uint) (*models.CreditTransaction, error) {
+	var transaction models.Transaction
+	err := s.db.Where("transaction_uuid = ?", transactionUUID).First(&transaction).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("transaction not found")
+		}
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if transaction.Status != "failed" {
+		return nil, fmt.Errorf("only failed transactions can be refunded")
+	}
+
+	partial, err := s.refundService.IsPartiallyDelivered(ctx, transaction.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+	if partial {
+		return nil, fmt.Errorf("transaction was partially delivered")
+	}
+
+	return s.refundService.RefundTransaction(ctx, transaction.TransactionID, "Refunded by admin", &adminID)
+}
+
+// takeStock decrements an item's limited stock by quantity, provided that
+// much is left. The check and decrement are one statement, so concurrent
+// purchases can't take stock below zero, where -1 would read as unlimited.
+func takeStock(tx *gorm.DB, itemID uint, quantity int) (bool, error) {
+	result := tx.Model(&models.Item{}).
+		Where("item_id = ? AND stock_quantity >= ?", itemID, quantity).
+		Update("stock_quantity", gorm.Expr("stock_quantity - ?", quantity))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update stock: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
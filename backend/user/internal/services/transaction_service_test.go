@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/money"
+)
+
+// limitStock sets how many of item are left
+func (s *testShop) limitStock(t *testing.T, item *models.Item, stock int) {
+	t.Helper()
+
+	if err := s.db.Model(item).Update("stock_quantity", stock).Error; err != nil {
+		t.Fatalf("failed to set stock: %v", err)
+	}
+}
+
+// stockOf returns how many of item are left
+func (s *testShop) stockOf(t *testing.T, item *models.Item) int {
+	t.Helper()
+
+	var reloaded models.Item
+	if err := s.db.First(&reloaded, item.ItemID).Error; err != nil {
+		t.Fatalf("failed to reload item: %v", err)
+	}
+	return reloaded.StockQuantity
+}
+
+func TestPurchaseChecksStockAcrossLinesOfTheSameItem(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	other := shop.createServer(t, "Other Island")
+	item := shop.createItem(t, "tek_rifle", money.FromBaht(1), "GiveItemNum {steam_id} 1")
+	shop.limitStock(t, item, 5)
+	buyer := createTestUser(t, shop.db, shop.ledger, "76561198000000021", money.FromBaht(10))
+
+	_, err := shop.transactions.ProcessPurchase(context.Background(), buyer.UserID, PurchaseRequest{
+		Items: []PurchaseItem{
+			{ItemID: item.ItemID, Quantity: 3, ServerID: shop.server.ServerID},
+			{ItemID: item.ItemID, Quantity: 3, ServerID: other.ServerID},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "insufficient stock") {
+		t.Fatalf("got %v buying 6 of 5 in stock over two lines, want an insufficient stock error", err)
+	}
+	if stock := shop.stockOf(t, item); stock != 5 {
+		t.Errorf("stock is %d after the failed purchase, want 5", stock)
+	}
+
+	if _, err := shop.transactions.ProcessPurchase(context.Background(), buyer.UserID, PurchaseRequest{
+		Items: []PurchaseItem{
+			{ItemID: item.ItemID, Quantity: 2, ServerID: shop.server.ServerID},
+			{ItemID: item.ItemID, Quantity: 3, ServerID: other.ServerID},
+		},
+	}); err != nil {
+		t.Fatalf("buying all 5 in stock over two lines failed: %v", err)
+	}
+	if stock := shop.stockOf(t, item); stock != 0 {
+		t.Errorf("stock is %d after buying all of it, want 0", stock)
+	}
+
+	shop.waitForJobs(t)
+}
+
+func TestConcurrentPurchasesNeverOversell(t *testing.T) {
+	shop := newTestShop(t, testDeliveryConfig)
+	item := shop.createItem(t, "tek_rifle", money.FromBaht(1), "GiveItemNum {steam_id} 1")
+	shop.limitStock(t, item, 5)
+
+	const buyers = 10
+	var fns []func() error
+	for i := 0; i < buyers; i++ {
+		buyer := createTestUser(t, shop.db, shop.ledger, fmt.Sprintf("765611980000001%02d", i), money.FromBaht(10))
+		if i%2 == 0 {
+			fns = append(fns, func() error {
+				_, err := shop.transactions.ProcessPurchase(context.Background(), buyer.UserID, PurchaseRequest{
+					Items: []PurchaseItem{{ItemID: item.ItemID, Quantity: 1, ServerID: shop.server.ServerID}},
+				})
+				return err
+			})
+		} else {
+			fns = append(fns, func() error {
+				_, err := shop.shop.BuyItem(context.Background(), buyer.UserID, item.ItemID, &shop.server.ServerID, "")
+				return err
+			})
+		}
+	}
+
+	succeeded := 0
+	for _, err := range runConcurrently(t, 30*time.Second, fns...) {
+		switch {
+		case err == nil:
+			succeeded++
+		case !strings.Contains(err.Error(), "stock"):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if succeeded != 5 {
+		t.Errorf("%d purchases succeeded with 5 in stock, want 5", succeeded)
+	}
+	if stock := shop.stockOf(t, item); stock != 0 {
+		t.Errorf("stock is %d after selling out, want 0", stock)
+	}
+
+	shop.waitForJobs(t)
+	assertLedgerConsistent(t, shop.db)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"nexark-user-backend/internal/models"
+	"nexark-user-backend/pkg/rcon"
 	"nexark-user-backend/pkg/steam"
 	"nexark-user-backend/pkg/stripe"
 
@@ -114,43 +116,51 @@ func (s *UserService) GetUserByID(ctx context.Context, userID uint) (*models.Use
 	return &user, nil
 }
 
-func (s *UserService) UpdateCreditBalance(ctx context.Context, userID uint, amount float64, transactionType, description string, relatedPaymentID, relatedTransactionID *uint) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Get current user for balance
-		var user models.User
-		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
-		}
-
-		// Check if this would result in negative balance for purchases
-		newBalance := user.CreditBalance + amount
-		if transactionType == "purchase" && newBalance < 0 {
-			return fmt.Errorf("insufficient credit balance")
+// SetEOSID links the player's Epic Online Services ID, which ARK: Survival
+// Ascended deliveries use for {eos_id} and to find the player online. An empty
+// id unlinks it.
+func (s *UserService) SetEOSID(ctx context.Context, userID uint, eosID string) (*models.User, error) {
+	var value *string
+	if eosID != "" {
+		if !rcon.ValidEOSID(eosID) {
+			return nil, fmt.Errorf("invalid eos id: must be 32 hexadecimal characters")
 		}
+		normalized := strings.ToLower(eosID)
+		value = &normalized
+	}
 
-		// Create credit transaction record
-		creditTx := models.CreditTransaction{
-			UserID:               userID,
-			RelatedPaymentID:     relatedPaymentID,
-			RelatedTransactionID: relatedTransactionID,
-			Amount:               amount,
-			TransactionType:      transactionType,
-			Description:          &description,
-			BalanceBefore:        user.CreditBalance,
-			BalanceAfter:         newBalance,
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("user not found")
+			}
+			return fmt.Errorf("failed to get user: %w", err)
 		}
 
-		if err := tx.Create(&creditTx).Error; err != nil {
-			return fmt.Errorf("failed to create credit transaction: %w", err)
+		if value != nil {
+			var taken int64
+			if err := tx.Model(&models.User{}).
+				Where("eos_id = ? AND user_id <> ?", *value, userID).
+				Count(&taken).Error; err != nil {
+				return fmt.Errorf("failed to check eos id: %w", err)
+			}
+			if taken > 0 {
+				return fmt.Errorf("eos id already linked to another account")
+			}
 		}
 
-		// Update user balance
-		if err := tx.Model(&user).Update("credit_balance", newBalance).Error; err != nil {
-			return fmt.Errorf("failed to update user balance: %w", err)
+		if err := tx.Model(&user).Update("eos_id", value).Error; err != nil {
+			return fmt.Errorf("failed to update eos id: %w", err)
 		}
-
+		user.EOSID = value
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
 }
 
 func (s *UserService) GetCreditTransactions(ctx context.Context, userID uint, limit, offset int) ([]models.CreditTransaction, int64, error) {
@@ -0,0 +1,26 @@
+-- Migration 011: Durable RCON delivery queue
+-- - Creates the jobs table used by JobService (item deliveries are persisted as jobs)
+-- - Links each transaction to the job that delivers it
+
+CREATE TABLE IF NOT EXISTS jobs (
+    job_id INT AUTO_INCREMENT PRIMARY KEY,
+    job_type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    priority INT DEFAULT 0,
+    payload JSON,
+    result JSON,
+    error_msg TEXT,
+    attempt_count INT DEFAULT 0,
+    max_attempts INT DEFAULT 3,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    process_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP NULL,
+    completed_at TIMESTAMP NULL,
+    created_by INT,
+    INDEX idx_status_process (status, process_at),
+    INDEX idx_type_status (job_type, status)
+);
+
+ALTER TABLE transactions
+  ADD COLUMN delivery_job_id INT NULL AFTER failure_reason,
+  ADD INDEX idx_delivery_job (delivery_job_id);
@@ -0,0 +1,5 @@
+-- Migration 012: Gift deliveries
+-- - Stores the Steam ID an item is delivered to when it differs from the buyer (gifts)
+
+ALTER TABLE transactions
+  ADD COLUMN recipient_steam_id VARCHAR(20) NULL AFTER server_id;
@@ -0,0 +1,5 @@
+-- Migration 013: Templated RCON commands
+-- - Stores the player's Epic Online Services ID for {eos_id} placeholders (ARK: Survival Ascended)
+
+ALTER TABLE users
+  ADD COLUMN eos_id VARCHAR(32) NULL AFTER steam_id;
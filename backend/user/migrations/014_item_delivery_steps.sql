@@ -0,0 +1,31 @@
+-- Migration 014: Multi-command item bundles
+-- - An item can own an ordered list of delivery steps (falls back to items.rcon_command when it has none)
+-- - Each transaction records the result of every step so partial deliveries can be resumed
+
+CREATE TABLE IF NOT EXISTS item_delivery_steps (
+    step_id INT AUTO_INCREMENT PRIMARY KEY,
+    item_id INT NOT NULL,
+    step_order INT NOT NULL,
+    rcon_command TEXT NOT NULL,
+    delay_seconds INT NOT NULL DEFAULT 0,
+    success_pattern VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_item_step (item_id, step_order)
+);
+
+CREATE TABLE IF NOT EXISTS transaction_delivery_steps (
+    transaction_step_id INT AUTO_INCREMENT PRIMARY KEY,
+    transaction_id INT NOT NULL,
+    step_order INT NOT NULL,
+    unit_index INT NOT NULL DEFAULT 0,
+    status ENUM('pending', 'completed', 'failed') DEFAULT 'pending',
+    rcon_command_sent TEXT NULL,
+    rcon_response TEXT NULL,
+    error_message TEXT NULL,
+    attempt_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_transaction_step (transaction_id, step_order, unit_index)
+);
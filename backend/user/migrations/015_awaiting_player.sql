@@ -0,0 +1,9 @@
+-- Migration 015: Hold deliveries until the player is online
+-- - Adds the awaiting_player transaction status
+-- - Records when a delivery started waiting so it can time out and be refunded
+
+ALTER TABLE transactions
+  MODIFY COLUMN status ENUM('pending', 'processing', 'awaiting_player', 'completed', 'failed', 'refunded') DEFAULT 'pending';
+
+ALTER TABLE transactions
+  ADD COLUMN awaiting_player_since TIMESTAMP NULL AFTER completed_at;
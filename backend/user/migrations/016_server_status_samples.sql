@@ -0,0 +1,16 @@
+-- Migration 016: Server status monitoring
+-- - One row per poll of a server, used for uptime history
+
+CREATE TABLE IF NOT EXISTS server_status_samples (
+    sample_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id INT NOT NULL,
+    is_online BOOLEAN NOT NULL,
+    player_count INT NOT NULL DEFAULT 0,
+    max_players INT NULL,
+    latency_ms INT NULL,
+    probe VARCHAR(20) NULL,
+    error_message TEXT NULL,
+    sampled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    INDEX idx_server_sampled (server_id, sampled_at)
+);
@@ -0,0 +1,5 @@
+-- Migration 017: Steam A2S server queries
+-- - UDP query port used for A2S_INFO / A2S_PLAYER / A2S_RULES (ARK defaults to 27015)
+
+ALTER TABLE servers
+  ADD COLUMN query_port INT NULL AFTER rcon_port;
@@ -0,0 +1,25 @@
+-- Migration 018: Server uptime and population history
+-- - Hourly and daily rollups of server_status_samples
+-- - Raw samples and hourly rollups are pruned after their retention period, daily rollups are kept
+
+CREATE TABLE IF NOT EXISTS server_status_hourly (
+    server_id INT NOT NULL,
+    bucket_start DATETIME NOT NULL,
+    sample_count INT NOT NULL DEFAULT 0,
+    online_count INT NOT NULL DEFAULT 0,
+    player_sum BIGINT NOT NULL DEFAULT 0,
+    peak_players INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (server_id, bucket_start),
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS server_status_daily (
+    server_id INT NOT NULL,
+    bucket_start DATE NOT NULL,
+    sample_count INT NOT NULL DEFAULT 0,
+    online_count INT NOT NULL DEFAULT 0,
+    player_sum BIGINT NOT NULL DEFAULT 0,
+    peak_players INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (server_id, bucket_start),
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+);
@@ -0,0 +1,55 @@
+-- Migration 019: Admin RCON console
+-- - rcon_command_history was modelled but never created
+-- - Admin roles per user, granted by inserting into user_roles
+-- - Allow/deny patterns for console commands per role. A command is allowed
+--   when one of the admin's roles has a matching allow and no matching deny
+
+CREATE TABLE IF NOT EXISTS rcon_command_history (
+    command_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id INT NOT NULL,
+    command TEXT NOT NULL,
+    response TEXT NULL,
+    status VARCHAR(20) NOT NULL,
+    executed_by INT NULL,
+    execution_context VARCHAR(50) NOT NULL DEFAULT 'system',
+    executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    FOREIGN KEY (executed_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_server_executed (server_id, executed_at),
+    INDEX idx_executed_by (executed_by, executed_at),
+    INDEX idx_context (execution_context, executed_at)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    granted_by INT NULL,
+    granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_role (role)
+);
+
+CREATE TABLE IF NOT EXISTS rcon_command_policies (
+    policy_id INT AUTO_INCREMENT PRIMARY KEY,
+    role VARCHAR(32) NOT NULL,
+    pattern VARCHAR(100) NOT NULL,
+    effect ENUM('allow', 'deny') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_role_pattern_effect (role, pattern, effect)
+);
+
+INSERT IGNORE INTO rcon_command_policies (role, pattern, effect) VALUES
+('superadmin', '*', 'allow'),
+('moderator', '*', 'allow'),
+('moderator', 'DoExit', 'deny'),
+('moderator', 'DestroyAll*', 'deny'),
+('moderator', 'DestroyWildDinos', 'deny'),
+('moderator', 'GiveItem*', 'deny'),
+('moderator', 'GiveCreativeMode*', 'deny'),
+('moderator', 'AddExperience*', 'deny'),
+('moderator', 'ScriptCommand', 'deny'),
+('support', 'ListPlayers', 'allow'),
+('support', 'GetChat', 'allow'),
+('support', 'ServerChat*', 'allow'),
+('support', 'Broadcast', 'allow');
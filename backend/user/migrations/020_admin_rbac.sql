@@ -0,0 +1,70 @@
+-- Migration 020: Role-based access control for the admin API
+-- - Roles and permissions, assigned to users through user_roles
+-- - superadmin holds every permission without explicit rows
+-- - Every grant and revoke is written to role_audit_log
+
+CREATE TABLE IF NOT EXISTS roles (
+    role_key VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_key VARCHAR(64) PRIMARY KEY,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_key VARCHAR(32) NOT NULL,
+    permission_key VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role_key, permission_key),
+    FOREIGN KEY (role_key) REFERENCES roles(role_key) ON DELETE CASCADE,
+    FOREIGN KEY (permission_key) REFERENCES permissions(permission_key) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS role_audit_log (
+    audit_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    role_key VARCHAR(32) NOT NULL,
+    action ENUM('grant', 'revoke') NOT NULL,
+    performed_by INT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (performed_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_user_created (user_id, created_at),
+    INDEX idx_created (created_at)
+);
+
+INSERT IGNORE INTO roles (role_key, name, description) VALUES
+('support', 'Support', 'Looks into player issues and reads the RCON history'),
+('moderator', 'Moderator', 'Moderates game servers through the RCON console'),
+('shop_manager', 'Shop Manager', 'Manages the shop catalogue'),
+('superadmin', 'Super Admin', 'Full access, including role management');
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('admin.access', 'Use the admin API'),
+('servers.monitor', 'View RCON connection pools and monitoring details'),
+('rcon.execute', 'Run RCON commands through the admin console'),
+('rcon.history', 'Search the RCON command history'),
+('roles.view', 'View roles and role assignments'),
+('roles.manage', 'Grant and revoke admin roles');
+
+INSERT IGNORE INTO role_permissions (role_key, permission_key) VALUES
+('support', 'admin.access'),
+('support', 'rcon.execute'),
+('support', 'rcon.history'),
+('moderator', 'admin.access'),
+('moderator', 'servers.monitor'),
+('moderator', 'rcon.execute'),
+('moderator', 'rcon.history'),
+('shop_manager', 'admin.access');
+
+-- Roles granted before this migration must exist
+INSERT IGNORE INTO roles (role_key, name)
+SELECT DISTINCT role, role FROM user_roles;
+
+ALTER TABLE user_roles
+    ADD CONSTRAINT fk_user_roles_role FOREIGN KEY (role) REFERENCES roles(role_key) ON DELETE CASCADE;
@@ -0,0 +1,23 @@
+-- Migration 021: Admin shop catalog management
+-- - One row per admin change to an item or category, with the changed fields as
+--   {"field": {"old": ..., "new": ...}}
+-- - shop.manage permission for the shop_manager role
+
+CREATE TABLE IF NOT EXISTS item_change_log (
+    change_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entity_type ENUM('item', 'category') NOT NULL,
+    entity_id INT NOT NULL,
+    action ENUM('create', 'update', 'deactivate') NOT NULL,
+    changes JSON NULL,
+    changed_by INT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (changed_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_entity (entity_type, entity_id, changed_at),
+    INDEX idx_changed_by (changed_by, changed_at)
+);
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('shop.manage', 'Create and edit shop categories and items');
+
+INSERT IGNORE INTO role_permissions (role_key, permission_key) VALUES
+('shop_manager', 'shop.manage');
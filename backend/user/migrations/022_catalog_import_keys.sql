@@ -0,0 +1,15 @@
+-- Migration 022: Stable keys for catalog import/export
+-- - Items are matched by item_code, which must now be unique
+-- - Categories get a category_key so imported items can refer to them, and
+--   existing categories are keyed category_<id>
+
+ALTER TABLE items
+  ADD UNIQUE KEY uniq_item_code (item_code);
+
+ALTER TABLE item_categories
+  ADD COLUMN category_key VARCHAR(64) NULL AFTER category_id,
+  ADD UNIQUE KEY uniq_category_key (category_key);
+
+UPDATE item_categories
+SET category_key = CONCAT('category_', category_id)
+WHERE category_key IS NULL;
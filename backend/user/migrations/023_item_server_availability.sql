@@ -0,0 +1,17 @@
+-- Migration 023: Per-server item availability and pricing
+-- - Items without rows are sold on every server at their base price
+-- - Once an item has rows it is only sold on servers with an available row,
+--   optionally at a different price or with a different RCON command
+
+CREATE TABLE IF NOT EXISTS item_server_availability (
+    item_id INT NOT NULL,
+    server_id INT NOT NULL,
+    is_available BOOLEAN NOT NULL DEFAULT TRUE,
+    price_override DECIMAL(10,2) NULL,
+    rcon_command_override TEXT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, server_id),
+    FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE CASCADE,
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    INDEX idx_server (server_id, is_available)
+);
@@ -0,0 +1,19 @@
+-- Migration 024: Server-side shopping cart
+-- - One line per user, item and server
+-- - price_at_add is the server price when the line was added, so checkout can
+--   report price changes since then
+
+CREATE TABLE IF NOT EXISTS shopping_cart (
+    cart_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    item_id INT NOT NULL,
+    server_id INT NOT NULL,
+    quantity INT NOT NULL DEFAULT 1,
+    price_at_add DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE CASCADE,
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_cart_line (user_id, item_id, server_id)
+);
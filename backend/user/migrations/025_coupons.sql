@@ -0,0 +1,64 @@
+-- Migration 025: Discount coupons
+-- - Percentage or fixed discounts, optionally limited to an item, category or
+--   server, with validity windows, a minimum order amount and usage caps
+-- - One redemption row per purchase that used a coupon
+-- - Purchases record the discount and coupon on the transaction and on the
+--   credit transaction that paid for it
+-- - coupons.manage permission for the shop_manager role
+
+CREATE TABLE IF NOT EXISTS coupons (
+    coupon_id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(64) NOT NULL,
+    description TEXT,
+    discount_type ENUM('percentage', 'fixed') NOT NULL,
+    discount_value DECIMAL(10,2) NOT NULL,
+    max_discount DECIMAL(10,2) NULL,
+    item_id INT NULL,
+    category_id INT NULL,
+    server_id INT NULL,
+    min_order_amount DECIMAL(10,2) NULL,
+    max_uses INT NULL,
+    max_uses_per_user INT NULL,
+    uses_count INT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP NULL,
+    ends_at TIMESTAMP NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_code (code),
+    FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE SET NULL,
+    FOREIGN KEY (category_id) REFERENCES item_categories(category_id) ON DELETE SET NULL,
+    FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    redemption_id INT AUTO_INCREMENT PRIMARY KEY,
+    coupon_id INT NOT NULL,
+    user_id INT NOT NULL,
+    transaction_id INT NOT NULL,
+    discount_amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+    INDEX idx_coupon_user (coupon_id, user_id),
+    INDEX idx_user (user_id, created_at)
+);
+
+ALTER TABLE transactions
+  ADD COLUMN discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER amount,
+  ADD COLUMN coupon_id INT NULL AFTER discount_amount,
+  ADD FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE SET NULL;
+
+ALTER TABLE credit_transactions
+  ADD COLUMN discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER amount,
+  ADD COLUMN coupon_id INT NULL AFTER discount_amount,
+  ADD FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE SET NULL;
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('coupons.manage', 'Create and edit discount coupons');
+
+INSERT IGNORE INTO role_permissions (role_key, permission_key) VALUES
+('shop_manager', 'coupons.manage');
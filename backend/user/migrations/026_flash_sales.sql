@@ -0,0 +1,28 @@
+-- Migration 026: Scheduled flash sales
+-- - A sale takes a percentage or fixed amount off the price of its target
+--   items and categories between starts_at and ends_at
+-- - When several sales cover an item, the lowest price wins
+
+CREATE TABLE IF NOT EXISTS flash_sales (
+    sale_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    discount_type ENUM('percentage', 'fixed') NOT NULL,
+    discount_value DECIMAL(10,2) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_window (is_active, starts_at, ends_at)
+);
+
+CREATE TABLE IF NOT EXISTS flash_sale_targets (
+    sale_id INT NOT NULL,
+    target_type ENUM('item', 'category') NOT NULL,
+    target_id INT NOT NULL,
+    PRIMARY KEY (sale_id, target_type, target_id),
+    FOREIGN KEY (sale_id) REFERENCES flash_sales(sale_id) ON DELETE CASCADE,
+    INDEX idx_target (target_type, target_id)
+);
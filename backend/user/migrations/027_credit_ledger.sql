@@ -0,0 +1,7 @@
+-- Migration 027: Non-negative credit balances
+-- - Balances only change through the ledger, which locks the user row, but the
+--   database rejects a negative balance as well
+-- - Needs MySQL 8.0.16 or later for CHECK constraints to be enforced, and fails
+--   if a user already has a negative balance, so correct those first
+
+ALTER TABLE users ADD CONSTRAINT chk_users_credit_balance_non_negative CHECK (credit_balance >= 0);
@@ -0,0 +1,109 @@
+-- Migration 028: Money as integer minor units
+-- - Credit balances, prices and amounts move from DECIMAL(10,2) baht to BIGINT
+--   satang so the application never rounds through floating point
+-- - Each column is widened first so multiplying by 100 can't overflow, then
+--   converted. Values have two decimals, so the conversion is exact
+-- - Percentage discount values are stored the same way, 1250 being 12.5%
+-- - Run once: running it again would multiply the amounts again
+
+-- users
+ALTER TABLE users
+  MODIFY credit_balance DECIMAL(14,2) DEFAULT 0;
+
+UPDATE users SET credit_balance = credit_balance * 100;
+
+ALTER TABLE users
+  MODIFY credit_balance BIGINT DEFAULT 0;
+
+-- items
+ALTER TABLE items
+  MODIFY price DECIMAL(14,2) NOT NULL;
+
+UPDATE items SET price = price * 100;
+
+ALTER TABLE items
+  MODIFY price BIGINT NOT NULL;
+
+-- payments
+ALTER TABLE payments
+  MODIFY amount DECIMAL(14,2) NOT NULL;
+
+UPDATE payments SET amount = amount * 100;
+
+ALTER TABLE payments
+  MODIFY amount BIGINT NOT NULL;
+
+-- transactions
+ALTER TABLE transactions
+  MODIFY amount DECIMAL(14,2) NOT NULL,
+  MODIFY discount_amount DECIMAL(14,2) NOT NULL DEFAULT 0;
+
+UPDATE transactions SET amount = amount * 100, discount_amount = discount_amount * 100;
+
+ALTER TABLE transactions
+  MODIFY amount BIGINT NOT NULL,
+  MODIFY discount_amount BIGINT NOT NULL DEFAULT 0;
+
+-- credit_transactions
+ALTER TABLE credit_transactions
+  MODIFY amount DECIMAL(14,2) NOT NULL,
+  MODIFY discount_amount DECIMAL(14,2) NOT NULL DEFAULT 0,
+  MODIFY balance_before DECIMAL(14,2) NOT NULL,
+  MODIFY balance_after DECIMAL(14,2) NOT NULL;
+
+UPDATE credit_transactions SET amount = amount * 100, discount_amount = discount_amount * 100, balance_before = balance_before * 100, balance_after = balance_after * 100;
+
+ALTER TABLE credit_transactions
+  MODIFY amount BIGINT NOT NULL,
+  MODIFY discount_amount BIGINT NOT NULL DEFAULT 0,
+  MODIFY balance_before BIGINT NOT NULL,
+  MODIFY balance_after BIGINT NOT NULL;
+
+-- item_server_availability
+ALTER TABLE item_server_availability
+  MODIFY price_override DECIMAL(14,2) NULL;
+
+UPDATE item_server_availability SET price_override = price_override * 100;
+
+ALTER TABLE item_server_availability
+  MODIFY price_override BIGINT NULL;
+
+-- shopping_cart
+ALTER TABLE shopping_cart
+  MODIFY price_at_add DECIMAL(14,2) NOT NULL;
+
+UPDATE shopping_cart SET price_at_add = price_at_add * 100;
+
+ALTER TABLE shopping_cart
+  MODIFY price_at_add BIGINT NOT NULL;
+
+-- coupons
+ALTER TABLE coupons
+  MODIFY discount_value DECIMAL(14,2) NOT NULL,
+  MODIFY max_discount DECIMAL(14,2) NULL,
+  MODIFY min_order_amount DECIMAL(14,2) NULL;
+
+UPDATE coupons SET discount_value = discount_value * 100, max_discount = max_discount * 100, min_order_amount = min_order_amount * 100;
+
+ALTER TABLE coupons
+  MODIFY discount_value BIGINT NOT NULL,
+  MODIFY max_discount BIGINT NULL,
+  MODIFY min_order_amount BIGINT NULL;
+
+-- coupon_redemptions
+ALTER TABLE coupon_redemptions
+  MODIFY discount_amount DECIMAL(14,2) NOT NULL;
+
+UPDATE coupon_redemptions SET discount_amount = discount_amount * 100;
+
+ALTER TABLE coupon_redemptions
+  MODIFY discount_amount BIGINT NOT NULL;
+
+-- flash_sales
+ALTER TABLE flash_sales
+  MODIFY discount_value DECIMAL(14,2) NOT NULL;
+
+UPDATE flash_sales SET discount_value = discount_value * 100;
+
+ALTER TABLE flash_sales
+  MODIFY discount_value BIGINT NOT NULL;
@@ -0,0 +1,47 @@
+-- Migration 029: Ledger reconciliation reports
+-- - Each run checks balances against their ledgers, the balance_before and
+--   balance_after chain of every ledger row, and completed payments against
+--   deposit entries
+-- - Issues found by a run stay open until an admin resolves or ignores them
+-- - Adds the ledger.reconcile permission, which superadmins hold implicitly
+
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    run_id INT AUTO_INCREMENT PRIMARY KEY,
+    status ENUM('running', 'completed', 'failed') NOT NULL DEFAULT 'running',
+    users_checked INT NOT NULL DEFAULT 0,
+    entries_checked INT NOT NULL DEFAULT 0,
+    payments_checked INT NOT NULL DEFAULT 0,
+    issue_count INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    triggered_by INT NULL,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    FOREIGN KEY (triggered_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_started (started_at)
+);
+
+CREATE TABLE IF NOT EXISTS reconciliation_issues (
+    issue_id INT AUTO_INCREMENT PRIMARY KEY,
+    run_id INT NOT NULL,
+    issue_type VARCHAR(50) NOT NULL,
+    user_id INT NULL,
+    credit_transaction_id INT NULL,
+    point_transaction_id INT NULL,
+    payment_id INT NULL,
+    expected VARCHAR(32) NULL,
+    actual VARCHAR(32) NULL,
+    details TEXT,
+    status ENUM('open', 'resolved', 'ignored') NOT NULL DEFAULT 'open',
+    resolution_note TEXT,
+    resolved_by INT NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (run_id) REFERENCES reconciliation_runs(run_id) ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    INDEX idx_run_type (run_id, issue_type),
+    INDEX idx_status (status),
+    INDEX idx_user (user_id)
+);
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('ledger.reconcile', 'View ledger reconciliation reports and resolve their issues');
@@ -0,0 +1,21 @@
+-- Migration 030: Idempotency keys for money-moving endpoints
+-- - The first response to each (user, key) is stored and replayed for retries
+-- - request_hash covers the method, path and body so a reused key with a
+--   different request can be rejected
+-- - Keys expire after a day and are pruned in the background
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status ENUM('processing', 'completed') NOT NULL DEFAULT 'processing',
+    response_status INT NULL,
+    response_body MEDIUMBLOB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    UNIQUE KEY uk_user_key (user_id, idempotency_key),
+    INDEX idx_expires (expires_at)
+);
@@ -0,0 +1,44 @@
+-- Migration 031: Stripe refunds of credit top-ups
+-- - payment_status and transaction_type become VARCHAR: the code already
+--   stores Stripe intent statuses, 'completed' and 'expired', and ledger types
+--   such as 'transfer_in' that the original ENUMs don't list
+-- - refunded_amount is the part of a payment refunded so far, in satang
+-- - Each refund records the credits clawed back from the user and the
+--   shortfall left when their balance was too low to cover it
+-- - Adds the payments.refund permission, which superadmins hold implicitly
+
+ALTER TABLE payments
+    MODIFY COLUMN payment_status VARCHAR(30) NOT NULL DEFAULT 'pending',
+    ADD COLUMN refunded_amount BIGINT NOT NULL DEFAULT 0 AFTER amount;
+
+ALTER TABLE credit_transactions
+    MODIFY COLUMN transaction_type VARCHAR(30) NOT NULL;
+
+CREATE TABLE IF NOT EXISTS payment_refunds (
+    refund_id INT AUTO_INCREMENT PRIMARY KEY,
+    payment_id INT NOT NULL,
+    user_id INT NOT NULL,
+    stripe_refund_id VARCHAR(100) NULL,
+    amount BIGINT NOT NULL,
+    credits_clawed_back BIGINT NOT NULL DEFAULT 0,
+    shortfall BIGINT NOT NULL DEFAULT 0,
+    status ENUM('processing', 'completed', 'failed') NOT NULL DEFAULT 'processing',
+    source ENUM('admin', 'stripe') NOT NULL DEFAULT 'admin',
+    reason VARCHAR(50) NULL,
+    note TEXT,
+    failure_reason TEXT,
+    credit_transaction_id INT NULL,
+    created_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (payment_id) REFERENCES payments(payment_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (credit_transaction_id) REFERENCES credit_transactions(credit_transaction_id),
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE SET NULL,
+    UNIQUE KEY uk_stripe_refund (stripe_refund_id),
+    INDEX idx_payment (payment_id),
+    INDEX idx_user (user_id),
+    INDEX idx_shortfall (shortfall)
+);
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('payments.refund', 'Refund credit top-ups through Stripe');
@@ -0,0 +1,22 @@
+-- Migration 032: Explicit RCON console allow-list for moderators
+-- - Moderators were allowed every command except a deny list, which missed
+--   ARK aliases such as GFI that spawn items. They now get only the player
+--   management and server messaging commands listed here
+-- - The deny rules from migration 019 stay as a second line of defence, and
+--   GFI is denied as well in case a wildcard allow is added back
+
+DELETE FROM rcon_command_policies
+WHERE role = 'moderator' AND pattern = '*' AND effect = 'allow';
+
+INSERT IGNORE INTO rcon_command_policies (role, pattern, effect) VALUES
+('moderator', 'ListPlayers', 'allow'),
+('moderator', 'GetChat', 'allow'),
+('moderator', 'GetGameLog', 'allow'),
+('moderator', 'ServerChat*', 'allow'),
+('moderator', 'Broadcast', 'allow'),
+('moderator', 'SetMessageOfTheDay', 'allow'),
+('moderator', 'KickPlayer', 'allow'),
+('moderator', 'BanPlayer', 'allow'),
+('moderator', 'UnbanPlayer', 'allow'),
+('moderator', 'SaveWorld', 'allow'),
+('moderator', 'GFI', 'deny');
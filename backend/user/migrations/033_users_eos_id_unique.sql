@@ -0,0 +1,5 @@
+-- Migration 033: One account per EOS ID
+-- - Players link their EOS ID from the account page, and it must not be claimed by two accounts
+
+ALTER TABLE users
+  ADD UNIQUE INDEX idx_users_eos_id (eos_id);
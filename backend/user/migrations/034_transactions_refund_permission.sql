@@ -0,0 +1,5 @@
+-- Migration 034: Refunds of failed purchases are issued by admins
+-- - Adds the transactions.refund permission, which superadmins hold implicitly
+
+INSERT IGNORE INTO permissions (permission_key, description) VALUES
+('transactions.refund', 'Refund failed item purchases');
@@ -0,0 +1,14 @@
+-- Migration 035: Link purchases to their coupon redemption
+-- - A redemption covers a whole purchase but is stored against its first
+--   transaction, so every discounted transaction now points at it directly
+-- - Refunding a discounted transaction takes its discount off the redemption,
+--   and removes the redemption (giving the use back) once nothing is left
+
+ALTER TABLE transactions
+    ADD COLUMN coupon_redemption_id INT NULL AFTER coupon_id,
+    ADD CONSTRAINT fk_transactions_coupon_redemption
+        FOREIGN KEY (coupon_redemption_id) REFERENCES coupon_redemptions(redemption_id) ON DELETE SET NULL;
+
+UPDATE transactions t
+JOIN coupon_redemptions r ON r.transaction_id = t.transaction_id
+SET t.coupon_redemption_id = r.redemption_id;
@@ -0,0 +1,9 @@
+-- Migration 036: Leases for running jobs
+-- - A worker holds a job until locked_until and keeps extending it while the
+--   job runs, so jobs are only requeued once their worker has stopped
+-- - Replaces requeueing every processing job at startup, which redelivered
+--   items another instance was still delivering
+
+ALTER TABLE jobs
+    ADD COLUMN locked_until TIMESTAMP NULL AFTER started_at,
+    ADD INDEX idx_status_locked (status, locked_until);
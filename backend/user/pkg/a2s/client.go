@@ -0,0 +1,283 @@
+// Package a2s implements the Steam server query protocol (A2S_INFO,
+// A2S_PLAYER and A2S_RULES) over UDP. Unlike RCON it needs no credentials.
+package a2s
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	headerSimple = -1 // 0xFFFFFFFF
+	headerSplit  = -2 // 0xFFFFFFFE
+
+	requestInfo    = 0x54
+	requestPlayers = 0x55
+	requestRules   = 0x56
+
+	responseChallenge = 0x41
+	responseInfo      = 0x49
+	responsePlayers   = 0x44
+	responseRules     = 0x45
+
+	maxPacketSize = 1400
+	// maxDecompressedSize bounds the size a compressed response may claim
+	maxDecompressedSize = 1 << 20
+	// maxChallenges bounds how often a server may answer with a new challenge
+	maxChallenges = 3
+)
+
+var infoPayload = []byte("Source Engine Query\x00")
+
+// ErrMalformed is returned for responses that don't follow the protocol
+var ErrMalformed = errors.New("a2s: malformed response")
+
+// Client queries one game server. A client is safe for concurrent use; every
+// query uses its own UDP socket.
+type Client struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewClient creates a client for the server's query port
+func NewClient(host string, port int) *Client {
+	return &Client{
+		addr:    net.JoinHostPort(host, fmt.Sprintf("%d", port)),
+		timeout: 3 * time.Second,
+	}
+}
+
+// SetTimeout sets the timeout used for queries whose context has no deadline
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// Info sends A2S_INFO. Ping is the round trip of the final request.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	payload, ping, err := c.query(ctx, requestInfo, infoPayload, false, responseInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parseInfo(payload)
+	if err != nil {
+		return nil, err
+	}
+	info.Ping = ping
+	return info, nil
+}
+
+// Players sends A2S_PLAYER
+func (c *Client) Players(ctx context.Context) ([]Player, error) {
+	payload, _, err := c.query(ctx, requestPlayers, nil, true, responsePlayers)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlayers(payload)
+}
+
+// Rules sends A2S_RULES
+func (c *Client) Rules(ctx context.Context) (map[string]string, error) {
+	payload, _, err := c.query(ctx, requestRules, nil, true, responseRules)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(payload)
+}
+
+// query sends a request and returns the response payload after its type byte.
+// Requests that always need a challenge start with 0xFFFFFFFF to ask for one;
+// A2S_INFO only gets one when the server wants it.
+func (c *Client) query(ctx context.Context, requestType byte, body []byte, needsChallenge bool, responseType byte) ([]byte, time.Duration, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", c.addr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("a2s: failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var challenge []byte
+	if needsChallenge {
+		challenge = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	}
+
+	for i := 0; i <= maxChallenges; i++ {
+		request := buildRequest(requestType, body, challenge)
+
+		start := time.Now()
+		if _, err := conn.Write(request); err != nil {
+			return nil, 0, fmt.Errorf("a2s: failed to send request: %w", err)
+		}
+
+		response, err := readResponse(conn)
+		if err != nil {
+			return nil, 0, err
+		}
+		ping := time.Since(start)
+
+		if len(response) == 0 {
+			return nil, 0, ErrMalformed
+		}
+
+		switch response[0] {
+		case responseType:
+			return response[1:], ping, nil
+		case responseChallenge:
+			if len(response) < 5 {
+				return nil, 0, ErrMalformed
+			}
+			challenge = response[1:5]
+		default:
+			return nil, 0, fmt.Errorf("a2s: unexpected response type 0x%02x", response[0])
+		}
+	}
+
+	return nil, 0, fmt.Errorf("a2s: server kept sending challenges")
+}
+
+func buildRequest(requestType byte, body, challenge []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(headerSimple))
+	buf.WriteByte(requestType)
+	buf.Write(body)
+	buf.Write(challenge)
+	return buf.Bytes()
+}
+
+// readResponse reads one response, reassembling it when the server split it
+// over several packets. The returned slice starts at the response type byte.
+func readResponse(conn net.Conn) ([]byte, error) {
+	packet := make([]byte, maxPacketSize)
+	n, err := conn.Read(packet)
+	if err != nil {
+		return nil, fmt.Errorf("a2s: failed to read response: %w", err)
+	}
+	packet = packet[:n]
+
+	if len(packet) < 4 {
+		return nil, ErrMalformed
+	}
+
+	switch int32(binary.LittleEndian.Uint32(packet[:4])) {
+	case headerSimple:
+		return packet[4:], nil
+	case headerSplit:
+		return readSplitResponse(conn, packet)
+	default:
+		return nil, ErrMalformed
+	}
+}
+
+type splitHeader struct {
+	id         int32
+	total      int
+	number     int
+	compressed bool
+	payload    []byte
+}
+
+// parseSplitHeader reads the Source split packet header:
+// header, ID, total, number, size, then for compressed responses the
+// decompressed size and CRC32 in the first packet.
+func parseSplitHeader(packet []byte) (*splitHeader, error) {
+	r := newReader(packet[4:])
+
+	id := r.int32()
+	total := int(r.byte())
+	number := int(r.byte())
+	r.uint16() // maximum packet size, not needed for reassembly
+	if r.err != nil || total == 0 || number >= total {
+		return nil, ErrMalformed
+	}
+
+	return &splitHeader{
+		id:         id,
+		total:      total,
+		number:     number,
+		compressed: uint32(id)&0x80000000 != 0,
+		payload:    r.rest(),
+	}, nil
+}
+
+func readSplitResponse(conn net.Conn, first []byte) ([]byte, error) {
+	header, err := parseSplitHeader(first)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([][]byte, header.total)
+	parts[header.number] = header.payload
+	received := 1
+
+	for received < header.total {
+		packet := make([]byte, maxPacketSize)
+		n, err := conn.Read(packet)
+		if err != nil {
+			return nil, fmt.Errorf("a2s: failed to read split response: %w", err)
+		}
+		packet = packet[:n]
+
+		if len(packet) < 4 || int32(binary.LittleEndian.Uint32(packet[:4])) != headerSplit {
+			return nil, ErrMalformed
+		}
+
+		part, err := parseSplitHeader(packet)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray packets of another response
+		if part.id != header.id || part.total != header.total {
+			continue
+		}
+		if parts[part.number] == nil {
+			parts[part.number] = part.payload
+			received++
+		}
+	}
+
+	payload := bytes.Join(parts, nil)
+
+	if header.compressed {
+		if len(payload) < 8 {
+			return nil, ErrMalformed
+		}
+		size := binary.LittleEndian.Uint32(payload[0:4])
+		checksum := binary.LittleEndian.Uint32(payload[4:8])
+		if size > maxDecompressedSize {
+			return nil, ErrMalformed
+		}
+
+		decompressed := make([]byte, size)
+		if _, err := io.ReadFull(bzip2.NewReader(bytes.NewReader(payload[8:])), decompressed); err != nil {
+			return nil, fmt.Errorf("a2s: failed to decompress response: %w", err)
+		}
+		if crc32.ChecksumIEEE(decompressed) != checksum {
+			return nil, fmt.Errorf("a2s: checksum mismatch in compressed response")
+		}
+		payload = decompressed
+	}
+
+	// The reassembled payload starts with the simple header again
+	if len(payload) < 4 || int32(binary.LittleEndian.Uint32(payload[:4])) != headerSimple {
+		return nil, ErrMalformed
+	}
+	return payload[4:], nil
+}
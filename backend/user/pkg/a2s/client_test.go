@@ -0,0 +1,389 @@
+package a2s
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers each query with the packets respond returns for it
+type fakeServer struct {
+	conn    *net.UDPConn
+	respond func(request []byte) [][]byte
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newFakeServer(t *testing.T, respond func(request []byte) [][]byte) *fakeServer {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &fakeServer{conn: conn, respond: respond}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		request := append([]byte(nil), buf[:n]...)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, string(request))
+		s.mu.Unlock()
+
+		for _, packet := range s.respond(request) {
+			s.conn.WriteToUDP(packet, addr)
+		}
+	}
+}
+
+func (s *fakeServer) client() *Client {
+	client := NewClient("127.0.0.1", s.conn.LocalAddr().(*net.UDPAddr).Port)
+	client.SetTimeout(500 * time.Millisecond)
+	return client
+}
+
+// received returns the queries received so far
+func (s *fakeServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func simplePacket(payload string) []byte {
+	return []byte("\xff\xff\xff\xff" + payload)
+}
+
+// splitPacket builds part number of total of the split response id
+func splitPacket(id uint32, total, number int, payload string) []byte {
+	packet := make([]byte, 12, 12+len(payload))
+	binary.LittleEndian.PutUint32(packet[0:4], uint32(0xFFFFFFFE))
+	binary.LittleEndian.PutUint32(packet[4:8], id)
+	packet[8] = byte(total)
+	packet[9] = byte(number)
+	binary.LittleEndian.PutUint16(packet[10:12], maxPacketSize)
+	return append(packet, payload...)
+}
+
+// challenged answers queries without the challenge with it, and all others
+// with packets
+func challenged(challenge string, packets ...[]byte) func([]byte) [][]byte {
+	return func(request []byte) [][]byte {
+		if !bytes.HasSuffix(request, []byte(challenge)) {
+			return [][]byte{simplePacket("A" + challenge)}
+		}
+		return packets
+	}
+}
+
+func TestQueryChallenge(t *testing.T) {
+	const challenge = "\x12\x34\x56\x78"
+	info := func(c *Client) error { _, err := c.Info(context.Background()); return err }
+	players := func(c *Client) error { _, err := c.Players(context.Background()); return err }
+
+	tests := []struct {
+		name         string
+		query        func(*Client) error
+		respond      func([]byte) [][]byte
+		wantRequests []string
+		wantErr      string
+	}{
+		{
+			name:    "info answered directly",
+			query:   info,
+			respond: func([]byte) [][]byte { return [][]byte{simplePacket("I" + capturedInfo)} },
+			wantRequests: []string{
+				"\xff\xff\xff\xffTSource Engine Query\x00",
+			},
+		},
+		{
+			name:    "info answered after a challenge",
+			query:   info,
+			respond: challenged(challenge, simplePacket("I"+capturedInfo)),
+			wantRequests: []string{
+				"\xff\xff\xff\xffTSource Engine Query\x00",
+				"\xff\xff\xff\xffTSource Engine Query\x00" + challenge,
+			},
+		},
+		{
+			name:    "players asks for a challenge first",
+			query:   players,
+			respond: challenged(challenge, simplePacket("D"+capturedPlayers)),
+			wantRequests: []string{
+				"\xff\xff\xff\xffU\xff\xff\xff\xff",
+				"\xff\xff\xff\xffU" + challenge,
+			},
+		},
+		{
+			name:    "server keeps sending challenges",
+			query:   players,
+			respond: func([]byte) [][]byte { return [][]byte{simplePacket("A" + challenge)} },
+			wantRequests: []string{
+				"\xff\xff\xff\xffU\xff\xff\xff\xff",
+				"\xff\xff\xff\xffU" + challenge,
+				"\xff\xff\xff\xffU" + challenge,
+				"\xff\xff\xff\xffU" + challenge,
+			},
+			wantErr: "kept sending challenges",
+		},
+		{
+			name:         "short challenge",
+			query:        players,
+			respond:      func([]byte) [][]byte { return [][]byte{simplePacket("A\x12\x34")} },
+			wantRequests: []string{"\xff\xff\xff\xffU\xff\xff\xff\xff"},
+			wantErr:      ErrMalformed.Error(),
+		},
+		{
+			name:         "unexpected response type",
+			query:        players,
+			respond:      func([]byte) [][]byte { return [][]byte{simplePacket("E" + capturedRules)} },
+			wantRequests: []string{"\xff\xff\xff\xffU\xff\xff\xff\xff"},
+			wantErr:      "unexpected response type 0x45",
+		},
+		{
+			name:         "no answer",
+			query:        info,
+			respond:      func([]byte) [][]byte { return nil },
+			wantRequests: []string{"\xff\xff\xff\xffTSource Engine Query\x00"},
+			wantErr:      "failed to read response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, tt.respond)
+
+			err := tt.query(server.client())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+			if requests := server.received(); !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("server received %q\nwant %q", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestInfoReportsPing(t *testing.T) {
+	server := newFakeServer(t, func([]byte) [][]byte {
+		time.Sleep(20 * time.Millisecond)
+		return [][]byte{simplePacket("I" + capturedInfo)}
+	})
+
+	info, err := server.client().Info(context.Background())
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Name != "NexArk PvE - The Island - (v358.24)" || info.Port != 7777 {
+		t.Errorf("got %+v", info)
+	}
+	if info.Ping < 20*time.Millisecond {
+		t.Errorf("ping is %v for a server that takes 20ms to answer", info.Ping)
+	}
+}
+
+// rulesResponse is capturedRules as sent, header and type byte included
+const rulesResponse = "\xff\xff\xff\xffE" + capturedRules
+
+// compressedRules is rulesResponse compressed with bzip2 -9; its CRC32 is
+// 0x72783e5e
+const compressedRules = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xce\xab\x56\x72\x00\x00" +
+	"\x1c\xcf\x80\xc8\x00\x39\x40\x2f\xa5\x8c\x00\xa6\x2f\x1e\x60\x00\x00\xa0\x00\x48" +
+	"\xa8\xd0\x32\x64\xf5\x0f\x51\xea\x1a\x69\xea\x3d\x35\x0c\x30\x4c\x09\xa6\x08\x60" +
+	"\x98\x0c\x6c\x92\xe1\x73\x82\xb7\xc3\x16\x40\x5b\x54\x76\x06\xfa\x24\x44\xeb\xc1" +
+	"\x67\x35\x93\xfe\xa5\x0f\x43\x4c\xe2\x88\xc5\x3c\x8c\x77\xdf\x9d\x0b\xb9\x22\x9c" +
+	"\x28\x48\x67\x55\xab\x39\x00"
+
+// compressedHeader is the decompressed size and CRC32 that open a compressed
+// response
+func compressedHeader(size, crc uint32) string {
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:4], size)
+	binary.LittleEndian.PutUint32(header[4:8], crc)
+	return string(header)
+}
+
+func TestSplitResponse(t *testing.T) {
+	const (
+		id           = 0x0000002a
+		otherID      = 0x0000002b
+		compressedID = 0x8000002a
+	)
+	part := func(i int) string {
+		return rulesResponse[i*20 : min((i+1)*20, len(rulesResponse))]
+	}
+	compressed := compressedHeader(uint32(len(rulesResponse)), 0x72783e5e) + compressedRules
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		wantErr string
+	}{
+		{
+			name: "in order",
+			packets: [][]byte{
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(id, 3, 1, part(1)),
+				splitPacket(id, 3, 2, part(2)),
+			},
+		},
+		{
+			name: "out of order",
+			packets: [][]byte{
+				splitPacket(id, 3, 2, part(2)),
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(id, 3, 1, part(1)),
+			},
+		},
+		{
+			name: "duplicated packet",
+			packets: [][]byte{
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(id, 3, 1, part(1)),
+				splitPacket(id, 3, 2, part(2)),
+			},
+		},
+		{
+			name: "stray packets of another response",
+			packets: [][]byte{
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(otherID, 3, 1, "stray"),
+				splitPacket(id, 3, 1, part(1)),
+				splitPacket(id, 2, 1, "stray"),
+				splitPacket(id, 3, 2, part(2)),
+			},
+		},
+		{
+			name: "compressed",
+			packets: [][]byte{
+				splitPacket(compressedID, 2, 0, compressed[:60]),
+				splitPacket(compressedID, 2, 1, compressed[60:]),
+			},
+		},
+		{
+			name: "compressed size over the limit",
+			packets: [][]byte{
+				splitPacket(compressedID, 1, 0, compressedHeader(maxDecompressedSize+1, 0x72783e5e)+compressedRules),
+			},
+			wantErr: ErrMalformed.Error(),
+		},
+		{
+			name: "compressed with a wrong checksum",
+			packets: [][]byte{
+				splitPacket(compressedID, 1, 0, compressedHeader(uint32(len(rulesResponse)), 0x72783e5f)+compressedRules),
+			},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name: "compressed size larger than the data",
+			packets: [][]byte{
+				splitPacket(compressedID, 1, 0, compressedHeader(uint32(len(rulesResponse))+1, 0x72783e5e)+compressedRules),
+			},
+			wantErr: "failed to decompress",
+		},
+		{
+			name: "compressed without its header",
+			packets: [][]byte{
+				splitPacket(compressedID, 1, 0, "BZh9"),
+			},
+			wantErr: ErrMalformed.Error(),
+		},
+		{
+			name: "packet number out of range",
+			packets: [][]byte{
+				splitPacket(id, 2, 0, part(0)),
+				splitPacket(id, 2, 2, part(1)),
+			},
+			wantErr: ErrMalformed.Error(),
+		},
+		{
+			name: "simple packet inside a split response",
+			packets: [][]byte{
+				splitPacket(id, 2, 0, part(0)),
+				simplePacket("E" + capturedRules),
+			},
+			wantErr: ErrMalformed.Error(),
+		},
+		{
+			name: "missing packet",
+			packets: [][]byte{
+				splitPacket(id, 3, 0, part(0)),
+				splitPacket(id, 3, 2, part(2)),
+			},
+			wantErr: "failed to read split response",
+		},
+		{
+			name: "reassembled without the simple header",
+			packets: [][]byte{
+				splitPacket(id, 2, 0, part(0)[4:]),
+				splitPacket(id, 2, 1, part(1)+part(2)),
+			},
+			wantErr: ErrMalformed.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, challenged("\x12\x34\x56\x78", tt.packets...))
+
+			rules, err := server.client().Rules(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, %v, want an error containing %q", rules, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rules: %v", err)
+			}
+			want := map[string]string{"ClusterId_s": "nexark", "DayTime_s": "312", "SESSIONFLAGS": "683"}
+			if !reflect.DeepEqual(rules, want) {
+				t.Errorf("got %v, want %v", rules, want)
+			}
+		})
+	}
+}
+
+func TestQueryHonoursContextDeadline(t *testing.T) {
+	server := newFakeServer(t, func([]byte) [][]byte { return nil })
+	client := server.client()
+	client.SetTimeout(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Info(ctx)
+	if err == nil {
+		t.Fatal("Info succeeded against a server that never answers")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Info took %v with a 100ms deadline", elapsed)
+	}
+}
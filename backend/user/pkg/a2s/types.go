@@ -0,0 +1,257 @@
+package a2s
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Info is the A2S_INFO response
+type Info struct {
+	Protocol    byte          `json:"protocol"`
+	Name        string        `json:"name"`
+	Map         string        `json:"map"`
+	Folder      string        `json:"folder"`
+	Game        string        `json:"game"`
+	AppID       uint16        `json:"app_id"`
+	Players     int           `json:"players"`
+	MaxPlayers  int           `json:"max_players"`
+	Bots        int           `json:"bots"`
+	ServerType  string        `json:"server_type"`
+	Environment string        `json:"environment"`
+	Password    bool          `json:"password"`
+	VAC         bool          `json:"vac"`
+	Version     string        `json:"version"`
+	Port        uint16        `json:"port,omitempty"`
+	SteamID     uint64        `json:"steam_id,omitempty"`
+	Keywords    string        `json:"keywords,omitempty"`
+	GameID      uint64        `json:"game_id,omitempty"`
+	Ping        time.Duration `json:"ping"`
+}
+
+// Player is one entry of the A2S_PLAYER response
+type Player struct {
+	Index    int           `json:"index"`
+	Name     string        `json:"name"`
+	Score    int32         `json:"score"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Extra data flags of A2S_INFO
+const (
+	edfPort     = 0x80
+	edfSteamID  = 0x10
+	edfSourceTV = 0x40
+	edfKeywords = 0x20
+	edfGameID   = 0x01
+)
+
+func parseInfo(payload []byte) (*Info, error) {
+	r := newReader(payload)
+
+	info := &Info{
+		Protocol: r.byte(),
+		Name:     r.string(),
+		Map:      r.string(),
+		Folder:   r.string(),
+		Game:     r.string(),
+		AppID:    r.uint16(),
+	}
+	info.Players = int(r.byte())
+	info.MaxPlayers = int(r.byte())
+	info.Bots = int(r.byte())
+	info.ServerType = serverType(r.byte())
+	info.Environment = environment(r.byte())
+	info.Password = r.byte() == 1
+	info.VAC = r.byte() == 1
+	info.Version = r.string()
+
+	if r.err != nil {
+		return nil, ErrMalformed
+	}
+
+	// The extra data flag is optional
+	if r.remaining() == 0 {
+		return info, nil
+	}
+
+	edf := r.byte()
+	if edf&edfPort != 0 {
+		info.Port = r.uint16()
+	}
+	if edf&edfSteamID != 0 {
+		info.SteamID = r.uint64()
+	}
+	if edf&edfSourceTV != 0 {
+		r.uint16()
+		r.string()
+	}
+	if edf&edfKeywords != 0 {
+		info.Keywords = r.string()
+	}
+	if edf&edfGameID != 0 {
+		info.GameID = r.uint64()
+	}
+
+	if r.err != nil {
+		return nil, ErrMalformed
+	}
+	return info, nil
+}
+
+func parsePlayers(payload []byte) ([]Player, error) {
+	r := newReader(payload)
+
+	count := int(r.byte())
+	players := make([]Player, 0, count)
+	for i := 0; i < count && r.remaining() > 0; i++ {
+		player := Player{
+			Index: int(r.byte()),
+			Name:  r.string(),
+			Score: r.int32(),
+		}
+		seconds := r.float32()
+		if !math.IsNaN(float64(seconds)) && seconds > 0 {
+			player.Duration = time.Duration(float64(seconds) * float64(time.Second))
+		}
+
+		if r.err != nil {
+			return nil, ErrMalformed
+		}
+		players = append(players, player)
+	}
+
+	return players, nil
+}
+
+func parseRules(payload []byte) (map[string]string, error) {
+	r := newReader(payload)
+
+	count := int(r.uint16())
+	rules := make(map[string]string, count)
+	// Some servers truncate long rule lists, so stop at the end of the data
+	for i := 0; i < count && r.remaining() > 0; i++ {
+		name := r.string()
+		value := r.string()
+		if r.err != nil {
+			break
+		}
+		rules[name] = value
+	}
+
+	if r.err != nil && len(rules) == 0 {
+		return nil, ErrMalformed
+	}
+	return rules, nil
+}
+
+func serverType(b byte) string {
+	switch b {
+	case 'd':
+		return "dedicated"
+	case 'l':
+		return "listen"
+	case 'p':
+		return "proxy"
+	default:
+		return "unknown"
+	}
+}
+
+func environment(b byte) string {
+	switch b {
+	case 'l':
+		return "linux"
+	case 'w':
+		return "windows"
+	case 'm', 'o':
+		return "mac"
+	default:
+		return "unknown"
+	}
+}
+
+// reader decodes little-endian values; after the first error every read
+// returns zero values and err stays set.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newReader(data []byte) *reader {
+	return &reader{data: data}
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = ErrMalformed
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) rest() []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := r.data[r.pos:]
+	r.pos = len(r.data)
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *reader) float32() float32 {
+	if b := r.next(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		r.err = ErrMalformed
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s
+}
@@ -0,0 +1,284 @@
+package a2s
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Payloads below are responses of an ARK server after the header and type
+// byte, as the client hands them to the parsers.
+
+const infoBase = "\x11" + // protocol
+	"NexArk PvE - The Island - (v358.24)\x00" +
+	"TheIsland\x00" +
+	"ark_survival_evolved\x00" +
+	"ARK: Survival Evolved\x00" +
+	"\x00\x00" + // app ID
+	"\x17" + // players
+	"\x46" + // max players
+	"\x00" + // bots
+	"d" + "l" +
+	"\x00" + // password
+	"\x01" + // VAC
+	"1.0.0.0\x00"
+
+const infoKeywords = ",OWNINGID:90171234,OWNINGNAME:90171234,NUMOPENPUBCONN:47,P2PADDR:90171234,P2PPORT:7777,LEGACY_i:0"
+
+// capturedInfo carries the port, Steam ID, keywords and game ID
+const capturedInfo = infoBase + "\xb1" +
+	"\x61\x1e" +
+	"\x3b\x1a\x2d\x4f\x01\x00\x10\x01" +
+	infoKeywords + "\x00" +
+	"\xfe\x47\x05\x00\x00\x00\x00\x00"
+
+func TestParseInfo(t *testing.T) {
+	base := Info{
+		Protocol:    0x11,
+		Name:        "NexArk PvE - The Island - (v358.24)",
+		Map:         "TheIsland",
+		Folder:      "ark_survival_evolved",
+		Game:        "ARK: Survival Evolved",
+		Players:     23,
+		MaxPlayers:  70,
+		ServerType:  "dedicated",
+		Environment: "linux",
+		VAC:         true,
+		Version:     "1.0.0.0",
+	}
+	withEDF := func(port uint16, steamID uint64, keywords string, gameID uint64) *Info {
+		info := base
+		info.Port = port
+		info.SteamID = steamID
+		info.Keywords = keywords
+		info.GameID = gameID
+		return &info
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    *Info
+	}{
+		{
+			name:    "without extra data",
+			payload: infoBase,
+			want:    withEDF(0, 0, "", 0),
+		},
+		{
+			name:    "port, Steam ID, keywords and game ID",
+			payload: capturedInfo,
+			want:    withEDF(7777, 0x011000014f2d1a3b, infoKeywords, 346110),
+		},
+		{
+			name:    "SourceTV is skipped",
+			payload: infoBase + "\xe0" + "\x61\x1e" + "\x88\x13" + "SourceTV\x00" + "pve\x00",
+			want:    withEDF(7777, 0, "pve", 0),
+		},
+		{
+			name:    "flags without data",
+			payload: infoBase + "\x00",
+			want:    withEDF(0, 0, "", 0),
+		},
+		{
+			name:    "truncated before the version",
+			payload: infoBase[:len(infoBase)-4],
+		},
+		{
+			name:    "flag set but its data missing",
+			payload: infoBase + "\x81" + "\x61\x1e",
+		},
+		{
+			name:    "unterminated keywords",
+			payload: infoBase + "\x20" + "pve",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseInfo([]byte(tt.payload))
+			if tt.want == nil {
+				if !errors.Is(err, ErrMalformed) {
+					t.Fatalf("got %+v, %v, want ErrMalformed", info, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInfo: %v", err)
+			}
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("got %+v\nwant %+v", info, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInfoServerTypeAndEnvironment(t *testing.T) {
+	tests := []struct {
+		serverType, environment         byte
+		wantServerType, wantEnvironment string
+	}{
+		{'d', 'l', "dedicated", "linux"},
+		{'l', 'w', "listen", "windows"},
+		{'p', 'm', "proxy", "mac"},
+		{'d', 'o', "dedicated", "mac"},
+		{'x', 'x', "unknown", "unknown"},
+	}
+
+	for _, tt := range tests {
+		payload := []byte(infoBase)
+		offset := len(infoBase) - len("dl\x00\x011.0.0.0\x00")
+		payload[offset] = tt.serverType
+		payload[offset+1] = tt.environment
+
+		info, err := parseInfo(payload)
+		if err != nil {
+			t.Fatalf("parseInfo: %v", err)
+		}
+		if info.ServerType != tt.wantServerType || info.Environment != tt.wantEnvironment {
+			t.Errorf("%q %q: got %s on %s, want %s on %s", tt.serverType, tt.environment,
+				info.ServerType, info.Environment, tt.wantServerType, tt.wantEnvironment)
+		}
+	}
+}
+
+// capturedPlayers lists two players; the second joined a moment ago and has
+// no name yet
+const capturedPlayers = "\x02" +
+	"\x00" + "Rex Tamer\x00" + "\x00\x00\x00\x00" + "\x00\x10\x61\x45" +
+	"\x00" + "\x00" + "\x00\x00\x00\x00" + "\x00\x00\x40\x40"
+
+func TestParsePlayers(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []Player
+		wantErr bool
+	}{
+		{
+			name:    "captured",
+			payload: capturedPlayers,
+			want: []Player{
+				{Name: "Rex Tamer", Duration: 3601 * time.Second},
+				{Name: "", Duration: 3 * time.Second},
+			},
+		},
+		{
+			name:    "score",
+			payload: "\x01" + "\x00" + "Rex Tamer\x00" + "\xfe\xff\xff\xff" + "\x00\x00\x80\x3f",
+			want:    []Player{{Name: "Rex Tamer", Score: -2, Duration: time.Second}},
+		},
+		{
+			name:    "negative and NaN durations read as zero",
+			payload: "\x02" + "\x00" + "a\x00" + "\x00\x00\x00\x00" + "\x00\x00\x80\xbf" + "\x00" + "b\x00" + "\x00\x00\x00\x00" + "\x00\x00\xc0\x7f",
+			want:    []Player{{Name: "a"}, {Name: "b"}},
+		},
+		{
+			name:    "count larger than the list",
+			payload: "\x05" + capturedPlayers[1:],
+			want: []Player{
+				{Name: "Rex Tamer", Duration: 3601 * time.Second},
+				{Name: "", Duration: 3 * time.Second},
+			},
+		},
+		{
+			name:    "no players",
+			payload: "\x00",
+			want:    []Player{},
+		},
+		{
+			name:    "entry cut short",
+			payload: capturedPlayers[:len(capturedPlayers)-2],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players, err := parsePlayers([]byte(tt.payload))
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformed) {
+					t.Fatalf("got %+v, %v, want ErrMalformed", players, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePlayers: %v", err)
+			}
+			if !reflect.DeepEqual(players, tt.want) {
+				t.Errorf("got %+v\nwant %+v", players, tt.want)
+			}
+		})
+	}
+}
+
+const capturedRules = "\x03\x00" +
+	"ClusterId_s\x00nexark\x00" +
+	"DayTime_s\x00312\x00" +
+	"SESSIONFLAGS\x00683\x00"
+
+func TestParseRules(t *testing.T) {
+	all := map[string]string{"ClusterId_s": "nexark", "DayTime_s": "312", "SESSIONFLAGS": "683"}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]string
+	}{
+		{
+			name:    "captured",
+			payload: capturedRules,
+			want:    all,
+		},
+		{
+			name:    "count larger than the list",
+			payload: "\x40\x00" + capturedRules[2:],
+			want:    all,
+		},
+		{
+			name:    "truncated inside a value",
+			payload: capturedRules[:len(capturedRules)-2],
+			want:    map[string]string{"ClusterId_s": "nexark", "DayTime_s": "312"},
+		},
+		{
+			name:    "truncated inside a name",
+			payload: "\x03\x00" + "ClusterId_s\x00nexark\x00" + "DayT",
+			want:    map[string]string{"ClusterId_s": "nexark"},
+		},
+		{
+			name:    "no rules",
+			payload: "\x00\x00",
+			want:    map[string]string{},
+		},
+		{
+			name:    "truncated inside the first rule",
+			payload: "\x03\x00" + "ClusterId_s\x00nex",
+		},
+		{
+			name:    "truncated count",
+			payload: "\x03",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules([]byte(tt.payload))
+			if tt.want == nil {
+				if !errors.Is(err, ErrMalformed) {
+					t.Fatalf("got %v, %v, want ErrMalformed", rules, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRules: %v", err)
+			}
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("got %v, want %v", rules, tt.want)
+			}
+		})
+	}
+}
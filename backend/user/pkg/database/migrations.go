@@ -29,12 +29,7 @@ func RunMigrations(db *gorm.DB, dir string) error {
 			return fmt.Errorf("failed to read migration file %s: %w", path, err)
 		}
 
-		statements := strings.Split(string(content), ";")
-		for _, stmt := range statements {
-			stmt = strings.TrimSpace(stmt)
-			if stmt == "" {
-				continue
-			}
+		for _, stmt := range SplitStatements(string(content)) {
 			if _, err := sqlDB.Exec(stmt); err != nil {
 				log.Printf("Failed to execute statement from %s: %s", path, stmt)
 				return fmt.Errorf("failed to execute migration from %s: %w", path, err)
@@ -65,3 +60,17 @@ func RunMigrations(db *gorm.DB, dir string) error {
 
 	return nil
 }
+
+// SplitStatements splits a migration file the way RunMigrations executes it:
+// on every ';', with empty statements dropped. A ';' inside a comment splits
+// too, so comments must not contain one.
+func SplitStatements(content string) []string {
+	var statements []string
+	for _, stmt := range strings.Split(content, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every statement RunMigrations executes must contain SQL. A ';' inside a
+// comment leaves a comment-only statement, which MySQL rejects halfway through
+// the file.
+func TestMigrationStatementsContainSQL(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, stmt := range SplitStatements(string(content)) {
+			if !containsSQL(stmt) {
+				t.Errorf("%s: statement %d is only comments, is there a ';' in a comment?\n%s",
+					filepath.Base(file), i+1, stmt)
+			}
+		}
+	}
+}
+
+func containsSQL(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
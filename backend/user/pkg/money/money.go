@@ -0,0 +1,127 @@
+// Package money holds amounts of credits and prices as integer minor units so
+// that sums and comparisons are exact.
+package money
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency is the currency every amount is in. Credits are worth one baht and
+// amounts count satang, its minor unit.
+const Currency = "thb"
+
+// minorUnits is the number of minor units in one baht
+const minorUnits = 100
+
+// Amount is an amount of money in satang. It is stored as a BIGINT and written
+// to JSON as a decimal number of baht, e.g. 12.50.
+type Amount int64
+
+// FromMinor returns the amount of minor units
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// FromBaht returns a whole number of baht
+func FromBaht(baht int64) Amount {
+	return Amount(baht * minorUnits)
+}
+
+// Parse reads a decimal amount of baht such as "12", "-0.5" or "1234.56".
+// More than two decimal places is an error rather than being rounded.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(s, "-")
+
+	whole, fraction, hasFraction := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || hasFraction && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("invalid amount %q: more than two decimal places", s)
+	}
+	for _, part := range []string{whole, fraction} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	fraction += strings.Repeat("0", 2-len(fraction))
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Amount(minor), nil
+}
+
+// Minor returns the amount in minor units, as Stripe expects it
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Baht returns the whole baht in the amount, truncated toward zero
+func (a Amount) Baht() int64 {
+	return int64(a) / minorUnits
+}
+
+// Mul returns the amount multiplied by a quantity
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// Percent returns percent of the amount, rounded half away from zero to the
+// satang. percent has two decimals like an Amount, so 12.50 is 12.5%.
+func (a Amount) Percent(percent Amount) Amount {
+	product := int64(a) * int64(percent)
+	const scale = 100 * minorUnits
+	if product < 0 {
+		return Amount((product - scale/2) / scale)
+	}
+	return Amount((product + scale/2) / scale)
+}
+
+// String formats the amount in baht with two decimals
+func (a Amount) String() string {
+	minor := int64(a)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/minorUnits, minor%minorUnits)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		unquoted, err := strconv.Unquote(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid amount %s", data)
+		}
+		data = []byte(unquoted)
+	}
+
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
@@ -1,9 +1,15 @@
 package rcon
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -15,12 +21,20 @@ const (
 	SERVERDATA_RESPONSE_VALUE = 0
 )
 
+// maxPacketSize bounds the size field of incoming packets. Source servers
+// split responses into 4096 byte bodies, but ARK sends larger single packets,
+// such as ListPlayers on a full server, so the cap only guards against a
+// corrupt size field.
+const maxPacketSize = 1 << 20
+
 type RCONClient struct {
 	conn          net.Conn
+	reader        *bufio.Reader
 	host          string
 	port          string
 	password      string
 	timeout       time.Duration
+	responseIdle  time.Duration
 	authenticated bool
 	requestID     int32
 }
@@ -41,22 +55,35 @@ type RCONResponse struct {
 
 func NewRCONClient(host, port, password string) *RCONClient {
 	return &RCONClient{
-		host:      host,
-		port:      port,
-		password:  password,
-		timeout:   10 * time.Second,
-		requestID: 1,
+		host:         host,
+		port:         port,
+		password:     password,
+		timeout:      10 * time.Second,
+		responseIdle: 500 * time.Millisecond,
+		requestID:    1,
 	}
 }
 
 func (r *RCONClient) Connect() error {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%s", r.host, r.port), r.timeout)
+	return r.ConnectContext(context.Background())
+}
+
+// ConnectContext dials and authenticates, giving up when ctx is done
+func (r *RCONClient) ConnectContext(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: r.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%s", r.host, r.port))
 	if err != nil {
 		return fmt.Errorf("failed to connect to RCON server: %w", err)
 	}
 
 	r.conn = conn
-	return r.authenticate()
+	r.reader = bufio.NewReader(conn)
+	r.setDeadline(ctx)
+	if err := r.authenticate(); err != nil {
+		r.markBroken()
+		return err
+	}
+	return nil
 }
 
 func (r *RCONClient) authenticate() error {
@@ -70,14 +97,22 @@ func (r *RCONClient) authenticate() error {
 		return fmt.Errorf("failed to send auth packet: %w", err)
 	}
 
-	// Read auth response
-	response, err := r.readPacket()
-	if err != nil {
-		return fmt.Errorf("failed to read auth response: %w", err)
-	}
+	// Source servers send an empty RESPONSE_VALUE ahead of the AUTH_RESPONSE
+	for {
+		response, _, err := r.readPacket()
+		if err != nil {
+			return fmt.Errorf("failed to read auth response: %w", err)
+		}
+
+		if response.Type != SERVERDATA_AUTH_RESPONSE {
+			continue
+		}
 
-	if response.ID != packet.ID {
-		return fmt.Errorf("authentication failed: invalid response ID")
+		// The server answers a wrong password with ID -1
+		if response.ID != packet.ID {
+			return fmt.Errorf("authentication failed: invalid response ID")
+		}
+		break
 	}
 
 	r.authenticated = true
@@ -85,90 +120,201 @@ func (r *RCONClient) authenticate() error {
 }
 
 func (r *RCONClient) ExecuteCommand(command string) (*RCONResponse, error) {
+	return r.ExecuteCommandContext(context.Background(), command)
+}
+
+// ExecuteCommandContext runs command with the deadline of ctx, or the client
+// timeout when ctx has none. The client must not be used concurrently.
+func (r *RCONClient) ExecuteCommandContext(ctx context.Context, command string) (*RCONResponse, error) {
+	response, _, err := r.execute(ctx, command)
+	return response, err
+}
+
+// execute also reports whether the command reached the server, so callers know
+// if it is safe to retry on another connection.
+//
+// Long responses are split over several RESPONSE_VALUE packets. To find the
+// end, the command is followed by an empty RESPONSE_VALUE packet: the server
+// mirrors it only after the full response, so everything before the mirror
+// belongs to the command. Servers that don't mirror it (some ARK builds) are
+// handled by returning once no packet has arrived for responseIdle.
+func (r *RCONClient) execute(ctx context.Context, command string) (*RCONResponse, bool, error) {
 	if !r.authenticated {
-		return nil, fmt.Errorf("not authenticated")
+		return nil, false, fmt.Errorf("not authenticated")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
 	}
+	r.setDeadline(ctx)
 
 	packet := &RCONPacket{
 		ID:   r.getNextRequestID(),
 		Type: SERVERDATA_EXECCOMMAND,
 		Body: command,
 	}
+	sentinel := &RCONPacket{
+		ID:   r.getNextRequestID(),
+		Type: SERVERDATA_RESPONSE_VALUE,
+	}
 
-	if err := r.sendPacket(packet); err != nil {
+	if err := r.sendPacket(packet, sentinel); err != nil {
+		r.markBroken()
 		return &RCONResponse{
 			Success: false,
 			Error:   fmt.Sprintf("failed to send command: %v", err),
-		}, err
+		}, false, err
 	}
 
-	response, err := r.readPacket()
+	body, err := r.readResponse(ctx, packet.ID, sentinel.ID)
 	if err != nil {
+		r.markBroken()
 		return &RCONResponse{
 			Success: false,
 			Error:   fmt.Sprintf("failed to read response: %v", err),
-		}, err
+		}, true, err
 	}
 
 	return &RCONResponse{
 		Success:  true,
-		Response: response.Body,
-	}, nil
+		Response: body,
+	}, true, nil
 }
 
-func (r *RCONClient) sendPacket(packet *RCONPacket) error {
-	packet.Size = int32(len(packet.Body) + 10) // 4 + 4 + len(body) + 1 + 1
+// readResponse collects the packets answering requestID until the sentinel is
+// mirrored. Packets with other IDs are leftovers of earlier requests, such as
+// the extra packet Source servers send after a mirrored sentinel, and are skipped.
+func (r *RCONClient) readResponse(ctx context.Context, requestID, sentinelID int32) (string, error) {
+	var body strings.Builder
+	received := false
 
-	if err := binary.Write(r.conn, binary.LittleEndian, packet.Size); err != nil {
-		return err
-	}
-	if err := binary.Write(r.conn, binary.LittleEndian, packet.ID); err != nil {
-		return err
-	}
-	if err := binary.Write(r.conn, binary.LittleEndian, packet.Type); err != nil {
-		return err
-	}
-	if _, err := r.conn.Write([]byte(packet.Body)); err != nil {
-		return err
-	}
-	if err := binary.Write(r.conn, binary.LittleEndian, byte(0)); err != nil {
-		return err
-	}
-	if err := binary.Write(r.conn, binary.LittleEndian, byte(0)); err != nil {
-		return err
-	}
+	for {
+		if received {
+			// Wait briefly for more packets once a response has started
+			deadline := time.Now().Add(r.responseIdle)
+			if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+				deadline = ctxDeadline
+			}
+			r.conn.SetReadDeadline(deadline)
+		}
 
-	return nil
+		response, n, err := r.readPacket()
+		if err != nil {
+			// Nothing more arrived and the stream is still aligned on a packet boundary
+			if received && n == 0 && isTimeout(err) && ctx.Err() == nil {
+				r.setDeadline(ctx)
+				return body.String(), nil
+			}
+			return "", err
+		}
+
+		switch response.ID {
+		case requestID:
+			body.WriteString(response.Body)
+			received = true
+		case sentinelID:
+			r.setDeadline(ctx)
+			return body.String(), nil
+		}
+	}
 }
 
-func (r *RCONClient) readPacket() (*RCONPacket, error) {
-	var size, id, packetType int32
+// sendPacket writes packets in a single write so a command and its sentinel
+// arrive together.
+func (r *RCONClient) sendPacket(packets ...*RCONPacket) error {
+	var buf bytes.Buffer
+	for _, packet := range packets {
+		packet.Size = int32(len(packet.Body) + 10) // 4 + 4 + len(body) + 1 + 1
 
-	if err := binary.Read(r.conn, binary.LittleEndian, &size); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(r.conn, binary.LittleEndian, &id); err != nil {
-		return nil, err
+		binary.Write(&buf, binary.LittleEndian, packet.Size)
+		binary.Write(&buf, binary.LittleEndian, packet.ID)
+		binary.Write(&buf, binary.LittleEndian, packet.Type)
+		buf.WriteString(packet.Body)
+		buf.Write([]byte{0, 0})
 	}
-	if err := binary.Read(r.conn, binary.LittleEndian, &packetType); err != nil {
-		return nil, err
+
+	_, err := r.conn.Write(buf.Bytes())
+	return err
+}
+
+// readPacket reads one whole packet. It also returns the number of bytes read,
+// so a timeout between packets can be told apart from one mid-packet.
+func (r *RCONClient) readPacket() (*RCONPacket, int, error) {
+	header := make([]byte, 12)
+	n, err := io.ReadFull(r.reader, header)
+	if err != nil {
+		return nil, n, err
 	}
 
-	bodySize := size - 10
-	body := make([]byte, bodySize)
-	if _, err := r.conn.Read(body); err != nil {
-		return nil, err
+	size := int32(binary.LittleEndian.Uint32(header[0:4]))
+	id := int32(binary.LittleEndian.Uint32(header[4:8]))
+	packetType := int32(binary.LittleEndian.Uint32(header[8:12]))
+
+	// Size counts the ID, type, body and two null terminators
+	if size < 10 || size > maxPacketSize {
+		return nil, n, fmt.Errorf("invalid packet size %d", size)
 	}
 
-	// Remove null terminators
-	bodyStr := string(body[:len(body)-2])
+	body := make([]byte, size-8)
+	m, err := io.ReadFull(r.reader, body)
+	if err != nil {
+		return nil, n + m, err
+	}
 
 	return &RCONPacket{
 		Size: size,
 		ID:   id,
 		Type: packetType,
-		Body: bodyStr,
-	}, nil
+		Body: string(bytes.TrimRight(body, "\x00")),
+	}, n + m, nil
+}
+
+func (r *RCONClient) setDeadline(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(r.timeout)
+	}
+	r.conn.SetDeadline(deadline)
+}
+
+// markBroken closes a connection after an I/O error; its stream position is unknown
+func (r *RCONClient) markBroken() {
+	r.authenticated = false
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+// alive checks without blocking whether the server closed an idle connection,
+// so a command is never written to a connection that is already gone. Packets
+// waiting on an idle connection are leftovers of earlier requests, such as the
+// one Source servers send after a mirrored sentinel, and are discarded.
+func (r *RCONClient) alive() bool {
+	if !r.IsConnected() {
+		return false
+	}
+
+	for {
+		r.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+		if _, err := r.reader.Peek(1); err != nil {
+			if isTimeout(err) {
+				return true
+			}
+			r.markBroken()
+			return false
+		}
+
+		r.conn.SetReadDeadline(time.Now().Add(r.responseIdle))
+		if _, _, err := r.readPacket(); err != nil {
+			r.markBroken()
+			return false
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 func (r *RCONClient) getNextRequestID() int32 {
@@ -0,0 +1,82 @@
+package rcon_test
+
+import (
+	"strings"
+	"testing"
+
+	"nexark-user-backend/pkg/rcon"
+	"nexark-user-backend/pkg/rcon/rcontest"
+)
+
+func connect(t *testing.T, server *rcontest.Server, password string) *rcon.RCONClient {
+	t.Helper()
+
+	client := rcon.NewRCONClient(server.Host(), server.Port(), password)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientReassemblesMultiPacketResponse(t *testing.T) {
+	for _, mirror := range []bool{true, false} {
+		name := "sentinel mirrored"
+		if !mirror {
+			name = "sentinel ignored"
+		}
+		t.Run(name, func(t *testing.T) {
+			server := rcontest.NewServer("secret")
+			defer server.Close()
+			server.SetSentinelMirroring(mirror)
+			server.SetMaxPacketBody(100)
+
+			want := strings.Repeat("0123456789", 250)
+			server.Handle("GetChat", want)
+
+			client := connect(t, server, "secret")
+			for i := 0; i < 2; i++ {
+				response, err := client.ExecuteCommand("GetChat")
+				if err != nil {
+					t.Fatalf("ExecuteCommand: %v", err)
+				}
+				if response.Response != want {
+					t.Fatalf("got %d bytes, want the %d bytes sent over %d packets",
+						len(response.Response), len(want), len(want)/100)
+				}
+			}
+		})
+	}
+}
+
+func TestClientAcceptsPacketsLargerThan4KiB(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.SetMaxPacketBody(64 * 1024)
+
+	want := strings.Repeat("x", 64*1024)
+	server.Handle("ListPlayers", want)
+
+	client := connect(t, server, "secret")
+	response, err := client.ExecuteCommand("ListPlayers")
+	if err != nil {
+		t.Fatalf("ExecuteCommand: %v", err)
+	}
+	if len(response.Response) != len(want) {
+		t.Fatalf("got %d bytes, want %d", len(response.Response), len(want))
+	}
+}
+
+func TestClientAuthFailure(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+
+	client := rcon.NewRCONClient(server.Host(), server.Port(), "wrong")
+	err := client.Connect()
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("Connect with a wrong password: got %v, want an authentication error", err)
+	}
+	if client.IsConnected() {
+		t.Error("client reports connected after failed authentication")
+	}
+}
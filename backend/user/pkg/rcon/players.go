@@ -0,0 +1,69 @@
+package rcon
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Player is one entry of the ARK "ListPlayers" command output
+type Player struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	// ID is the Steam ID on ARK: Survival Evolved and the EOS ID on Survival Ascended
+	ID string `json:"id"`
+}
+
+// ParseListPlayers parses ListPlayers output, which looks like
+//
+//  0. SomePlayer, 76561198000000000
+//  1. Other, Player, 0002a1b2c3d4e5f60718293a4b5c6d7e
+//
+// Names may contain commas, so the ID is taken after the last one. An empty
+// server answers "No Players Connected", which yields no players.
+func ParseListPlayers(response string) []Player {
+	var players []Player
+
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+
+		dot := strings.Index(line, ". ")
+		if dot <= 0 {
+			continue
+		}
+		index, err := strconv.Atoi(line[:dot])
+		if err != nil {
+			continue
+		}
+
+		rest := line[dot+2:]
+		comma := strings.LastIndex(rest, ",")
+		if comma < 0 {
+			continue
+		}
+
+		id := strings.TrimSpace(rest[comma+1:])
+		if id == "" {
+			continue
+		}
+
+		players = append(players, Player{
+			Index: index,
+			Name:  strings.TrimSpace(rest[:comma]),
+			ID:    id,
+		})
+	}
+
+	return players
+}
+
+// FindPlayer returns the first player whose ID matches one of ids
+func FindPlayer(players []Player, ids ...string) (*Player, bool) {
+	for i := range players {
+		for _, id := range ids {
+			if id != "" && strings.EqualFold(players[i].ID, id) {
+				return &players[i], true
+			}
+		}
+	}
+	return nil, false
+}
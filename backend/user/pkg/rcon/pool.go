@@ -0,0 +1,393 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolClosed is returned by Execute after Close
+var ErrPoolClosed = errors.New("rcon pool is closed")
+
+// PoolConfig configures a connection pool for one RCON server
+type PoolConfig struct {
+	Host     string
+	Port     string
+	Password string
+
+	// MaxConns caps the connections open to the server at once
+	MaxConns int
+	// CommandTimeout applies to commands whose context has no deadline
+	CommandTimeout time.Duration
+	// KeepAliveInterval is how often idle connections are pinged; 0 disables it
+	KeepAliveInterval time.Duration
+	// IdleTimeout closes connections that haven't been used for this long
+	IdleTimeout time.Duration
+	// KeepAliveCommand is sent as the ping; an empty command is answered by
+	// Source RCON servers without side effects.
+	KeepAliveCommand string
+}
+
+// PoolStats is a snapshot of pool usage
+type PoolStats struct {
+	MaxConns      int           `json:"max_conns"`
+	OpenConns     int           `json:"open_conns"`
+	IdleConns     int           `json:"idle_conns"`
+	InUse         int           `json:"in_use"`
+	Waiting       int64         `json:"waiting"`
+	WaitCount     int64         `json:"wait_count"`
+	WaitDuration  time.Duration `json:"wait_duration"`
+	Commands      int64         `json:"commands"`
+	Failures      int64         `json:"failures"`
+	Dials         int64         `json:"dials"`
+	DialFailures  int64         `json:"dial_failures"`
+	Reconnects    int64         `json:"reconnects"`
+	KeepAlives    int64         `json:"keepalives"`
+	ClosedBroken  int64         `json:"closed_broken"`
+	ClosedExpired int64         `json:"closed_expired"`
+}
+
+type pooledConn struct {
+	client   *RCONClient
+	lastUsed time.Time
+}
+
+// Pool hands out RCON connections to one server so that commands can run
+// concurrently; an RCONClient itself only serves one command at a time.
+type Pool struct {
+	cfg PoolConfig
+
+	// slots holds one token per connection that may be open
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*pooledConn
+	open   int
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+
+	waiting       atomic.Int64
+	waitCount     atomic.Int64
+	waitDuration  atomic.Int64
+	commands      atomic.Int64
+	failures      atomic.Int64
+	dials         atomic.Int64
+	dialFailures  atomic.Int64
+	reconnects    atomic.Int64
+	keepAlives    atomic.Int64
+	closedBroken  atomic.Int64
+	closedExpired atomic.Int64
+}
+
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = 4
+	}
+	if cfg.CommandTimeout <= 0 {
+		cfg.CommandTimeout = 10 * time.Second
+	}
+
+	p := &Pool{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxConns),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go p.maintain()
+
+	return p
+}
+
+// Config returns the configuration the pool was created with
+func (p *Pool) Config() PoolConfig {
+	return p.cfg
+}
+
+// Execute runs command on a pooled connection. A command that could not be
+// sent because a reused connection had gone stale is retried once on a fresh
+// connection; a command that was sent is never repeated.
+func (p *Pool) Execute(ctx context.Context, command string) (*RCONResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.CommandTimeout)
+		defer cancel()
+	}
+
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+
+	p.commands.Add(1)
+
+	conn, reused, err := p.getConn(ctx)
+	if err != nil {
+		p.failures.Add(1)
+		return nil, err
+	}
+
+	response, sent, err := conn.client.execute(ctx, command)
+	if err != nil && reused && !sent && ctx.Err() == nil {
+		// The idle connection was dropped by the server (e.g. after a restart)
+		p.discard(conn)
+		p.reconnects.Add(1)
+
+		conn, err = p.dial(ctx)
+		if err != nil {
+			p.failures.Add(1)
+			return nil, err
+		}
+		response, _, err = conn.client.execute(ctx, command)
+	}
+
+	if err != nil {
+		p.failures.Add(1)
+		p.discard(conn)
+		return response, err
+	}
+
+	p.putIdle(conn)
+	return response, nil
+}
+
+// Stats returns a snapshot of pool usage
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	open := p.open
+	idle := len(p.idle)
+	p.mu.Unlock()
+
+	return PoolStats{
+		MaxConns:      p.cfg.MaxConns,
+		OpenConns:     open,
+		IdleConns:     idle,
+		InUse:         open - idle,
+		Waiting:       p.waiting.Load(),
+		WaitCount:     p.waitCount.Load(),
+		WaitDuration:  time.Duration(p.waitDuration.Load()),
+		Commands:      p.commands.Load(),
+		Failures:      p.failures.Load(),
+		Dials:         p.dials.Load(),
+		DialFailures:  p.dialFailures.Load(),
+		Reconnects:    p.reconnects.Load(),
+		KeepAlives:    p.keepAlives.Load(),
+		ClosedBroken:  p.closedBroken.Load(),
+		ClosedExpired: p.closedExpired.Load(),
+	}
+}
+
+// Close closes idle connections and stops the keepalive loop. Connections in
+// use are closed when they are returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	for _, conn := range idle {
+		conn.client.Close()
+	}
+	return nil
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	// All connections are busy; wait for one to be released
+	start := time.Now()
+	p.waiting.Add(1)
+	defer func() {
+		p.waiting.Add(-1)
+		p.waitCount.Add(1)
+		p.waitDuration.Add(int64(time.Since(start)))
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for an RCON connection: %w", ctx.Err())
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+}
+
+// getConn returns an idle connection, or dials a new one. reused reports
+// whether the connection was idle, and so may have gone stale.
+func (p *Pool) getConn(ctx context.Context) (*pooledConn, bool, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, false, ErrPoolClosed
+	}
+	for len(p.idle) > 0 {
+		n := len(p.idle)
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if conn.client.alive() {
+			return conn, true, nil
+		}
+
+		// Closed by the server while idle (e.g. after a restart)
+		p.discard(conn)
+		p.reconnects.Add(1)
+		p.mu.Lock()
+	}
+	p.mu.Unlock()
+
+	conn, err := p.dial(ctx)
+	return conn, false, err
+}
+
+func (p *Pool) dial(ctx context.Context) (*pooledConn, error) {
+	p.dials.Add(1)
+
+	client := NewRCONClient(p.cfg.Host, p.cfg.Port, p.cfg.Password)
+	if err := client.ConnectContext(ctx); err != nil {
+		p.dialFailures.Add(1)
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.open++
+	p.mu.Unlock()
+
+	return &pooledConn{client: client, lastUsed: time.Now()}, nil
+}
+
+func (p *Pool) putIdle(conn *pooledConn) {
+	conn.lastUsed = time.Now()
+
+	p.mu.Lock()
+	if p.closed {
+		p.open--
+		p.mu.Unlock()
+		conn.client.Close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+	p.mu.Unlock()
+}
+
+func (p *Pool) discard(conn *pooledConn) {
+	p.closedBroken.Add(1)
+
+	p.mu.Lock()
+	p.open--
+	p.mu.Unlock()
+
+	conn.client.Close()
+}
+
+// maintain pings idle connections and closes expired ones
+func (p *Pool) maintain() {
+	defer close(p.done)
+
+	interval := p.cfg.KeepAliveInterval
+	if interval <= 0 {
+		if p.cfg.IdleTimeout <= 0 {
+			<-p.stop
+			return
+		}
+		interval = p.cfg.IdleTimeout
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.checkIdle()
+		}
+	}
+}
+
+// checkIdle takes a slot for every idle connection it checks, so pings never
+// push the number of open connections over MaxConns.
+func (p *Pool) checkIdle() {
+	p.mu.Lock()
+	count := len(p.idle)
+	p.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			// Every connection is busy, so nothing is idle
+			return
+		}
+
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			p.release()
+			return
+		}
+		// Oldest first; Execute reuses from the end
+		conn := p.idle[0]
+		p.idle = p.idle[1:]
+		p.mu.Unlock()
+
+		p.checkConn(conn)
+		p.release()
+	}
+}
+
+func (p *Pool) checkConn(conn *pooledConn) {
+	if p.cfg.IdleTimeout > 0 && time.Since(conn.lastUsed) >= p.cfg.IdleTimeout {
+		p.closedExpired.Add(1)
+		p.mu.Lock()
+		p.open--
+		p.mu.Unlock()
+		conn.client.Close()
+		return
+	}
+
+	if p.cfg.KeepAliveInterval > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.CommandTimeout)
+		_, _, err := conn.client.execute(ctx, p.cfg.KeepAliveCommand)
+		cancel()
+		p.keepAlives.Add(1)
+		if err != nil {
+			p.discard(conn)
+			return
+		}
+	}
+
+	// Keep lastUsed so pings don't hold unused connections open forever
+	p.mu.Lock()
+	if p.closed {
+		p.open--
+		p.mu.Unlock()
+		conn.client.Close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+	p.mu.Unlock()
+}
@@ -0,0 +1,147 @@
+package rcon_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexark-user-backend/pkg/rcon"
+	"nexark-user-backend/pkg/rcon/rcontest"
+)
+
+func newPool(t *testing.T, server *rcontest.Server, password string, maxConns int) *rcon.Pool {
+	t.Helper()
+
+	pool := rcon.NewPool(rcon.PoolConfig{
+		Host:           server.Host(),
+		Port:           server.Port(),
+		Password:       password,
+		MaxConns:       maxConns,
+		CommandTimeout: 5 * time.Second,
+	})
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func TestPoolReusesIdleConnection(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.Handle("SaveWorld", "World Saved")
+
+	pool := newPool(t, server, "secret", 2)
+	for i := 0; i < 5; i++ {
+		response, err := pool.Execute(context.Background(), "SaveWorld")
+		if err != nil {
+			t.Fatalf("Execute %d: %v", i, err)
+		}
+		if response.Response != "World Saved" {
+			t.Fatalf("Execute %d: got %q", i, response.Response)
+		}
+	}
+
+	if got := server.Connections(); got != 1 {
+		t.Errorf("server accepted %d connections for sequential commands, want 1", got)
+	}
+	if stats := pool.Stats(); stats.Dials != 1 || stats.IdleConns != 1 {
+		t.Errorf("got %d dials and %d idle connections, want 1 and 1", stats.Dials, stats.IdleConns)
+	}
+}
+
+func TestPoolCapsConcurrentConnections(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.SetLatency(20 * time.Millisecond)
+
+	pool := newPool(t, server, "secret", 2)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Execute(context.Background(), "ListPlayers"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Execute: %v", err)
+	}
+	if got := server.Connections(); got > 2 {
+		t.Errorf("server accepted %d connections, want at most MaxConns=2", got)
+	}
+}
+
+func TestPoolReconnectsAfterServerRestart(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.Handle("GetChat", "hello")
+
+	pool := newPool(t, server, "secret", 1)
+	if _, err := pool.Execute(context.Background(), "GetChat"); err != nil {
+		t.Fatalf("first Execute: %v", err)
+	}
+
+	// The idle connection is now dead; the next command must go out on a new one
+	server.DisconnectAll()
+
+	response, err := pool.Execute(context.Background(), "GetChat")
+	if err != nil {
+		t.Fatalf("Execute after restart: %v", err)
+	}
+	if response.Response != "hello" {
+		t.Fatalf("got %q after reconnecting, want %q", response.Response, "hello")
+	}
+
+	if got := server.Connections(); got != 2 {
+		t.Errorf("server accepted %d connections, want 2", got)
+	}
+	if commands := server.Commands(); len(commands) != 2 {
+		t.Errorf("server received %v, want GetChat exactly twice", commands)
+	}
+}
+
+func TestPoolDoesNotRepeatCommandLostInFlight(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+
+	pool := newPool(t, server, "secret", 1)
+	server.DisconnectOnNextCommand()
+
+	if _, err := pool.Execute(context.Background(), "GiveItemNum 76561198000000001 1 1 0"); err == nil {
+		t.Fatal("Execute succeeded although the connection dropped before answering")
+	}
+	if commands := server.Commands(); len(commands) != 1 {
+		t.Errorf("server received %v, want the command once: it may have run already", commands)
+	}
+
+	// The broken connection was discarded and the pool still works
+	if _, err := pool.Execute(context.Background(), "ListPlayers"); err != nil {
+		t.Fatalf("Execute after a dropped command: %v", err)
+	}
+}
+
+func TestPoolAuthFailure(t *testing.T) {
+	server := rcontest.NewServer("secret")
+	defer server.Close()
+	server.SetAuthFailure(true)
+
+	pool := newPool(t, server, "secret", 1)
+	_, err := pool.Execute(context.Background(), "ListPlayers")
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("got %v, want an authentication error", err)
+	}
+
+	stats := pool.Stats()
+	if stats.DialFailures != 1 || stats.OpenConns != 0 {
+		t.Errorf("got %d dial failures and %d open connections, want 1 and 0", stats.DialFailures, stats.OpenConns)
+	}
+	if commands := server.Commands(); len(commands) != 0 {
+		t.Errorf("server received %v without a successful login", commands)
+	}
+}
@@ -0,0 +1,418 @@
+// Package rcontest provides an in-process Source RCON server for exercising
+// pkg/rcon and the delivery pipeline without a live ARK server, in the spirit
+// of net/http/httptest.
+package rcontest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"nexark-user-backend/pkg/rcon"
+)
+
+// Response is what the fake server answers to one command
+type Response struct {
+	Body string
+	// Delay is added to the server latency before answering
+	Delay time.Duration
+	// Disconnect closes the connection instead of answering
+	Disconnect bool
+}
+
+// Handler produces the response to a command
+type Handler func(command string) Response
+
+type route struct {
+	prefix  string
+	handler Handler
+}
+
+// Server is a fake Source RCON server listening on a local TCP port
+type Server struct {
+	// Addr is the host:port the server listens on
+	Addr string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu               sync.Mutex
+	password         string
+	exact            map[string]Handler
+	routes           []route
+	fallback         Handler
+	latency          time.Duration
+	failAuth         bool
+	mirrorSentinel   bool
+	maxBody          int
+	disconnectNext   bool
+	commands         []string
+	conns            map[net.Conn]bool
+	connectionsTotal int
+	closed           bool
+}
+
+// NewServer starts a server on a random local port. It panics if no port can
+// be opened, like httptest.NewServer.
+func NewServer(password string) *Server {
+	s, err := Listen("127.0.0.1:0", password)
+	if err != nil {
+		panic(fmt.Sprintf("rcontest: failed to listen: %v", err))
+	}
+	return s
+}
+
+// Listen starts a server on addr
+func Listen(addr, password string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:           listener.Addr().String(),
+		listener:       listener,
+		password:       password,
+		exact:          make(map[string]Handler),
+		mirrorSentinel: true,
+		maxBody:        4096,
+		conns:          make(map[net.Conn]bool),
+		fallback: func(command string) Response {
+			return Response{Body: "Server received, But no response!! "}
+		},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Host returns the host part of Addr
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port part of Addr
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return port
+}
+
+// Handle answers command with a fixed body
+func (s *Server) Handle(command, body string) {
+	s.HandleFunc(command, func(string) Response {
+		return Response{Body: body}
+	})
+}
+
+// HandleFunc answers command with handler. Exact matches win over prefixes.
+func (s *Server) HandleFunc(command string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exact[command] = handler
+}
+
+// HandlePrefix answers every command starting with prefix with handler
+func (s *Server) HandlePrefix(prefix string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes = append(s.routes, route{prefix: prefix, handler: handler})
+}
+
+// HandleDefault replaces the answer to commands nothing else matches
+func (s *Server) HandleDefault(handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallback = handler
+}
+
+// SetPlayers answers ListPlayers with the given players
+func (s *Server) SetPlayers(players ...rcon.Player) {
+	s.Handle("ListPlayers", FormatPlayers(players...))
+}
+
+// SetLatency delays every answer by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// SetAuthFailure makes authentication fail regardless of the password
+func (s *Server) SetAuthFailure(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failAuth = fail
+}
+
+// SetSentinelMirroring controls whether empty RESPONSE_VALUE packets are
+// mirrored back, as Source servers do. Turn it off to behave like ARK builds
+// that ignore them.
+func (s *Server) SetSentinelMirroring(mirror bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mirrorSentinel = mirror
+}
+
+// SetMaxPacketBody splits responses into packets of at most n body bytes
+func (s *Server) SetMaxPacketBody(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > 0 {
+		s.maxBody = n
+	}
+}
+
+// DisconnectOnNextCommand drops the connection that sends the next command
+// without answering it
+func (s *Server) DisconnectOnNextCommand() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disconnectNext = true
+}
+
+// DisconnectAll closes every open client connection, as a server restart would
+func (s *Server) DisconnectAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Commands returns the commands received so far, in order
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Connections returns how many connections were accepted so far
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connectionsTotal
+}
+
+// Close stops the server and closes all connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// FormatPlayers renders players the way ARK answers ListPlayers
+func FormatPlayers(players ...rcon.Player) string {
+	if len(players) == 0 {
+		return "No Players Connected"
+	}
+
+	var b strings.Builder
+	for i, player := range players {
+		fmt.Fprintf(&b, "%d. %s, %s\n", i, player.Name, player.ID)
+	}
+	return b.String()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.connectionsTotal++
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	authenticated := false
+	for {
+		id, packetType, body, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch packetType {
+		case rcon.SERVERDATA_AUTH:
+			s.mu.Lock()
+			ok := !s.failAuth && body == s.password
+			s.mu.Unlock()
+
+			responseID := id
+			if !ok {
+				responseID = -1
+			}
+			authenticated = ok
+
+			if err := writePackets(conn,
+				packet{id, rcon.SERVERDATA_RESPONSE_VALUE, ""},
+				packet{responseID, rcon.SERVERDATA_AUTH_RESPONSE, ""},
+			); err != nil {
+				return
+			}
+
+		case rcon.SERVERDATA_EXECCOMMAND:
+			if !authenticated {
+				return
+			}
+			if !s.answer(conn, id, body) {
+				return
+			}
+
+		case rcon.SERVERDATA_RESPONSE_VALUE:
+			s.mu.Lock()
+			mirror := s.mirrorSentinel
+			s.mu.Unlock()
+
+			// Source servers mirror the empty packet, then send one with body 0x0001
+			if mirror {
+				if err := writePackets(conn,
+					packet{id, rcon.SERVERDATA_RESPONSE_VALUE, ""},
+					packet{id, rcon.SERVERDATA_RESPONSE_VALUE, "\x00\x01\x00\x00"},
+				); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// answer runs the handler for command and writes its response, split into
+// packets. It returns false when the connection should be closed.
+func (s *Server) answer(conn net.Conn, id int32, command string) bool {
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	disconnect := s.disconnectNext
+	s.disconnectNext = false
+	handler := s.handlerFor(command)
+	latency := s.latency
+	maxBody := s.maxBody
+	s.mu.Unlock()
+
+	if disconnect {
+		return false
+	}
+
+	response := handler(command)
+	if response.Disconnect {
+		return false
+	}
+
+	if delay := latency + response.Delay; delay > 0 {
+		time.Sleep(delay)
+	}
+
+	var packets []packet
+	body := response.Body
+	for len(body) > maxBody {
+		packets = append(packets, packet{id, rcon.SERVERDATA_RESPONSE_VALUE, body[:maxBody]})
+		body = body[maxBody:]
+	}
+	packets = append(packets, packet{id, rcon.SERVERDATA_RESPONSE_VALUE, body})
+
+	return writePackets(conn, packets...) == nil
+}
+
+// handlerFor must be called with s.mu held
+func (s *Server) handlerFor(command string) Handler {
+	if handler, ok := s.exact[command]; ok {
+		return handler
+	}
+	for _, route := range s.routes {
+		if strings.HasPrefix(command, route.prefix) {
+			return route.handler
+		}
+	}
+	return s.fallback
+}
+
+type packet struct {
+	id         int32
+	packetType int32
+	body       string
+}
+
+func writePackets(conn net.Conn, packets ...packet) error {
+	var buf bytes.Buffer
+	for _, p := range packets {
+		binary.Write(&buf, binary.LittleEndian, int32(len(p.body)+10))
+		binary.Write(&buf, binary.LittleEndian, p.id)
+		binary.Write(&buf, binary.LittleEndian, p.packetType)
+		buf.WriteString(p.body)
+		buf.Write([]byte{0, 0})
+	}
+
+	_, err := conn.Write(buf.Bytes())
+	return err
+}
+
+func readPacket(conn net.Conn) (int32, int32, string, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, 0, "", err
+	}
+
+	size := int32(binary.LittleEndian.Uint32(header[0:4]))
+	id := int32(binary.LittleEndian.Uint32(header[4:8]))
+	packetType := int32(binary.LittleEndian.Uint32(header[8:12]))
+	if size < 10 || size > 4096+10 {
+		return 0, 0, "", fmt.Errorf("invalid packet size %d", size)
+	}
+
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, 0, "", err
+	}
+
+	return id, packetType, string(bytes.TrimRight(body, "\x00")), nil
+}
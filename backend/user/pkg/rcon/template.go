@@ -0,0 +1,234 @@
+package rcon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Placeholders supported in command templates, e.g.
+// "GiveItemToPlayer {eos_id} Blueprint'/Game/...' {quantity} 0 0".
+// A literal brace is written as "{{" or "}}".
+const (
+	PlaceholderSteamID    = "steam_id"
+	PlaceholderEOSID      = "eos_id"
+	PlaceholderQuantity   = "quantity"
+	PlaceholderPlayerName = "player_name"
+	PlaceholderServerName = "server_name"
+)
+
+const maxTemplateLength = 1000
+
+var knownPlaceholders = map[string]bool{
+	PlaceholderSteamID:    true,
+	PlaceholderEOSID:      true,
+	PlaceholderQuantity:   true,
+	PlaceholderPlayerName: true,
+	PlaceholderServerName: true,
+}
+
+var (
+	steamIDValuePattern = regexp.MustCompile(`^\d{17}$`)
+	eosIDValuePattern   = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+)
+
+// ValidEOSID reports whether id has the shape of an Epic Online Services
+// player ID, as printed by ListPlayers on ARK: Survival Ascended
+func ValidEOSID(id string) bool {
+	return eosIDValuePattern.MatchString(id)
+}
+
+// TemplateVars holds the values substituted into a command template
+type TemplateVars struct {
+	SteamID    string
+	EOSID      string
+	Quantity   int
+	PlayerName string
+	ServerName string
+}
+
+type templateSegment struct {
+	literal     string
+	placeholder string
+}
+
+// ValidateCommandTemplate checks that tmpl is a single-line command whose
+// placeholders are all known and whose braces are balanced.
+func ValidateCommandTemplate(tmpl string) error {
+	_, err := parseTemplate(tmpl)
+	return err
+}
+
+// TemplatePlaceholders returns the distinct placeholders used by tmpl
+func TemplatePlaceholders(tmpl string) ([]string, error) {
+	segments, err := parseTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var placeholders []string
+	for _, segment := range segments {
+		if segment.placeholder != "" && !seen[segment.placeholder] {
+			seen[segment.placeholder] = true
+			placeholders = append(placeholders, segment.placeholder)
+		}
+	}
+
+	return placeholders, nil
+}
+
+// UsesPlaceholder reports whether tmpl references the given placeholder
+func UsesPlaceholder(tmpl, placeholder string) bool {
+	placeholders, err := TemplatePlaceholders(tmpl)
+	if err != nil {
+		return false
+	}
+
+	for _, p := range placeholders {
+		if p == placeholder {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderCommandTemplate substitutes vars into tmpl. Every value is checked or
+// sanitized for its placeholder so player-controlled data such as names cannot
+// inject extra arguments or commands.
+func RenderCommandTemplate(tmpl string, vars TemplateVars) (string, error) {
+	segments, err := parseTemplate(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, segment := range segments {
+		if segment.placeholder == "" {
+			b.WriteString(segment.literal)
+			continue
+		}
+
+		value, err := placeholderValue(segment.placeholder, vars)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), nil
+}
+
+func placeholderValue(placeholder string, vars TemplateVars) (string, error) {
+	switch placeholder {
+	case PlaceholderSteamID:
+		if vars.SteamID == "" {
+			return "", fmt.Errorf("missing value for {%s}", placeholder)
+		}
+		if !steamIDValuePattern.MatchString(vars.SteamID) {
+			return "", fmt.Errorf("invalid value for {%s}", placeholder)
+		}
+		return vars.SteamID, nil
+	case PlaceholderEOSID:
+		if vars.EOSID == "" {
+			return "", fmt.Errorf("missing value for {%s}", placeholder)
+		}
+		if !eosIDValuePattern.MatchString(vars.EOSID) {
+			return "", fmt.Errorf("invalid value for {%s}", placeholder)
+		}
+		return vars.EOSID, nil
+	case PlaceholderQuantity:
+		if vars.Quantity < 1 {
+			return "", fmt.Errorf("invalid value for {%s}", placeholder)
+		}
+		return strconv.Itoa(vars.Quantity), nil
+	case PlaceholderPlayerName:
+		name := sanitizeName(vars.PlayerName)
+		if name == "" {
+			return "", fmt.Errorf("missing value for {%s}", placeholder)
+		}
+		return name, nil
+	case PlaceholderServerName:
+		name := sanitizeName(vars.ServerName)
+		if name == "" {
+			return "", fmt.Errorf("missing value for {%s}", placeholder)
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown placeholder {%s}", placeholder)
+	}
+}
+
+// sanitizeName keeps letters, digits, spaces and a few harmless punctuation
+// characters, so a name can never break out of its argument position.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+			b.WriteRune(r)
+		case r == ' ' || r == '_' || r == '-' || r == '.':
+			b.WriteRune(r)
+		}
+	}
+
+	sanitized := strings.Join(strings.Fields(b.String()), " ")
+	if runes := []rune(sanitized); len(runes) > 64 {
+		sanitized = strings.TrimSpace(string(runes[:64]))
+	}
+	return sanitized
+}
+
+func parseTemplate(tmpl string) ([]templateSegment, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return nil, fmt.Errorf("command template is empty")
+	}
+	if len(tmpl) > maxTemplateLength {
+		return nil, fmt.Errorf("command template exceeds %d characters", maxTemplateLength)
+	}
+
+	var segments []templateSegment
+	var literal strings.Builder
+
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			segments = append(segments, templateSegment{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(tmpl); i++ {
+		ch := tmpl[i]
+		switch {
+		case ch == '\n' || ch == '\r' || ch == 0:
+			return nil, fmt.Errorf("command template must be a single line")
+		case ch == '{' && i+1 < len(tmpl) && tmpl[i+1] == '{':
+			literal.WriteByte('{')
+			i++
+		case ch == '}' && i+1 < len(tmpl) && tmpl[i+1] == '}':
+			literal.WriteByte('}')
+			i++
+		case ch == '{':
+			end := strings.IndexByte(tmpl[i+1:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder at position %d", i)
+			}
+			name := tmpl[i+1 : i+1+end]
+			if !knownPlaceholders[name] {
+				return nil, fmt.Errorf("unknown placeholder {%s}", name)
+			}
+			flushLiteral()
+			segments = append(segments, templateSegment{placeholder: name})
+			i += end + 1
+		case ch == '}':
+			return nil, fmt.Errorf("unexpected '}' at position %d", i)
+		default:
+			literal.WriteByte(ch)
+		}
+	}
+	flushLiteral()
+
+	return segments, nil
+}
@@ -145,3 +145,10 @@ func (s *SteamAuth) verifyWithSteam(ctx context.Context, params url.Values) erro
 
 	return nil
 }
+
+var steamID64Pattern = regexp.MustCompile(`^7656119\d{10}$`)
+
+// IsValidSteamID reports whether id looks like an individual account SteamID64
+func IsValidSteamID(id string) bool {
+	return steamID64Pattern.MatchString(id)
+}
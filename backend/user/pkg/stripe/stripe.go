@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"nexark-user-backend/pkg/money"
+
 	"github.com/stripe/stripe-go/v75"
 	checkoutsession "github.com/stripe/stripe-go/v75/checkout/session"
 	"github.com/stripe/stripe-go/v75/customer"
@@ -29,7 +31,7 @@ func NewStripeService(secretKey, webhookSecret string) *StripeService {
 }
 
 type CreatePaymentIntentParams struct {
-	Amount                  int64
+	Amount                  money.Amount
 	Currency                string
 	CustomerID              string
 	PaymentMethodTypes      []string
@@ -39,7 +41,7 @@ type CreatePaymentIntentParams struct {
 
 func (s *StripeService) CreatePaymentIntent(ctx context.Context, params CreatePaymentIntentParams) (*stripe.PaymentIntent, error) {
 	piParams := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(params.Amount),
+		Amount:   stripe.Int64(params.Amount.Minor()),
 		Currency: stripe.String(params.Currency),
 		Customer: stripe.String(params.CustomerID),
 	}
@@ -157,14 +159,15 @@ func (s *StripeService) ListCustomerPaymentMethods(ctx context.Context, customer
 	return methods, nil
 }
 
-func (s *StripeService) CreateRefund(ctx context.Context, paymentIntentID string, amount *int64, reason string) (*stripe.Refund, error) {
+// CreateRefund refunds a payment intent in full, or amount of it when set
+func (s *StripeService) CreateRefund(ctx context.Context, paymentIntentID string, amount *money.Amount, reason string) (*stripe.Refund, error) {
 	params := &stripe.RefundParams{
 		PaymentIntent: stripe.String(paymentIntentID),
 		Reason:        stripe.String(reason),
 	}
 
 	if amount != nil {
-		params.Amount = stripe.Int64(*amount)
+		params.Amount = stripe.Int64(amount.Minor())
 	}
 
 	ref, err := refund.New(params)
@@ -180,7 +183,7 @@ type CreateCheckoutSessionParams struct {
 	CustomerID         string
 	SuccessURL         string
 	CancelURL          string
-	Amount             int64
+	Amount             money.Amount
 	Currency           string
 	PaymentMethodTypes []string
 	Metadata           map[string]string
@@ -201,7 +204,7 @@ func (s *StripeService) CreateCheckoutSession(ctx context.Context, p CreateCheck
 					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
 						Name: stripe.String(p.Description),
 					},
-					UnitAmount: stripe.Int64(p.Amount),
+					UnitAmount: stripe.Int64(p.Amount.Minor()),
 				},
 				Quantity: stripe.Int64(1),
 			},